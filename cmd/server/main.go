@@ -3,10 +3,15 @@ package main
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -18,12 +23,37 @@ import (
 	"github.com/mamed-gasimov/file-service/internal/messaging/rabbitmq"
 	"github.com/mamed-gasimov/file-service/internal/modules/analysis/openai"
 	"github.com/mamed-gasimov/file-service/internal/modules/files"
+	"github.com/mamed-gasimov/file-service/internal/modules/folders"
+	"github.com/mamed-gasimov/file-service/internal/modules/jobs"
+	"github.com/mamed-gasimov/file-service/internal/modules/prompts"
+	"github.com/mamed-gasimov/file-service/internal/modules/usage"
 	"github.com/mamed-gasimov/file-service/internal/server"
+	"github.com/mamed-gasimov/file-service/internal/storage"
+	"github.com/mamed-gasimov/file-service/internal/storage/compressed"
+	"github.com/mamed-gasimov/file-service/internal/storage/encrypted"
 	miniostorage "github.com/mamed-gasimov/file-service/internal/storage/minio"
 )
 
 func main() {
-	if err := run(); err != nil {
+	cmd := "serve"
+	if len(os.Args) > 1 {
+		cmd = os.Args[1]
+	}
+
+	var err error
+	switch cmd {
+	case "serve":
+		err = run()
+	case "rotate-keys":
+		err = rotateKeys()
+	case "reconcile":
+		err = reconcile(os.Args[2:])
+	case "analyze-batch":
+		err = analyzeBatch(os.Args[2:])
+	default:
+		err = fmt.Errorf("unknown command %q (want serve, rotate-keys, reconcile or analyze-batch)", cmd)
+	}
+	if err != nil {
 		log.Fatal(err)
 	}
 }
@@ -35,42 +65,20 @@ func run() error {
 	}
 
 	// --- Database -----------------------------------------------------------
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	pool, err := pgxpool.New(ctx, cfg.PostgresDSN())
+	pool, err := connectDB(cfg)
 	if err != nil {
-		return fmt.Errorf("connect to postgres: %w", err)
+		return err
 	}
 	defer pool.Close()
 
-	if err := pool.Ping(ctx); err != nil {
-		return fmt.Errorf("ping postgres: %w", err)
-	}
-	log.Println("connected to PostgreSQL")
-
-	if err := runMigrations(cfg.PostgresDSN()); err != nil {
-		return fmt.Errorf("run migrations: %w", err)
-	}
+	fileRepo := files.NewFileRepository(pool)
 
 	// --- Object Storage (MinIO) ---------------------------------------------
-	minioBucket := cfg.Minio.Bucket
-	store, err := miniostorage.New(
-		cfg.Minio.Endpoint,
-		cfg.Minio.AccessKey,
-		cfg.Minio.SecretKey,
-		minioBucket,
-		cfg.Minio.UseSSL,
-	)
+	store, err := newStorage(cfg, fileRepo)
 	if err != nil {
-		return fmt.Errorf("init minio: %w", err)
+		return err
 	}
 
-	if err := store.EnsureBucket(context.Background(), minioBucket); err != nil {
-		return fmt.Errorf("ensure bucket: %w", err)
-	}
-	log.Printf("MinIO bucket %q is ready\n", minioBucket)
-
 	// --- Messaging (RabbitMQ) -----------------------------------------------
 	broker, err := rabbitmq.NewClient(cfg.RabbitMQ.URL)
 	if err != nil {
@@ -79,19 +87,70 @@ func run() error {
 	defer broker.Close()
 
 	// --- Analysis (OpenAI) --------------------------------------------------
-	analysisProvider := openai.NewProvider(cfg.OpenAI.APIKey, cfg.OpenAI.BaseURL)
+	analysisProvider := openai.NewProvider(cfg.OpenAI.APIKey, cfg.OpenAI.BaseURL, cfg.OpenAI.EmbeddingModel, cfg.OpenAI.TranscriptionModel, cfg.OpenAI.VisionModel)
 
 	// --- Layers -------------------------------------------------------------
-	fileRepo := files.NewFileRepository(pool)
-	fileSvc := files.NewFileService(fileRepo, store, analysisProvider, broker)
+	promptSvc := prompts.NewPromptService(prompts.NewPromptRepository(pool))
+	promptHandler := prompts.NewPromptHandler(promptSvc)
+
+	usageSvc, err := newUsageService(cfg, pool)
+	if err != nil {
+		return err
+	}
+	usageHandler := usage.NewUsageHandler(usageSvc)
+
+	queueWorkers, err := jobs.ParseQueueWorkers(cfg.Jobs.Queues)
+	if err != nil {
+		return fmt.Errorf("parse JOBS_QUEUES: %w", err)
+	}
+	jobSvc := jobs.NewJobService(jobs.NewJobRepository(pool),
+		jobs.WithWorkers(cfg.Jobs.Workers),
+		jobs.WithQueueWorkers(queueWorkers),
+		jobs.WithPollInterval(cfg.Jobs.PollInterval),
+		jobs.WithTimeout(cfg.Jobs.Timeout),
+		jobs.WithRetention(cfg.Jobs.Retention),
+		jobs.WithShutdownTimeout(cfg.Jobs.ShutdownTimeout),
+	)
+	jobHandler := jobs.NewJobHandler(jobSvc)
+
+	languages, err := files.NormalizeLanguages(cfg.Translation.Languages)
+	if err != nil {
+		return fmt.Errorf("parse TRANSLATION_LANGUAGES: %w", err)
+	}
+
+	fileOpts := append(analysisOptions(cfg, analysisProvider, promptSvc, usageSvc),
+		files.WithThumbnailSizes(cfg.Thumbnail.Sizes...),
+		files.WithTrashRetention(cfg.Cleanup.TrashRetention),
+		files.WithMaxVersions(cfg.Versions.Max),
+		files.WithTranslationLanguages(languages...),
+		files.WithJobs(jobSvc),
+	)
+	if cfg.Metadata.Private {
+		fileOpts = append(fileOpts, files.WithPrivateMetadata())
+	}
+	fileSvc := files.NewFileService(fileRepo, store, analysisProvider, broker, fileOpts...)
 	fileHandler := files.NewFileHandler(fileSvc)
+	registerJobs(cfg, jobSvc, fileSvc)
+
+	folderSvc := folders.NewFolderService(folders.NewFolderRepository(pool), fileSvc)
+	folderHandler := folders.NewFolderHandler(folderSvc)
 
-	// --- Result consumer (async translation replies) ------------------------
-	consumerCtx, consumerCancel := context.WithCancel(context.Background())
-	defer consumerCancel()
-	go files.ConsumeAnalysisResults(consumerCtx, broker, fileRepo)
+	// --- Background work (translation replies, jobs) -----------------------
+	bgCtx, bgCancel := context.WithCancel(context.Background())
+	defer bgCancel()
+
+	var bg sync.WaitGroup
+	bg.Add(2)
+	go func() {
+		defer bg.Done()
+		files.ConsumeAnalysisResults(bgCtx, broker, fileRepo)
+	}()
+	go func() {
+		defer bg.Done()
+		jobSvc.Run(bgCtx)
+	}()
 
-	e := server.New(fileHandler)
+	e := server.New(fileHandler, folderHandler, promptHandler, usageHandler, jobHandler)
 
 	// --- Graceful shutdown ---------------------------------------------------
 	go func() {
@@ -107,12 +166,383 @@ func run() error {
 	<-quit
 
 	log.Println("shutting down …")
-	consumerCancel()
 
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer shutdownCancel()
+	err = e.Shutdown(shutdownCtx)
+
+	// Running jobs get JOBS_SHUTDOWN_TIMEOUT to finish once no more
+	// requests come in.
+	bgCancel()
+	bg.Wait()
 
-	return e.Shutdown(shutdownCtx)
+	return err
+}
+
+// newUsageService builds the usage service with the configured prices and
+// budgets.
+func newUsageService(cfg *config.Config, pool *pgxpool.Pool) (*usage.UsageService, error) {
+	prices, err := usage.ParsePrices(cfg.Usage.Prices)
+	if err != nil {
+		return nil, fmt.Errorf("parse USAGE_PRICES: %w", err)
+	}
+
+	return usage.NewUsageService(usage.NewUsageRepository(pool),
+		usage.WithPrices(prices),
+		usage.WithDailyBudget(cfg.Usage.DailyBudget),
+		usage.WithTenantDailyBudget(cfg.Usage.TenantDailyBudget),
+	), nil
+}
+
+// analysisOptions returns the FileService options analyses depend on: the
+// provider for embeddings, answers, transcripts and images, prompt
+// templates, usage metering, the result cache and the rate limits.
+func analysisOptions(cfg *config.Config, provider *openai.Provider, promptSvc *prompts.PromptService, usageSvc *usage.UsageService) []files.Option {
+	opts := []files.Option{
+		files.WithEmbedder(provider),
+		files.WithAnswerer(provider),
+		files.WithTranscriber(provider),
+		files.WithImageAnalyzer(provider, cfg.Analysis.ImageMaxSize),
+		files.WithPromptTemplates(promptSvc),
+		files.WithUsageMeter(usageSvc),
+		files.WithBatchConcurrency(cfg.Analysis.BatchConcurrency),
+	}
+	if cfg.AnalysisCache.Size > 0 {
+		opts = append(opts, files.WithAnalysisCache(cfg.AnalysisCache.Size))
+	}
+	if cfg.Analysis.RateLimit > 0 {
+		opts = append(opts, files.WithAnalysisRateLimit(cfg.Analysis.RateLimit))
+	}
+	switch {
+	case cfg.PII.ModelDetection:
+		opts = append(opts, files.WithPIIDetection(provider))
+	case cfg.PII.Detect:
+		opts = append(opts, files.WithPIIDetection(nil))
+	}
+	if cfg.PII.Redact {
+		opts = append(opts, files.WithPIIRedaction())
+	}
+	return opts
+}
+
+// registerJobs defines the background job types: analyses, thumbnails,
+// personal data scans and embeddings submitted by requests, and the periodic
+// cleanup jobs that are enabled.
+func registerJobs(cfg *config.Config, jobSvc *jobs.JobService, fileSvc *files.FileService) {
+	jobSvc.Register(jobs.Definition{
+		Type:    jobs.TypeAnalyze,
+		Queue:   jobs.QueueAnalysis,
+		Backoff: 30 * time.Second,
+		Handler: jobs.Typed(fileSvc.RunAnalysisJob),
+	})
+	jobSvc.Register(jobs.Definition{
+		Type:    jobs.TypeAnalyzeBatch,
+		Queue:   jobs.QueueBatch,
+		Backoff: time.Minute,
+		Handler: jobs.Typed(fileSvc.RunAnalysisBatchJob),
+	})
+	jobSvc.Register(jobs.Definition{
+		Type:    jobs.TypeThumbnails,
+		Queue:   jobs.QueueDefault,
+		Handler: jobs.Typed(fileSvc.RunThumbnailJob),
+	})
+	jobSvc.Register(jobs.Definition{
+		Type:    jobs.TypeDetectPII,
+		Queue:   jobs.QueueDefault,
+		Backoff: 30 * time.Second,
+		Handler: jobs.Typed(fileSvc.RunPIIJob),
+	})
+	jobSvc.Register(jobs.Definition{
+		Type:    jobs.TypeEmbed,
+		Queue:   jobs.QueueDefault,
+		Backoff: 30 * time.Second,
+		Handler: jobs.Typed(fileSvc.RunEmbedJob),
+	})
+
+	if cfg.Cleanup.ReapInterval > 0 {
+		jobSvc.Register(jobs.Definition{
+			Type:        jobs.TypeReap,
+			Queue:       jobs.QueueMaintenance,
+			MaxAttempts: 1,
+			Every:       cfg.Cleanup.ReapInterval,
+			Handler:     fileSvc.RunReapJob,
+		})
+	}
+	if cfg.Cleanup.ReconcileInterval > 0 {
+		jobSvc.Register(jobs.Definition{
+			Type:        jobs.TypeReconcile,
+			Queue:       jobs.QueueMaintenance,
+			MaxAttempts: 1,
+			Every:       cfg.Cleanup.ReconcileInterval,
+			Handler:     fileSvc.ReconcileJob(cfg.Cleanup.ReconcileClean),
+		})
+	}
+}
+
+// rotateKeys re-wraps every stored data key with the current master key.
+func rotateKeys() error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("load config: %w", err)
+	}
+
+	keyring, err := newKeyring(cfg)
+	if err != nil {
+		return err
+	}
+	if keyring == nil {
+		return fmt.Errorf("ENCRYPTION_MASTER_KEY is not set")
+	}
+
+	pool, err := connectDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	rotated, err := encrypted.Rotate(context.Background(), files.NewFileRepository(pool), keyring)
+	if err != nil {
+		return fmt.Errorf("rotate keys: %w", err)
+	}
+
+	log.Printf("re-wrapped %d data keys with master key %q\n", rotated, keyring.CurrentID())
+	return nil
+}
+
+// reconcile compares the bucket with the database once and prints the
+// report. With -clean the orphans found are removed.
+func reconcile(args []string) error {
+	fs := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	clean := fs.Bool("clean", false, "delete orphan objects, drop rows whose object is missing and trash their files")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("load config: %w", err)
+	}
+
+	pool, err := connectDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	fileRepo := files.NewFileRepository(pool)
+	store, err := newStorage(cfg, fileRepo)
+	if err != nil {
+		return err
+	}
+
+	fileSvc := files.NewFileService(fileRepo, store, nil, nil)
+	report, err := fileSvc.Reconcile(context.Background(), *clean)
+	if err != nil {
+		return fmt.Errorf("reconcile: %w", err)
+	}
+
+	out := json.NewEncoder(os.Stdout)
+	out.SetIndent("", "  ")
+	return out.Encode(report)
+}
+
+// analyzeBatch runs an analysis on many files in this process, against the
+// database and storage directly, and prints the result. Progress is logged;
+// an interrupt stops the batch and prints what was done.
+func analyzeBatch(args []string) error {
+	fs := flag.NewFlagSet("analyze-batch", flag.ExitOnError)
+	ids := fs.String("ids", "", "comma-separated IDs of the files to analyze, instead of the filters")
+	folder := fs.Int64("folder", -1, "only analyze files in this folder (0 is the root)")
+	tags := fs.String("tags", "", "only analyze files carrying all of these comma-separated tags")
+	meta := fs.String("metadata", "", "only analyze files with this metadata, as comma-separated key=value pairs")
+	typ := fs.String("type", "", "analysis type (summary by default)")
+	prompt := fs.String("prompt", "", "prompt template to use instead of the built-in prompt")
+	promptVersion := fs.Int("prompt-version", 0, "version of the prompt template (latest by default)")
+	targetLanguage := fs.String("target-language", "", "language to ask for the output in")
+	force := fs.Bool("force", false, "analyze again even when a cached result exists")
+	concurrency := fs.Int("concurrency", 0, "analyses to run at a time (ANALYSIS_BATCH_CONCURRENCY by default)")
+	tenant := fs.String("tenant", "", "tenant the AI calls are accounted to")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	opts := files.BatchOptions{
+		Analysis: files.AnalysisOptions{
+			Type:           *typ,
+			Prompt:         *prompt,
+			PromptVersion:  *promptVersion,
+			TargetLanguage: *targetLanguage,
+			Force:          *force,
+		},
+	}
+	for _, s := range splitList(*ids) {
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid file id %q", s)
+		}
+		opts.IDs = append(opts.IDs, id)
+	}
+	if *folder >= 0 {
+		opts.Filter.FolderID = folder
+	}
+	opts.Filter.Tags = splitList(*tags)
+	for _, pair := range splitList(*meta) {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("invalid metadata %q, want key=value", pair)
+		}
+		if opts.Filter.Metadata == nil {
+			opts.Filter.Metadata = make(map[string]string)
+		}
+		opts.Filter.Metadata[key] = value
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("load config: %w", err)
+	}
+	if *concurrency > 0 {
+		cfg.Analysis.BatchConcurrency = *concurrency
+	}
+
+	pool, err := connectDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	fileRepo := files.NewFileRepository(pool)
+	store, err := newStorage(cfg, fileRepo)
+	if err != nil {
+		return err
+	}
+
+	usageSvc, err := newUsageService(cfg, pool)
+	if err != nil {
+		return err
+	}
+	provider := openai.NewProvider(cfg.OpenAI.APIKey, cfg.OpenAI.BaseURL, cfg.OpenAI.EmbeddingModel, cfg.OpenAI.TranscriptionModel, cfg.OpenAI.VisionModel)
+	promptSvc := prompts.NewPromptService(prompts.NewPromptRepository(pool))
+	fileSvc := files.NewFileService(fileRepo, store, provider, nil, analysisOptions(cfg, provider, promptSvc, usageSvc)...)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if *tenant != "" {
+		ctx = usage.WithTenant(ctx, *tenant)
+	}
+
+	lastPercent := -1
+	opts.Progress = func(done, total int) {
+		if percent := 100 * done / total; percent != lastPercent {
+			lastPercent = percent
+			log.Printf("analyzed %d of %d files (%d%%)", done, total, percent)
+		}
+	}
+
+	result, err := fileSvc.AnalyzeBatch(ctx, opts)
+	if result != nil {
+		out := json.NewEncoder(os.Stdout)
+		out.SetIndent("", "  ")
+		if err := out.Encode(result); err != nil {
+			return err
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("analyze batch: %w", err)
+	}
+	return nil
+}
+
+// splitList splits a comma-separated flag value, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// newStorage connects to MinIO and wraps it in the configured decorators.
+func newStorage(cfg *config.Config, fileRepo *files.FileRepository) (storage.Storage, error) {
+	minioBucket := cfg.Minio.Bucket
+	minioClient, err := miniostorage.New(
+		cfg.Minio.Endpoint,
+		cfg.Minio.AccessKey,
+		cfg.Minio.SecretKey,
+		minioBucket,
+		cfg.Minio.UseSSL,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("init minio: %w", err)
+	}
+
+	if err := minioClient.EnsureBucket(context.Background(), minioBucket); err != nil {
+		return nil, fmt.Errorf("ensure bucket: %w", err)
+	}
+	log.Printf("MinIO bucket %q is ready\n", minioBucket)
+
+	var store storage.Storage = minioClient
+
+	keyring, err := newKeyring(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if keyring != nil {
+		store = encrypted.New(store, keyring, fileRepo)
+		log.Printf("client-side encryption enabled (master key %q)\n", keyring.CurrentID())
+	}
+
+	// Compression wraps encryption: ciphertext does not compress.
+	return compressed.New(store, fileRepo), nil
+}
+
+// connectDB opens the PostgreSQL pool and applies pending migrations.
+func connectDB(cfg *config.Config) (*pgxpool.Pool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	pool, err := pgxpool.New(ctx, cfg.PostgresDSN())
+	if err != nil {
+		return nil, fmt.Errorf("connect to postgres: %w", err)
+	}
+
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("ping postgres: %w", err)
+	}
+	log.Println("connected to PostgreSQL")
+
+	if err := runMigrations(cfg.PostgresDSN()); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("run migrations: %w", err)
+	}
+
+	return pool, nil
+}
+
+// newKeyring builds the master keyring, or returns nil when encryption is disabled.
+func newKeyring(cfg *config.Config) (*encrypted.Keyring, error) {
+	if cfg.Encryption.MasterKey == "" {
+		return nil, nil
+	}
+
+	current, err := encrypted.ParseKey(cfg.Encryption.MasterKey)
+	if err != nil {
+		return nil, fmt.Errorf("parse ENCRYPTION_MASTER_KEY: %w", err)
+	}
+
+	previous, err := encrypted.ParseKeys(cfg.Encryption.PreviousKeys)
+	if err != nil {
+		return nil, fmt.Errorf("parse ENCRYPTION_PREVIOUS_KEYS: %w", err)
+	}
+
+	keyring, err := encrypted.NewKeyring(cfg.Encryption.MasterKeyID, current, previous)
+	if err != nil {
+		return nil, fmt.Errorf("init keyring: %w", err)
+	}
+	return keyring, nil
 }
 
 func runMigrations(dsn string) error {
@@ -0,0 +1,87 @@
+// Package cache provides an in-process LRU cache.
+package cache
+
+import (
+	"container/list"
+	"sync"
+)
+
+// LRU is a fixed-size cache that evicts the least recently used entry. It
+// is safe for concurrent use.
+type LRU[K comparable, V any] struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List // front is the most recently used
+	entries  map[K]*list.Element
+
+	hits   int64
+	misses int64
+}
+
+type entry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+// Stats reports the size and lookups of an LRU since it was created.
+type Stats struct {
+	Size     int   `json:"size"`
+	Capacity int   `json:"capacity"`
+	Hits     int64 `json:"hits"`
+	Misses   int64 `json:"misses"`
+}
+
+// NewLRU returns a cache holding at most capacity entries, which must be
+// positive.
+func NewLRU[K comparable, V any](capacity int) *LRU[K, V] {
+	return &LRU[K, V]{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[K]*list.Element, capacity),
+	}
+}
+
+// Get returns the value cached for key and marks it as recently used.
+func (c *LRU[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		var zero V
+		return zero, false
+	}
+
+	c.hits++
+	c.order.MoveToFront(el)
+	return el.Value.(*entry[K, V]).value, true
+}
+
+// Add caches value for key, evicting the least recently used entry when
+// the cache is full.
+func (c *LRU[K, V]) Add(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		el.Value.(*entry[K, V]).value = value
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&entry[K, V]{key: key, value: value})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*entry[K, V]).key)
+	}
+}
+
+// Stats returns the current size and the hit and miss counts.
+func (c *LRU[K, V]) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return Stats{Size: c.order.Len(), Capacity: c.capacity, Hits: c.hits, Misses: c.misses}
+}
@@ -0,0 +1,85 @@
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	// Register the remaining pure-Go decoders with the image package.
+	_ "image/gif"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// MaxPixels bounds the decoded size of a source image so a small, highly
+// compressed upload cannot exhaust memory when it is expanded.
+const MaxPixels = 50_000_000
+
+const jpegQuality = 85
+
+// Decode decodes a JPEG, PNG, GIF or WebP image after checking its
+// dimensions against MaxPixels. It returns the image and its format name.
+func Decode(data []byte) (image.Image, string, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("decode image config: %w", err)
+	}
+	if cfg.Width*cfg.Height > MaxPixels {
+		return nil, "", fmt.Errorf("image too large: %dx%d", cfg.Width, cfg.Height)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("decode %s image: %w", format, err)
+	}
+	return img, format, nil
+}
+
+// Fit scales img down so that its longest side is at most maxSize pixels,
+// preserving the aspect ratio. Images that already fit are returned as is.
+func Fit(img image.Image, maxSize int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= maxSize && h <= maxSize {
+		return img
+	}
+
+	if w >= h {
+		h = max(1, h*maxSize/w)
+		w = maxSize
+	} else {
+		w = max(1, w*maxSize/h)
+		h = maxSize
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Over, nil)
+	return dst
+}
+
+// Encode writes img as JPEG when it is fully opaque and as PNG otherwise,
+// so transparency survives. It returns the MIME type and file extension used.
+func Encode(w io.Writer, img image.Image) (mimeType, ext string, err error) {
+	if isOpaque(img) {
+		if err := jpeg.Encode(w, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return "", "", fmt.Errorf("encode jpeg: %w", err)
+		}
+		return "image/jpeg", "jpg", nil
+	}
+
+	if err := png.Encode(w, img); err != nil {
+		return "", "", fmt.Errorf("encode png: %w", err)
+	}
+	return "image/png", "png", nil
+}
+
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
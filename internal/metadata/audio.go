@@ -0,0 +1,161 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+func extractAudio(data []byte, size int64, props Properties) {
+	switch {
+	case len(data) > 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WAVE":
+		extractWAV(data, props)
+	case bytes.HasPrefix(data, []byte("fLaC")):
+		extractFLAC(data, props)
+	default:
+		extractMP3(data, size, props)
+	}
+}
+
+func setDuration(props Properties, seconds float64) {
+	if seconds > 0 && !math.IsInf(seconds, 0) {
+		props["duration_seconds"] = math.Round(seconds*1000) / 1000
+	}
+}
+
+// extractWAV reads the fmt and data chunk headers. The data chunk itself may
+// be truncated since only its declared size is needed.
+func extractWAV(data []byte, props Properties) {
+	var byteRate uint32
+	for pos := 12; pos+8 <= len(data); {
+		id := string(data[pos : pos+4])
+		n := binary.LittleEndian.Uint32(data[pos+4:])
+		body := data[pos+8:]
+
+		switch id {
+		case "fmt ":
+			if len(body) < 16 {
+				return
+			}
+			props["channels"] = int(binary.LittleEndian.Uint16(body[2:]))
+			props["sample_rate"] = int(binary.LittleEndian.Uint32(body[4:]))
+			byteRate = binary.LittleEndian.Uint32(body[8:])
+			props["bits_per_sample"] = int(binary.LittleEndian.Uint16(body[14:]))
+		case "data":
+			if byteRate > 0 {
+				setDuration(props, float64(n)/float64(byteRate))
+			}
+			return
+		}
+		pos += 8 + int(n) + int(n%2)
+	}
+}
+
+// extractFLAC reads the mandatory STREAMINFO metadata block.
+func extractFLAC(data []byte, props Properties) {
+	if len(data) < 8+34 || data[4]&0x7F != 0 {
+		return
+	}
+	info := data[8:]
+
+	packed := binary.BigEndian.Uint64(info[10:18])
+	sampleRate := packed >> 44
+	channels := (packed>>41)&0x7 + 1
+	bits := (packed>>36)&0x1F + 1
+	samples := packed & 0xFFFFFFFFF
+
+	props["sample_rate"] = int(sampleRate)
+	props["channels"] = int(channels)
+	props["bits_per_sample"] = int(bits)
+	if sampleRate > 0 {
+		setDuration(props, float64(samples)/float64(sampleRate))
+	}
+}
+
+var (
+	mp3BitratesV1 = [16]int{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0}
+	mp3BitratesV2 = [16]int{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0}
+	mp3Rates      = [4]int{44100, 48000, 32000, 0}
+)
+
+// extractMP3 reads the first MPEG audio layer III frame. The duration comes
+// from a Xing/Info or VBRI header when present, otherwise it is estimated
+// from the frame bitrate and the file size, which is exact for CBR files.
+func extractMP3(data []byte, size int64, props Properties) {
+	start := 0
+	if len(data) >= 10 && string(data[:3]) == "ID3" {
+		tagSize := int(data[6])<<21 | int(data[7])<<14 | int(data[8])<<7 | int(data[9])
+		start = 10 + tagSize
+		if data[5]&0x10 != 0 {
+			start += 10
+		}
+	}
+
+	for pos := start; pos+4 <= len(data); pos++ {
+		if data[pos] != 0xFF || data[pos+1]&0xE0 != 0xE0 {
+			continue
+		}
+
+		version := (data[pos+1] >> 3) & 0x3 // 3 = MPEG1, 2 = MPEG2, 0 = MPEG2.5
+		layer := (data[pos+1] >> 1) & 0x3   // 1 = layer III
+		bitrateIdx := data[pos+2] >> 4
+		rateIdx := (data[pos+2] >> 2) & 0x3
+		mono := data[pos+3]>>6 == 3
+		if version == 1 || layer != 1 || bitrateIdx == 0 || bitrateIdx == 15 || rateIdx == 3 {
+			continue
+		}
+
+		bitrate := mp3BitratesV1[bitrateIdx]
+		sampleRate := mp3Rates[rateIdx]
+		samplesPerFrame := 1152
+		sideInfo := 32
+		if mono {
+			sideInfo = 17
+		}
+		if version != 3 {
+			bitrate = mp3BitratesV2[bitrateIdx]
+			sampleRate /= 2
+			if version == 0 {
+				sampleRate /= 2
+			}
+			samplesPerFrame = 576
+			sideInfo = 17
+			if mono {
+				sideInfo = 9
+			}
+		}
+
+		props["sample_rate"] = sampleRate
+		props["channels"] = 2
+		if mono {
+			props["channels"] = 1
+		}
+
+		if frames := mp3VBRFrames(data[pos:], sideInfo); frames > 0 {
+			setDuration(props, float64(frames)*float64(samplesPerFrame)/float64(sampleRate))
+			return
+		}
+
+		props["bitrate_kbps"] = bitrate
+		setDuration(props, float64(size-int64(pos))*8/float64(bitrate*1000))
+		return
+	}
+}
+
+// mp3VBRFrames returns the frame count from a Xing/Info or VBRI header in
+// the first frame, or 0 if there is none.
+func mp3VBRFrames(frame []byte, sideInfo int) uint32 {
+	xing := 4 + sideInfo
+	if len(frame) >= xing+12 {
+		tag := string(frame[xing : xing+4])
+		if (tag == "Xing" || tag == "Info") && binary.BigEndian.Uint32(frame[xing+4:])&0x1 != 0 {
+			return binary.BigEndian.Uint32(frame[xing+8:])
+		}
+	}
+
+	const vbri = 4 + 32
+	if len(frame) >= vbri+18 && string(frame[vbri:vbri+4]) == "VBRI" {
+		return binary.BigEndian.Uint32(frame[vbri+14:])
+	}
+	return 0
+}
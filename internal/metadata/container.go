@@ -0,0 +1,121 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+var (
+	exifHeader = []byte("Exif\x00\x00")
+	xmpHeader  = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	// xmpExtHeader starts the APP1 segments of extended XMP, which holds
+	// the XMP that does not fit the main packet of a JPEG.
+	xmpExtHeader = []byte("http://ns.adobe.com/xmp/extension/\x00")
+	pngMagic     = []byte("\x89PNG\r\n\x1a\n")
+)
+
+var errMalformed = errors.New("malformed container")
+
+func isJPEG(data []byte) bool {
+	return len(data) > 3 && data[0] == 0xFF && data[1] == 0xD8
+}
+
+func isPNG(data []byte) bool {
+	return bytes.HasPrefix(data, pngMagic)
+}
+
+func isWebP(data []byte) bool {
+	return len(data) > 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WEBP"
+}
+
+// segment is one marker segment of a JPEG, chunk of a PNG or chunk of a RIFF
+// file. data[start:end] is the whole segment including its header. JPEG
+// segments are identified by marker, PNG and RIFF chunks by kind.
+type segment struct {
+	marker  byte
+	kind    string
+	start   int
+	end     int
+	payload []byte
+}
+
+// jpegSegments returns the marker segments preceding the image scan and the
+// offset at which the scan (SOS marker) starts.
+func jpegSegments(data []byte) ([]segment, int, error) {
+	var segs []segment
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return nil, 0, errMalformed
+		}
+		marker := data[pos+1]
+		if marker == 0xFF {
+			pos++
+			continue
+		}
+		if marker == 0xDA {
+			return segs, pos, nil
+		}
+		n := int(binary.BigEndian.Uint16(data[pos+2:]))
+		end := pos + 2 + n
+		if n < 2 || end > len(data) {
+			return nil, 0, errMalformed
+		}
+		segs = append(segs, segment{
+			marker:  marker,
+			start:   pos,
+			end:     end,
+			payload: data[pos+4 : end],
+		})
+		pos = end
+	}
+	return segs, len(data), nil
+}
+
+// pngChunks returns the chunks of a PNG file.
+func pngChunks(data []byte) ([]segment, error) {
+	var segs []segment
+	pos := len(pngMagic)
+	for pos+12 <= len(data) {
+		n := int(binary.BigEndian.Uint32(data[pos:]))
+		end := pos + 12 + n
+		if n < 0 || end > len(data) {
+			return nil, errMalformed
+		}
+		segs = append(segs, segment{
+			kind:    string(data[pos+4 : pos+8]),
+			start:   pos,
+			end:     end,
+			payload: data[pos+8 : pos+8+n],
+		})
+		pos = end
+	}
+	return segs, nil
+}
+
+// riffChunks returns the top-level chunks of a RIFF file (WebP, WAV).
+func riffChunks(data []byte) ([]segment, error) {
+	var segs []segment
+	pos := 12
+	for pos+8 <= len(data) {
+		n := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		end := pos + 8 + n + n%2
+		if n < 0 || pos+8+n > len(data) {
+			return segs, errMalformed
+		}
+		segs = append(segs, segment{
+			kind:    string(data[pos : pos+4]),
+			start:   pos,
+			end:     min(end, len(data)),
+			payload: data[pos+8 : pos+8+n],
+		})
+		pos = end
+	}
+	return segs, nil
+}
+
+// isXMPText reports whether a PNG text chunk carries an XMP packet.
+func isXMPText(payload []byte) bool {
+	return bytes.HasPrefix(payload, []byte("XML:com.adobe.xmp\x00"))
+}
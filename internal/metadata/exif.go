@@ -0,0 +1,232 @@
+package metadata
+
+import (
+	"encoding/binary"
+	"strings"
+)
+
+// TIFF tags read from IFD0, the Exif sub-IFD and the GPS sub-IFD.
+const (
+	tagMake             = 0x010F
+	tagModel            = 0x0110
+	tagOrientation      = 0x0112
+	tagSoftware         = 0x0131
+	tagDateTime         = 0x0132
+	tagExifIFD          = 0x8769
+	tagGPSIFD           = 0x8825
+	tagExposureTime     = 0x829A
+	tagFNumber          = 0x829D
+	tagISO              = 0x8827
+	tagDateTimeOriginal = 0x9003
+	tagFocalLength      = 0x920A
+	tagBodySerial       = 0xA431
+	tagLensModel        = 0xA434
+
+	tagGPSLatitudeRef  = 0x0001
+	tagGPSLatitude     = 0x0002
+	tagGPSLongitudeRef = 0x0003
+	tagGPSLongitude    = 0x0004
+	tagGPSAltitude     = 0x0006
+)
+
+var exifNames = map[uint16]string{
+	tagMake:             "make",
+	tagModel:            "model",
+	tagOrientation:      "orientation",
+	tagSoftware:         "software",
+	tagDateTime:         "date_time",
+	tagExposureTime:     "exposure_time",
+	tagFNumber:          "f_number",
+	tagISO:              "iso",
+	tagDateTimeOriginal: "date_time_original",
+	tagFocalLength:      "focal_length",
+	tagBodySerial:       "body_serial_number",
+	tagLensModel:        "lens_model",
+}
+
+// TIFF field types and their sizes in bytes.
+var typeSizes = map[uint16]int{
+	1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 7: 1, 9: 4, 10: 8,
+}
+
+type tiffReader struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+type ifdEntry struct {
+	tag   uint16
+	typ   uint16
+	count int
+	value []byte
+}
+
+// parseEXIF decodes the well-known camera tags and GPS position from a TIFF
+// structured EXIF block. Malformed blocks yield whatever was read so far.
+func parseEXIF(tiff []byte) (exif, gps map[string]any) {
+	if len(tiff) < 8 {
+		return nil, nil
+	}
+
+	r := &tiffReader{data: tiff}
+	switch string(tiff[:2]) {
+	case "II":
+		r.order = binary.LittleEndian
+	case "MM":
+		r.order = binary.BigEndian
+	default:
+		return nil, nil
+	}
+
+	exif = map[string]any{}
+	gps = map[string]any{}
+
+	ifd0 := r.readIFD(int(r.order.Uint32(tiff[4:])))
+	r.collect(ifd0, exif)
+
+	for _, e := range ifd0 {
+		switch e.tag {
+		case tagExifIFD:
+			r.collect(r.readIFD(int(r.uint(e))), exif)
+		case tagGPSIFD:
+			r.collectGPS(r.readIFD(int(r.uint(e))), gps)
+		}
+	}
+
+	return exif, gps
+}
+
+func (r *tiffReader) readIFD(offset int) []ifdEntry {
+	if offset <= 0 || offset+2 > len(r.data) {
+		return nil
+	}
+
+	n := int(r.order.Uint16(r.data[offset:]))
+	entries := make([]ifdEntry, 0, n)
+	for i := range n {
+		pos := offset + 2 + i*12
+		if pos+12 > len(r.data) {
+			break
+		}
+
+		e := ifdEntry{
+			tag:   r.order.Uint16(r.data[pos:]),
+			typ:   r.order.Uint16(r.data[pos+2:]),
+			count: int(r.order.Uint32(r.data[pos+4:])),
+		}
+		size, ok := typeSizes[e.typ]
+		if !ok || e.count <= 0 || e.count > len(r.data) {
+			continue
+		}
+
+		total := size * e.count
+		if total <= 4 {
+			e.value = r.data[pos+8 : pos+8+total]
+		} else {
+			off := int(r.order.Uint32(r.data[pos+8:]))
+			if off < 0 || off+total > len(r.data) {
+				continue
+			}
+			e.value = r.data[off : off+total]
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func (r *tiffReader) collect(entries []ifdEntry, out map[string]any) {
+	for _, e := range entries {
+		name, ok := exifNames[e.tag]
+		if !ok {
+			continue
+		}
+		switch e.typ {
+		case 2:
+			if s := strings.TrimSpace(strings.TrimRight(string(e.value), "\x00")); s != "" {
+				out[name] = s
+			}
+		case 3, 4:
+			out[name] = r.uint(e)
+		case 5:
+			if v, ok := r.rational(e.value); ok {
+				out[name] = v
+			}
+		}
+	}
+}
+
+func (r *tiffReader) collectGPS(entries []ifdEntry, out map[string]any) {
+	var latRef, lonRef string
+	var lat, lon []float64
+	for _, e := range entries {
+		switch e.tag {
+		case tagGPSLatitudeRef:
+			latRef = strings.TrimRight(string(e.value), "\x00")
+		case tagGPSLongitudeRef:
+			lonRef = strings.TrimRight(string(e.value), "\x00")
+		case tagGPSLatitude:
+			lat = r.rationals(e)
+		case tagGPSLongitude:
+			lon = r.rationals(e)
+		case tagGPSAltitude:
+			if v, ok := r.rational(e.value); ok {
+				out["altitude"] = v
+			}
+		}
+	}
+
+	if v, ok := degrees(lat, latRef == "S"); ok {
+		out["latitude"] = v
+	}
+	if v, ok := degrees(lon, lonRef == "W"); ok {
+		out["longitude"] = v
+	}
+}
+
+func (r *tiffReader) uint(e ifdEntry) uint32 {
+	switch e.typ {
+	case 3:
+		return uint32(r.order.Uint16(e.value))
+	case 4:
+		return r.order.Uint32(e.value)
+	}
+	return 0
+}
+
+func (r *tiffReader) rational(b []byte) (float64, bool) {
+	if len(b) < 8 {
+		return 0, false
+	}
+	num, den := r.order.Uint32(b), r.order.Uint32(b[4:])
+	if den == 0 {
+		return 0, false
+	}
+	return float64(num) / float64(den), true
+}
+
+func (r *tiffReader) rationals(e ifdEntry) []float64 {
+	if e.typ != 5 {
+		return nil
+	}
+	vals := make([]float64, 0, e.count)
+	for i := 0; i+8 <= len(e.value); i += 8 {
+		v, ok := r.rational(e.value[i:])
+		if !ok {
+			return nil
+		}
+		vals = append(vals, v)
+	}
+	return vals
+}
+
+// degrees converts a degrees/minutes/seconds triple to decimal degrees.
+func degrees(dms []float64, negative bool) (float64, bool) {
+	if len(dms) != 3 {
+		return 0, false
+	}
+	v := dms[0] + dms[1]/60 + dms[2]/3600
+	if negative {
+		v = -v
+	}
+	return v, true
+}
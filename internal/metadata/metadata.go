@@ -0,0 +1,99 @@
+package metadata
+
+import (
+	"bytes"
+	"image"
+	"strings"
+
+	// Register image decoders so DecodeConfig can read dimensions.
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/webp"
+)
+
+// Properties holds technical metadata extracted from a file, keyed by
+// property name. Values are JSON-friendly (strings, numbers, nested maps).
+type Properties map[string]any
+
+// Extract returns technical metadata for images (dimensions, EXIF), PDFs
+// (page count, document info) and audio (duration). data may be a prefix of
+// the file; size is the full file size in bytes. It returns nil when nothing
+// could be extracted.
+//
+// The GPS position of a photo and the serial number of the camera tell
+// where it was taken and by whom, so they are only included when private
+// is set.
+func Extract(data []byte, size int64, mimeType string, private bool) Properties {
+	props := Properties{}
+
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		extractImage(data, props, private)
+	case mimeType == "application/pdf":
+		extractPDF(data, props)
+	case strings.HasPrefix(mimeType, "audio/"):
+		extractAudio(data, size, props)
+	}
+
+	if len(props) == 0 {
+		return nil
+	}
+	return props
+}
+
+func extractImage(data []byte, props Properties, private bool) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err == nil {
+		props["format"] = format
+		props["width"] = cfg.Width
+		props["height"] = cfg.Height
+	}
+
+	tiff := findEXIF(data)
+	if tiff == nil {
+		return
+	}
+
+	exif, gps := parseEXIF(tiff)
+	if !private {
+		delete(exif, exifNames[tagBodySerial])
+		gps = nil
+	}
+	if len(exif) > 0 {
+		props["exif"] = exif
+	}
+	if len(gps) > 0 {
+		props["gps"] = gps
+	}
+}
+
+// findEXIF returns the TIFF-structured EXIF block embedded in a JPEG, PNG or
+// WebP image, or nil if there is none.
+func findEXIF(data []byte) []byte {
+	switch {
+	case isJPEG(data):
+		segs, _, _ := jpegSegments(data)
+		for _, seg := range segs {
+			if seg.marker == 0xE1 && bytes.HasPrefix(seg.payload, exifHeader) {
+				return seg.payload[len(exifHeader):]
+			}
+		}
+	case isPNG(data):
+		segs, _ := pngChunks(data)
+		for _, seg := range segs {
+			if seg.kind == "eXIf" {
+				return seg.payload
+			}
+		}
+	case isWebP(data):
+		segs, _ := riffChunks(data)
+		for _, seg := range segs {
+			if seg.kind == "EXIF" {
+				return bytes.TrimPrefix(seg.payload, exifHeader)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package metadata
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"regexp"
+	"strconv"
+	"unicode/utf16"
+)
+
+// maxInflatedPDF bounds the total size of decompressed PDF streams scanned
+// for page objects.
+const maxInflatedPDF = 32 << 20
+
+var (
+	pdfVersionRe = regexp.MustCompile(`^%PDF-(\d+\.\d+)`)
+	pdfPagesRe   = regexp.MustCompile(`/Type\s*/Pages\b[^>]*?/Count\s+(\d+)|/Count\s+(\d+)[^>]*?/Type\s*/Pages\b`)
+	pdfPageRe    = regexp.MustCompile(`/Type\s*/Page\b`)
+	pdfStreamRe  = regexp.MustCompile(`(?s)/FlateDecode.*?>>\s*stream\r?\n`)
+
+	pdfInfoKeys = map[string]string{
+		"Title":        "title",
+		"Author":       "author",
+		"Subject":      "subject",
+		"Creator":      "creator",
+		"Producer":     "producer",
+		"CreationDate": "creation_date",
+		"ModDate":      "modification_date",
+	}
+)
+
+func extractPDF(data []byte, props Properties) {
+	if m := pdfVersionRe.FindSubmatch(data); m != nil {
+		props["pdf_version"] = string(m[1])
+	}
+
+	bodies := append([][]byte{data}, inflateStreams(data)...)
+
+	pages := 0
+	for _, body := range bodies {
+		for _, m := range pdfPagesRe.FindAllSubmatch(body, -1) {
+			count := m[1]
+			if count == nil {
+				count = m[2]
+			}
+			if n, err := strconv.Atoi(string(count)); err == nil && n > pages {
+				pages = n
+			}
+		}
+	}
+	if pages == 0 {
+		for _, body := range bodies {
+			pages += len(pdfPageRe.FindAll(body, -1))
+		}
+	}
+	if pages > 0 {
+		props["pages"] = pages
+	}
+
+	for _, body := range bodies {
+		for key, name := range pdfInfoKeys {
+			if _, ok := props[name]; ok {
+				continue
+			}
+			if v, ok := pdfInfoString(body, key); ok && v != "" {
+				props[name] = v
+			}
+		}
+	}
+}
+
+// inflateStreams returns the decompressed content of every FlateDecode
+// stream in a PDF, up to an overall size limit.
+func inflateStreams(data []byte) [][]byte {
+	var out [][]byte
+	total := 0
+	for _, loc := range pdfStreamRe.FindAllIndex(data, -1) {
+		if total >= maxInflatedPDF {
+			break
+		}
+		start := loc[1]
+		end := bytes.Index(data[start:], []byte("endstream"))
+		if end < 0 {
+			continue
+		}
+
+		zr, err := zlib.NewReader(bytes.NewReader(data[start : start+end]))
+		if err != nil {
+			continue
+		}
+		body, _ := io.ReadAll(io.LimitReader(zr, int64(maxInflatedPDF-total)))
+		zr.Close()
+		if len(body) > 0 {
+			out = append(out, body)
+			total += len(body)
+		}
+	}
+	return out
+}
+
+// pdfInfoString finds "/Key (literal)" or "/Key <hex>" and decodes the value.
+func pdfInfoString(body []byte, key string) (string, bool) {
+	marker := []byte("/" + key)
+	for i := 0; ; {
+		j := bytes.Index(body[i:], marker)
+		if j < 0 {
+			return "", false
+		}
+		pos := i + j + len(marker)
+		i = pos
+		for pos < len(body) && isPDFSpace(body[pos]) {
+			pos++
+		}
+		if pos >= len(body) {
+			return "", false
+		}
+
+		switch body[pos] {
+		case '(':
+			if raw, ok := pdfLiteral(body[pos+1:]); ok {
+				return decodePDFText(raw), true
+			}
+		case '<':
+			end := bytes.IndexByte(body[pos+1:], '>')
+			if end >= 0 && (pos+1 >= len(body) || body[pos+1] != '<') {
+				return decodePDFText(pdfHex(body[pos+1 : pos+1+end])), true
+			}
+		}
+	}
+}
+
+// pdfLiteral decodes a literal string body up to its closing parenthesis.
+func pdfLiteral(b []byte) ([]byte, bool) {
+	var out []byte
+	depth := 0
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		switch c {
+		case '\\':
+			i++
+			if i >= len(b) {
+				return nil, false
+			}
+			switch b[i] {
+			case 'n':
+				out = append(out, '\n')
+			case 'r':
+				out = append(out, '\r')
+			case 't':
+				out = append(out, '\t')
+			case 'b':
+				out = append(out, '\b')
+			case 'f':
+				out = append(out, '\f')
+			case '0', '1', '2', '3', '4', '5', '6', '7':
+				n, j := 0, i
+				for ; j < len(b) && j < i+3 && b[j] >= '0' && b[j] <= '7'; j++ {
+					n = n*8 + int(b[j]-'0')
+				}
+				out = append(out, byte(n))
+				i = j - 1
+			case '\r', '\n':
+			default:
+				out = append(out, b[i])
+			}
+		case '(':
+			depth++
+			out = append(out, c)
+		case ')':
+			if depth == 0 {
+				return out, true
+			}
+			depth--
+			out = append(out, c)
+		default:
+			out = append(out, c)
+		}
+	}
+	return nil, false
+}
+
+func pdfHex(b []byte) []byte {
+	var out []byte
+	var hi byte
+	half := false
+	for _, c := range b {
+		v, ok := hexVal(c)
+		if !ok {
+			continue
+		}
+		if half {
+			out = append(out, hi<<4|v)
+		} else {
+			hi = v
+		}
+		half = !half
+	}
+	if half {
+		out = append(out, hi<<4)
+	}
+	return out
+}
+
+func hexVal(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+// decodePDFText decodes UTF-16BE strings (with BOM) and treats everything
+// else as PDFDocEncoding, which is close enough to Latin-1 for metadata.
+func decodePDFText(b []byte) string {
+	if len(b) >= 2 && b[0] == 0xFE && b[1] == 0xFF {
+		u := make([]uint16, 0, len(b)/2)
+		for i := 2; i+1 < len(b); i += 2 {
+			u = append(u, uint16(b[i])<<8|uint16(b[i+1]))
+		}
+		return string(utf16.Decode(u))
+	}
+
+	r := make([]rune, len(b))
+	for i, c := range b {
+		r[i] = rune(c)
+	}
+	return string(r)
+}
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' || c == 0
+}
@@ -0,0 +1,138 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// ErrUnsupportedFormat is returned by Strip for formats it cannot rewrite.
+var ErrUnsupportedFormat = errors.New("unsupported format for metadata stripping")
+
+// CanStrip reports whether Strip supports the MIME type.
+func CanStrip(mimeType string) bool {
+	switch mimeType {
+	case "image/jpeg", "image/png", "image/webp":
+		return true
+	}
+	return false
+}
+
+// Strip removes EXIF and XMP metadata, which carry GPS coordinates and device
+// serial numbers, from a JPEG, PNG or WebP image. Pixel data is copied
+// unchanged. For JPEG the EXIF orientation is preserved so photos are still
+// displayed upright.
+func Strip(data []byte) ([]byte, error) {
+	switch {
+	case isJPEG(data):
+		return stripJPEG(data)
+	case isPNG(data):
+		return stripPNG(data)
+	case isWebP(data):
+		return stripWebP(data)
+	}
+	return nil, ErrUnsupportedFormat
+}
+
+func stripJPEG(data []byte) ([]byte, error) {
+	segs, scan, err := jpegSegments(data)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:2]...)
+
+	var orientation uint32
+	for _, seg := range segs {
+		if seg.marker == 0xE1 {
+			switch {
+			case bytes.HasPrefix(seg.payload, exifHeader):
+				if exif, _ := parseEXIF(seg.payload[len(exifHeader):]); exif != nil {
+					orientation, _ = exif["orientation"].(uint32)
+				}
+				if orientation > 1 {
+					out = append(out, orientationSegment(uint16(orientation))...)
+				}
+				continue
+			case bytes.HasPrefix(seg.payload, xmpHeader), bytes.HasPrefix(seg.payload, xmpExtHeader):
+				continue
+			}
+		}
+		out = append(out, data[seg.start:seg.end]...)
+	}
+
+	return append(out, data[scan:]...), nil
+}
+
+// orientationSegment builds a minimal APP1 EXIF segment holding only the
+// orientation tag.
+func orientationSegment(orientation uint16) []byte {
+	tiff := []byte{
+		'M', 'M', 0x00, 0x2A, 0x00, 0x00, 0x00, 0x08, // header, IFD0 at offset 8
+		0x00, 0x01, // one entry
+		0x01, 0x12, 0x00, 0x03, 0x00, 0x00, 0x00, 0x01, // orientation, SHORT, count 1
+		byte(orientation >> 8), byte(orientation), 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, // no next IFD
+	}
+
+	payload := append(append([]byte{}, exifHeader...), tiff...)
+	seg := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(len(payload)+2))
+	return append(seg, payload...)
+}
+
+func stripPNG(data []byte) ([]byte, error) {
+	segs, err := pngChunks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, pngMagic...)
+	for _, seg := range segs {
+		switch seg.kind {
+		case "eXIf":
+			continue
+		case "iTXt", "tEXt", "zTXt":
+			if isXMPText(seg.payload) {
+				continue
+			}
+		}
+		out = append(out, data[seg.start:seg.end]...)
+	}
+	return out, nil
+}
+
+// VP8X feature flags for embedded EXIF and XMP chunks.
+const (
+	vp8xEXIF = 0x08
+	vp8xXMP  = 0x04
+)
+
+func stripWebP(data []byte) ([]byte, error) {
+	segs, err := riffChunks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 12, len(data))
+	copy(out, data[:12])
+	for _, seg := range segs {
+		switch seg.kind {
+		case "EXIF", "XMP ":
+			continue
+		case "VP8X":
+			chunk := append([]byte{}, data[seg.start:seg.end]...)
+			if len(chunk) > 8 {
+				chunk[8] &^= vp8xEXIF | vp8xXMP
+			}
+			out = append(out, chunk...)
+			continue
+		}
+		out = append(out, data[seg.start:seg.end]...)
+	}
+
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out, nil
+}
@@ -0,0 +1,113 @@
+package metadata
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxText caps the text returned by ExtractText, in bytes.
+const maxText = 256 << 10
+
+var (
+	// pdfTextOpRe matches the text-showing operators of a content stream:
+	// [(...) -250 (...)] TJ and (...) Tj, ' or ".
+	pdfTextOpRe = regexp.MustCompile(`\[((?:\\.|[^\]\\])*)\]\s*TJ|\(((?:\\.|[^\\)])*)\)\s*(?:Tj|'|")`)
+	// pdfArrayItemRe matches the literal strings and kerning numbers of a TJ array.
+	pdfArrayItemRe = regexp.MustCompile(`\(((?:\\.|[^\\)])*)\)|(-?\d+(?:\.\d+)?)`)
+)
+
+// pdfWordGap is the TJ kerning (in thousandths of a text unit) beyond which
+// a gap between strings is taken as a space.
+const pdfWordGap = -200
+
+// IsText reports whether files of the MIME type hold plain text.
+func IsText(mimeType string) bool {
+	mimeType, _, _ = strings.Cut(mimeType, ";")
+	mimeType = strings.TrimSpace(mimeType)
+
+	switch {
+	case strings.HasPrefix(mimeType, "text/"):
+		return true
+	case strings.HasSuffix(mimeType, "+json"), strings.HasSuffix(mimeType, "+xml"):
+		return true
+	}
+
+	switch mimeType {
+	case "application/json", "application/xml", "application/javascript",
+		"application/x-yaml", "application/yaml", "application/x-sh", "application/sql":
+		return true
+	}
+	return false
+}
+
+// ExtractText returns the readable text of plain-text files and of PDFs, for
+// indexing. PDF text is only found in content streams that use simple
+// fonts; text drawn with CID fonts is skipped. The result is valid UTF-8
+// without NUL bytes and is cut at 256 KiB. It returns "" when no text could
+// be extracted.
+func ExtractText(data []byte, mimeType string) string {
+	var text string
+	switch {
+	case IsText(mimeType):
+		text = string(data)
+	case mimeType == "application/pdf":
+		text = extractPDFText(data)
+	default:
+		return ""
+	}
+
+	if len(text) > maxText {
+		text = text[:maxText]
+	}
+	text = strings.ToValidUTF8(text, "")
+	text = strings.ReplaceAll(text, "\x00", "")
+	return strings.TrimSpace(text)
+}
+
+func extractPDFText(data []byte) string {
+	// Content streams are nearly always compressed; only scan the raw file
+	// when none are, so text is not picked up twice.
+	bodies := inflateStreams(data)
+	if len(bodies) == 0 {
+		bodies = [][]byte{data}
+	}
+
+	var sb strings.Builder
+	for _, body := range bodies {
+		for _, m := range pdfTextOpRe.FindAllSubmatch(body, -1) {
+			if sb.Len() >= maxText {
+				return sb.String()
+			}
+			if m[2] != nil {
+				sb.WriteString(pdfTextString(m[2]))
+			} else {
+				writePDFArray(&sb, m[1])
+			}
+			sb.WriteByte(' ')
+		}
+	}
+	return sb.String()
+}
+
+// writePDFArray writes the strings of a TJ array, turning wide kerning gaps
+// into spaces.
+func writePDFArray(sb *strings.Builder, array []byte) {
+	for _, item := range pdfArrayItemRe.FindAllSubmatch(array, -1) {
+		if item[1] != nil {
+			sb.WriteString(pdfTextString(item[1]))
+			continue
+		}
+		if gap, err := strconv.ParseFloat(string(item[2]), 64); err == nil && gap <= pdfWordGap {
+			sb.WriteByte(' ')
+		}
+	}
+}
+
+func pdfTextString(raw []byte) string {
+	lit, ok := pdfLiteral(append(raw[:len(raw):len(raw)], ')'))
+	if !ok {
+		return ""
+	}
+	return decodePDFText(lit)
+}
@@ -1,7 +1,112 @@
 package analysis
 
-import "context"
+import (
+	"context"
+	"encoding/json"
+	"io"
+)
 
+// Provider runs analyses of file content with a language model. Model names
+// the model requests are sent to; the model reported in a Result may be a
+// more specific snapshot of it.
 type Provider interface {
-	FileResume(ctx context.Context, input string) (string, error)
+	Analyze(ctx context.Context, req Request) (*Result, error)
+	Model() string
+}
+
+// Request is one analysis of a file's content.
+type Request struct {
+	Type Type
+	// Instructions tell the model what to produce: a rendered prompt
+	// template, see DefaultPrompt and RenderPrompt.
+	Instructions string
+	Input        string
+	// Stream, when non-nil, is called with each piece of the output as it
+	// is generated: the text of a summary, the JSON of structured types.
+	// An error from it aborts the analysis.
+	Stream func(delta string) error
+}
+
+// Result is the output of an analysis. Output is a JSON string for the
+// summary and a JSON object for structured types.
+type Result struct {
+	Output json.RawMessage
+	Usage
+}
+
+// Usage is what the provider billed for one call: the model that served it
+// and the tokens it read and generated, or the seconds of audio it
+// transcribed.
+type Usage struct {
+	Model        string
+	InputTokens  int
+	OutputTokens int
+	AudioSeconds float64
+}
+
+// Embedder turns texts into embedding vectors for semantic search. Vectors
+// from different models are not comparable, so each is stored with the
+// name returned by EmbeddingModel.
+type Embedder interface {
+	Embed(ctx context.Context, inputs []string) ([][]float32, Usage, error)
+	EmbeddingModel() string
+}
+
+// Answerer answers questions using only the given source passages, citing
+// them by number as [1], [2], ... When stream is non-nil it is called with
+// each piece of the answer as it is generated; an error from it aborts the
+// answer.
+type Answerer interface {
+	Answer(ctx context.Context, question string, sources []string, stream func(delta string) error) (string, Usage, error)
+}
+
+// PIIDetector finds personal data in text with a language model, such as
+// the names of people and postal addresses that patterns cannot match.
+type PIIDetector interface {
+	DetectPII(ctx context.Context, text string) ([]PIIEntity, Usage, error)
+}
+
+// PIIEntity is personal data found by a PIIDetector: its kind, such as
+// "person" or "email", and its text exactly as it appears in the input.
+type PIIEntity struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// ImageAnalyzer runs analyses of images with a vision-capable model, named
+// by VisionModel. The image is sent along with the Request; its Input holds
+// notes on the image, if any.
+type ImageAnalyzer interface {
+	AnalyzeImage(ctx context.Context, req Request, img Image) (*Result, error)
+	VisionModel() string
+}
+
+// Image is an encoded image, such as a JPEG.
+type Image struct {
+	MimeType string
+	Data     []byte
+}
+
+// Transcriber turns the speech in audio and video recordings into text with
+// timestamps. TranscriptionModel names the model transcripts are made with.
+type Transcriber interface {
+	Transcribe(ctx context.Context, media io.Reader, filename, mimeType string) (*Transcript, Usage, error)
+	TranscriptionModel() string
+}
+
+// Transcript is the text of a recording, split into segments that start
+// and end at the given seconds of it.
+type Transcript struct {
+	Model    string    `json:"model"`
+	Language string    `json:"language,omitempty"`
+	Duration float64   `json:"duration"`
+	Text     string    `json:"text"`
+	Segments []Segment `json:"segments"`
+}
+
+// Segment is a stretch of a transcript.
+type Segment struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	Text  string  `json:"text"`
 }
@@ -2,21 +2,39 @@ package openai
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"io"
+	"strings"
 
 	"github.com/openai/openai-go"
 	"github.com/openai/openai-go/option"
+	"github.com/openai/openai-go/shared"
 
 	"github.com/mamed-gasimov/file-service/internal/modules/analysis"
 )
 
 type Provider struct {
-	client openai.Client
+	client             openai.Client
+	embeddingModel     string
+	transcriptionModel string
+	visionModel        string
 }
 
-var _ analysis.Provider = (*Provider)(nil)
+var (
+	_ analysis.Provider      = (*Provider)(nil)
+	_ analysis.Embedder      = (*Provider)(nil)
+	_ analysis.Answerer      = (*Provider)(nil)
+	_ analysis.PIIDetector   = (*Provider)(nil)
+	_ analysis.Transcriber   = (*Provider)(nil)
+	_ analysis.ImageAnalyzer = (*Provider)(nil)
+)
 
-func NewProvider(apiKey string, baseURL string) *Provider {
+// NewProvider creates an OpenAI provider. embeddingModel defaults to
+// text-embedding-3-small, transcriptionModel to whisper-1 and visionModel
+// to gpt-4o-mini when empty.
+func NewProvider(apiKey string, baseURL string, embeddingModel string, transcriptionModel string, visionModel string) *Provider {
 	opts := []option.RequestOption{
 		option.WithAPIKey(apiKey),
 	}
@@ -26,24 +44,275 @@ func NewProvider(apiKey string, baseURL string) *Provider {
 
 	client := openai.NewClient(opts...)
 
-	return &Provider{client: client}
+	if embeddingModel == "" {
+		embeddingModel = openai.EmbeddingModelTextEmbedding3Small
+	}
+
+	if transcriptionModel == "" {
+		transcriptionModel = openai.AudioModelWhisper1
+	}
+
+	if visionModel == "" {
+		visionModel = openai.ChatModelGPT4oMini
+	}
+
+	return &Provider{
+		client:             client,
+		embeddingModel:     embeddingModel,
+		transcriptionModel: transcriptionModel,
+		visionModel:        visionModel,
+	}
+}
+
+func (p *Provider) Model() string {
+	return openai.ChatModelGPT4oMini
+}
+
+func (p *Provider) Analyze(ctx context.Context, req analysis.Request) (*analysis.Result, error) {
+	return p.analyze(ctx, req, openai.ChatCompletionNewParams{
+		Model: p.Model(),
+		Messages: []openai.ChatCompletionMessageParamUnion{
+			openai.SystemMessage(req.Instructions),
+			openai.UserMessage(req.Input),
+		},
+	})
+}
+
+func (p *Provider) VisionModel() string {
+	return p.visionModel
 }
 
-func (p *Provider) FileResume(ctx context.Context, input string) (string, error) {
-	resp, err := p.client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
-		Model: openai.ChatModelGPT4oMini,
+// AnalyzeImage runs an analysis of an image with the vision model. The
+// image is sent inline, as a base64 data URL, followed by the notes in
+// req.Input.
+func (p *Provider) AnalyzeImage(ctx context.Context, req analysis.Request, img analysis.Image) (*analysis.Result, error) {
+	parts := []openai.ChatCompletionContentPartUnionParam{
+		openai.ImageContentPart(openai.ChatCompletionContentPartImageImageURLParam{
+			URL: "data:" + img.MimeType + ";base64," + base64.StdEncoding.EncodeToString(img.Data),
+		}),
+	}
+	if req.Input != "" {
+		parts = append(parts, openai.TextContentPart(req.Input))
+	}
+
+	return p.analyze(ctx, req, openai.ChatCompletionNewParams{
+		Model: p.visionModel,
 		Messages: []openai.ChatCompletionMessageParamUnion{
-			openai.SystemMessage("You are a helpful assistant. Generate a brief, concise overview (2-3 sentences) of the provided file content. Focus on the purpose and key elements of the file."),
-			openai.UserMessage(input),
+			openai.SystemMessage(req.Instructions),
+			openai.UserMessage(parts),
 		},
 	})
+}
+
+// analyze runs the chat completion of an analysis and decodes its output.
+func (p *Provider) analyze(ctx context.Context, req analysis.Request, params openai.ChatCompletionNewParams) (*analysis.Result, error) {
+	if req.Type.Structured() {
+		params.ResponseFormat = openai.ChatCompletionNewParamsResponseFormatUnion{
+			OfJSONObject: &shared.ResponseFormatJSONObjectParam{},
+		}
+	}
+
+	content, usage, err := p.complete(ctx, params, req.Stream)
 	if err != nil {
-		return "", fmt.Errorf("openai chat completion: %w", err)
+		return nil, err
 	}
 
-	if len(resp.Choices) == 0 {
-		return "", fmt.Errorf("no choices returned from openai")
+	var output json.RawMessage
+	if req.Type.Structured() {
+		if !json.Valid([]byte(content)) {
+			return nil, fmt.Errorf("openai returned invalid JSON for %s analysis", req.Type)
+		}
+		output = json.RawMessage(content)
+	} else if output, err = json.Marshal(content); err != nil {
+		return nil, fmt.Errorf("encode %s analysis: %w", req.Type, err)
 	}
 
-	return resp.Choices[0].Message.Content, nil
+	return &analysis.Result{Output: output, Usage: usage}, nil
+}
+
+func (p *Provider) EmbeddingModel() string {
+	return p.embeddingModel
+}
+
+func (p *Provider) Embed(ctx context.Context, inputs []string) ([][]float32, analysis.Usage, error) {
+	resp, err := p.client.Embeddings.New(ctx, openai.EmbeddingNewParams{
+		Model: p.embeddingModel,
+		Input: openai.EmbeddingNewParamsInputUnion{OfArrayOfStrings: inputs},
+	})
+	if err != nil {
+		return nil, analysis.Usage{}, fmt.Errorf("openai embeddings: %w", err)
+	}
+
+	usage := analysis.Usage{Model: resp.Model, InputTokens: int(resp.Usage.PromptTokens)}
+	if len(resp.Data) != len(inputs) {
+		return nil, usage, fmt.Errorf("openai returned %d embeddings for %d inputs", len(resp.Data), len(inputs))
+	}
+
+	vectors := make([][]float32, len(inputs))
+	for _, d := range resp.Data {
+		if d.Index < 0 || int(d.Index) >= len(vectors) {
+			return nil, usage, fmt.Errorf("openai returned embedding index %d out of range", d.Index)
+		}
+		v := make([]float32, len(d.Embedding))
+		for i, x := range d.Embedding {
+			v[i] = float32(x)
+		}
+		vectors[d.Index] = v
+	}
+
+	return vectors, usage, nil
+}
+
+func (p *Provider) TranscriptionModel() string {
+	return p.transcriptionModel
+}
+
+// Transcribe sends a recording to the audio transcriptions endpoint, asking
+// for the verbose JSON format, which has the segments with their timestamps.
+func (p *Provider) Transcribe(ctx context.Context, media io.Reader, filename, mimeType string) (*analysis.Transcript, analysis.Usage, error) {
+	resp, err := p.client.Audio.Transcriptions.New(ctx, openai.AudioTranscriptionNewParams{
+		File:                   openai.File(media, filename, mimeType),
+		Model:                  openai.AudioModel(p.transcriptionModel),
+		ResponseFormat:         openai.AudioResponseFormatVerboseJSON,
+		TimestampGranularities: []string{"segment"},
+	})
+	if err != nil {
+		return nil, analysis.Usage{}, fmt.Errorf("openai transcription: %w", err)
+	}
+
+	var verbose struct {
+		Language string             `json:"language"`
+		Duration float64            `json:"duration"`
+		Segments []analysis.Segment `json:"segments"`
+	}
+	if err := json.Unmarshal([]byte(resp.RawJSON()), &verbose); err != nil {
+		return nil, analysis.Usage{}, fmt.Errorf("decode openai transcription: %w", err)
+	}
+	usage := analysis.Usage{Model: p.transcriptionModel, AudioSeconds: verbose.Duration}
+
+	t := &analysis.Transcript{
+		Model:    p.transcriptionModel,
+		Language: verbose.Language,
+		Duration: verbose.Duration,
+		Text:     strings.TrimSpace(resp.Text),
+		Segments: verbose.Segments,
+	}
+	for i := range t.Segments {
+		t.Segments[i].Text = strings.TrimSpace(t.Segments[i].Text)
+	}
+	if t.Segments == nil {
+		t.Segments = []analysis.Segment{}
+	}
+
+	return t, usage, nil
+}
+
+const answerInstructions = "You answer questions about a document using only the numbered excerpts of it provided by the user. " +
+	"Cite every excerpt you rely on with its number in square brackets, like [2]. " +
+	"If the excerpts do not contain the answer, say that the document does not say, and do not guess."
+
+func (p *Provider) Answer(ctx context.Context, question string, sources []string, stream func(delta string) error) (string, analysis.Usage, error) {
+	var prompt strings.Builder
+	prompt.WriteString("Excerpts:\n\n")
+	for i, src := range sources {
+		fmt.Fprintf(&prompt, "[%d] %s\n\n", i+1, src)
+	}
+	prompt.WriteString("Question: ")
+	prompt.WriteString(question)
+
+	params := openai.ChatCompletionNewParams{
+		Model: p.Model(),
+		Messages: []openai.ChatCompletionMessageParamUnion{
+			openai.SystemMessage(answerInstructions),
+			openai.UserMessage(prompt.String()),
+		},
+	}
+
+	return p.complete(ctx, params, stream)
+}
+
+const piiInstructions = "You find personal data in the document provided by the user: names of people (person), " +
+	"postal addresses (address), email addresses (email), phone numbers (phone), bank account numbers (iban), " +
+	"payment card numbers (credit_card) and national identity numbers (national_id). " +
+	`Respond with a JSON object {"entities": [{"type": "person", "text": "..."}]} listing each one with its type ` +
+	"and its text exactly as it appears in the document, or an empty list if there is none."
+
+func (p *Provider) DetectPII(ctx context.Context, text string) ([]analysis.PIIEntity, analysis.Usage, error) {
+	params := openai.ChatCompletionNewParams{
+		Model: p.Model(),
+		Messages: []openai.ChatCompletionMessageParamUnion{
+			openai.SystemMessage(piiInstructions),
+			openai.UserMessage(text),
+		},
+		ResponseFormat: openai.ChatCompletionNewParamsResponseFormatUnion{
+			OfJSONObject: &shared.ResponseFormatJSONObjectParam{},
+		},
+	}
+
+	content, usage, err := p.complete(ctx, params, nil)
+	if err != nil {
+		return nil, usage, err
+	}
+
+	var out struct {
+		Entities []analysis.PIIEntity `json:"entities"`
+	}
+	if err := json.Unmarshal([]byte(content), &out); err != nil {
+		return nil, usage, fmt.Errorf("openai returned invalid JSON for PII detection: %w", err)
+	}
+
+	return out.Entities, usage, nil
+}
+
+// complete runs a chat completion and returns the content of its first
+// choice. When stream is non-nil the completion is streamed and stream is
+// called with each piece of the content as it arrives.
+func (p *Provider) complete(ctx context.Context, params openai.ChatCompletionNewParams, stream func(delta string) error) (string, analysis.Usage, error) {
+	if stream == nil {
+		resp, err := p.client.Chat.Completions.New(ctx, params)
+		if err != nil {
+			return "", analysis.Usage{}, fmt.Errorf("openai chat completion: %w", err)
+		}
+		usage := chatUsage(resp.Model, resp.Usage)
+		if len(resp.Choices) == 0 {
+			return "", usage, fmt.Errorf("no choices returned from openai")
+		}
+		return resp.Choices[0].Message.Content, usage, nil
+	}
+
+	// The last chunk of the stream reports the usage of the whole completion.
+	params.StreamOptions = openai.ChatCompletionStreamOptionsParam{IncludeUsage: openai.Bool(true)}
+	s := p.client.Chat.Completions.NewStreaming(ctx, params)
+	defer s.Close()
+
+	var content strings.Builder
+	usage := analysis.Usage{Model: params.Model}
+	for s.Next() {
+		chunk := s.Current()
+		if chunk.Usage.TotalTokens > 0 {
+			usage = chatUsage(chunk.Model, chunk.Usage)
+		}
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+			continue
+		}
+		delta := chunk.Choices[0].Delta.Content
+		content.WriteString(delta)
+		if err := stream(delta); err != nil {
+			return "", usage, err
+		}
+	}
+	if err := s.Err(); err != nil {
+		return "", usage, fmt.Errorf("openai chat completion stream: %w", err)
+	}
+
+	return content.String(), usage, nil
+}
+
+// chatUsage returns the usage a chat completion reports.
+func chatUsage(model string, u openai.CompletionUsage) analysis.Usage {
+	return analysis.Usage{
+		Model:        model,
+		InputTokens:  int(u.PromptTokens),
+		OutputTokens: int(u.CompletionTokens),
+	}
 }
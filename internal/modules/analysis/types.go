@@ -0,0 +1,146 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+)
+
+// Type is a kind of analysis.
+type Type string
+
+const (
+	TypeSummary        Type = "summary"
+	TypeKeywords       Type = "keywords"
+	TypeClassification Type = "classification"
+	TypeSentiment      Type = "sentiment"
+	TypeLanguage       Type = "language"
+	TypeEntities       Type = "entities"
+	// TypeImage describes an image: a caption, the text in it and tags.
+	TypeImage Type = "image"
+)
+
+// Types lists the supported analysis types.
+var Types = []Type{TypeSummary, TypeKeywords, TypeClassification, TypeSentiment, TypeLanguage, TypeEntities, TypeImage}
+
+// ParseType returns the analysis type named s.
+func ParseType(s string) (Type, error) {
+	for _, t := range Types {
+		if string(t) == s {
+			return t, nil
+		}
+	}
+
+	names := make([]string, len(Types))
+	for i, t := range Types {
+		names[i] = string(t)
+	}
+	return "", fmt.Errorf("unknown analysis type %q, expected one of %s", s, strings.Join(names, ", "))
+}
+
+// Structured reports whether the analysis produces a JSON object rather
+// than text.
+func (t Type) Structured() bool {
+	return t != TypeSummary
+}
+
+// Prompt is a built-in prompt template of an analysis type. Version changes
+// whenever the template does, so results can be traced back to it.
+type Prompt struct {
+	Version  string
+	Template string
+}
+
+var prompts = map[Type]Prompt{
+	TypeSummary: {
+		Version: "summary-v2",
+		Template: "You are a helpful assistant. Generate a brief, concise overview (2-3 sentences) of the provided file content. " +
+			"Focus on the purpose and key elements of the file." +
+			"{{with .TargetLanguage}} Write the overview in {{.}}.{{end}}",
+	},
+	TypeKeywords: {
+		Version: "keywords-v2",
+		Template: "Extract the 5 to 15 keywords or key phrases that best describe the provided file content, most important first." +
+			"{{with .TargetLanguage}} Write them in {{.}}.{{end}} " +
+			`Reply with a JSON object of the form {"keywords": ["..."]}.`,
+	},
+	TypeClassification: {
+		Version: "classification-v1",
+		Template: "Classify the provided file content into one of these categories: contract, invoice, receipt, report, " +
+			"correspondence, resume, manual, presentation, source_code, legal, financial, academic, other. " +
+			`Reply with a JSON object of the form {"category": "...", "confidence": 0.0}, confidence being between 0 and 1.`,
+	},
+	TypeSentiment: {
+		Version: "sentiment-v1",
+		Template: "Determine the overall sentiment of the provided file content. " +
+			`Reply with a JSON object of the form {"sentiment": "positive|neutral|negative|mixed", "score": 0.0}, ` +
+			"score being between -1 (most negative) and 1 (most positive).",
+	},
+	TypeLanguage: {
+		Version: "language-v1",
+		Template: "Detect the main language of the provided file content. " +
+			`Reply with a JSON object of the form {"language": "en", "name": "English", "confidence": 0.0}, ` +
+			"language being the ISO 639-1 code and confidence being between 0 and 1.",
+	},
+	TypeEntities: {
+		Version: "entities-v1",
+		Template: "Extract the named entities mentioned in the provided file content: people, organizations, locations, " +
+			"dates and monetary amounts. " +
+			`Reply with a JSON object of the form {"entities": [{"type": "person|organization|location|date|amount", "text": "..."}]}, ` +
+			"listing each entity once.",
+	},
+	TypeImage: {
+		Version: "image-v1",
+		Template: "Describe the provided image. Write a one-sentence caption of what it shows, transcribe all text visible in it " +
+			"exactly as written, line by line, and give 5 to 15 lowercase tags for the objects, scene and style." +
+			"{{with .TargetLanguage}} Write the caption and tags in {{.}}.{{end}} " +
+			`Reply with a JSON object of the form {"caption": "...", "text": "...", "tags": ["..."]}, text being empty if there is none.`,
+	},
+}
+
+// DefaultPrompt returns the built-in prompt of an analysis type.
+func DefaultPrompt(t Type) Prompt {
+	return prompts[t]
+}
+
+// PromptData is what prompt templates are executed with, e.g.
+// "Summarize {{.FileName}} in {{.TargetLanguage}}.". TargetLanguage is
+// empty unless the analysis request sets it.
+type PromptData struct {
+	FileName       string
+	MimeType       string
+	TargetLanguage string
+	Type           Type
+}
+
+// ParsePrompt parses a prompt template. Besides syntax errors, it rejects
+// templates referring to fields PromptData does not have.
+func ParsePrompt(name, text string) (*template.Template, error) {
+	t, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	sample := PromptData{FileName: "report.pdf", MimeType: "application/pdf", TargetLanguage: "English", Type: TypeSummary}
+	if err := t.Execute(io.Discard, sample); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// RenderPrompt executes a prompt template with data.
+func RenderPrompt(name, text string, data PromptData) (string, error) {
+	t, err := ParsePrompt(name, text)
+	if err != nil {
+		return "", fmt.Errorf("parse prompt %q: %w", name, err)
+	}
+
+	var sb strings.Builder
+	if err := t.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("render prompt %q: %w", name, err)
+	}
+
+	return strings.TrimSpace(sb.String()), nil
+}
@@ -0,0 +1,441 @@
+package files
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mamed-gasimov/file-service/internal/metadata"
+	"github.com/mamed-gasimov/file-service/internal/modules/analysis"
+	"github.com/mamed-gasimov/file-service/internal/modules/prompts"
+	"github.com/mamed-gasimov/file-service/internal/modules/usage"
+)
+
+// maxTargetLanguageLen caps the length of an analysis target language.
+const maxTargetLanguageLen = 64
+
+// promptStore is the part of the prompts module analyses rely on.
+type promptStore interface {
+	GetTemplate(ctx context.Context, name string, version int) (*prompts.Template, error)
+}
+
+// resolvedPrompt is the prompt of an analysis. Name is nil for built-in
+// prompts. Redacted analyses read the file text with its personal data
+// replaced. ImageSize is set for analyses of images by the vision model, to
+// the longest side in pixels they are scaled down to.
+type resolvedPrompt struct {
+	Type         analysis.Type
+	Instructions string
+	Name         *string
+	Version      string
+	Redacted     bool
+	ImageSize    int
+}
+
+// cacheKey returns the cache key of analyses run with p and model, without
+// the content hash.
+func (p *resolvedPrompt) cacheKey(model string) AnalysisCacheKey {
+	version := p.Version
+	if p.Name != nil {
+		version = *p.Name + "@" + p.Version
+	}
+	if p.Redacted {
+		version += "+redacted"
+	}
+	if p.ImageSize > 0 {
+		version += fmt.Sprintf("+image%d", p.ImageSize)
+	}
+
+	hash := sha256.Sum256([]byte(p.Instructions))
+	return AnalysisCacheKey{
+		Type:          string(p.Type),
+		Model:         model,
+		PromptVersion: version,
+		PromptHash:    hex.EncodeToString(hash[:]),
+	}
+}
+
+// AnalyzeFile runs an analysis over the current content of a file and
+// records it in the file's analysis history. A summary also becomes the
+// file's resume. The result of an earlier analysis of the same content
+// with the same model and prompt is reused unless opts.Force is set.
+// Nothing is recorded when ctx is canceled before the output is complete,
+// such as when a client stops reading a streamed analysis.
+func (s *FileService) AnalyzeFile(ctx context.Context, id int64, opts AnalysisOptions) (*Analysis, error) {
+	file, prompt, err := s.prepareAnalysis(ctx, id, opts)
+	if err != nil {
+		return nil, err
+	}
+	t := prompt.Type
+	opts.progress(10)
+
+	started := time.Now()
+	model := s.analyzer.Model()
+	if prompt.ImageSize > 0 {
+		model = s.vision.VisionModel()
+	}
+	key := prompt.cacheKey(model)
+	if file.ContentHash != nil {
+		key.ContentHash = *file.ContentHash
+		if !opts.Force {
+			if c := s.lookupAnalysis(ctx, key); c != nil {
+				return s.reuseAnalysis(ctx, file, prompt, c, opts.Stream, started)
+			}
+		}
+	}
+
+	// The model reads the transcript of recordings, images scaled down, the
+	// extracted text of documents such as PDFs, and other content as is.
+	var text, input string
+	var img *analysis.Image
+	if isMedia(file.MimeType) {
+		transcript, err := s.transcript(ctx, file)
+		if err != nil {
+			return nil, err
+		}
+		text, input = transcript.Text, transcriptInput(transcript)
+	} else {
+		rc, err := s.storage.Download(ctx, file.ObjectKey)
+		if err != nil {
+			return nil, fmt.Errorf("download from storage: %w", err)
+		}
+		defer rc.Close()
+
+		content, err := io.ReadAll(rc)
+		if err != nil {
+			return nil, fmt.Errorf("read file content: %w", err)
+		}
+
+		// Files stored before content hashing are keyed by the hash of
+		// what was just downloaded.
+		if key.ContentHash == "" {
+			sum := sha256.Sum256(content)
+			key.ContentHash = hex.EncodeToString(sum[:])
+			if !opts.Force {
+				if c := s.lookupAnalysis(ctx, key); c != nil {
+					return s.reuseAnalysis(ctx, file, prompt, c, opts.Stream, started)
+				}
+			}
+		}
+
+		if prompt.ImageSize > 0 {
+			if img, err = visionInput(content, prompt.ImageSize); err != nil {
+				return nil, err
+			}
+		} else {
+			text = metadata.ExtractText(content, file.MimeType)
+			input = text
+			if input == "" {
+				input = string(content)
+			}
+		}
+	}
+	opts.progress(30)
+
+	// Redacting the whole text first keeps a value cut in two by the
+	// truncation from being sent half matched.
+	if prompt.Redacted {
+		redact, err := s.redactor(ctx, file)
+		if err != nil {
+			return nil, err
+		}
+		input = redact(input)
+	}
+	input = truncateText(input, maxAnalysisContentLen)
+
+	if err := s.checkBudget(ctx); err != nil {
+		return nil, err
+	}
+	if err := s.waitAnalysisRate(ctx); err != nil {
+		return nil, err
+	}
+
+	req := analysis.Request{
+		Type:         t,
+		Instructions: prompt.Instructions,
+		Input:        input,
+		Stream:       opts.Stream,
+	}
+	var res *analysis.Result
+	if img != nil {
+		res, err = s.vision.AnalyzeImage(ctx, req, *img)
+	} else {
+		res, err = s.analyzer.Analyze(ctx, req)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("analyze file: %w", err)
+	}
+	s.recordUsage(ctx, usage.OperationAnalyze, id, res.Usage)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	opts.progress(90)
+
+	// The output is complete: record it even if the client goes away now.
+	ctx = context.WithoutCancel(ctx)
+
+	hash := sha256.Sum256([]byte(input))
+	if img != nil {
+		hash = sha256.Sum256(img.Data)
+	}
+	a := &Analysis{
+		FileID:        id,
+		Version:       file.Version,
+		Type:          string(t),
+		Model:         res.Model,
+		PromptName:    prompt.Name,
+		PromptVersion: prompt.Version,
+		InputHash:     hex.EncodeToString(hash[:]),
+		Output:        res.Output,
+		InputTokens:   res.InputTokens,
+		OutputTokens:  res.OutputTokens,
+		LatencyMs:     int(time.Since(started).Milliseconds()),
+	}
+	if err := s.repo.CreateAnalysis(ctx, a); err != nil {
+		return nil, fmt.Errorf("save analysis result: %w", err)
+	}
+
+	// Recordings stored before content hashing are not cached.
+	if key.ContentHash != "" {
+		s.cacheAnalysis(ctx, key, &CachedAnalysis{
+			Model:        a.Model,
+			InputHash:    a.InputHash,
+			Output:       a.Output,
+			InputTokens:  a.InputTokens,
+			OutputTokens: a.OutputTokens,
+		})
+	}
+
+	if t == analysis.TypeSummary {
+		updated, resume, err := s.applySummary(ctx, id, res.Output)
+		if err != nil {
+			return nil, err
+		}
+
+		// Files without extractable text are found by their summary instead.
+		if text == "" {
+			text = resume
+		}
+		s.indexEmbeddings(ctx, updated, text)
+	}
+
+	return a, nil
+}
+
+// reuseAnalysis records a cached result in the analysis history of file as
+// if it had just been produced, without spending tokens on it.
+func (s *FileService) reuseAnalysis(ctx context.Context, file *File, prompt *resolvedPrompt, c *CachedAnalysis, stream func(delta string) error, started time.Time) (*Analysis, error) {
+	if stream != nil {
+		text := string(c.Output)
+		if prompt.Type == analysis.TypeSummary {
+			if err := json.Unmarshal(c.Output, &text); err != nil {
+				return nil, fmt.Errorf("decode summary: %w", err)
+			}
+		}
+		if err := stream(text); err != nil {
+			return nil, err
+		}
+		ctx = context.WithoutCancel(ctx)
+	}
+
+	a := &Analysis{
+		FileID:        file.ID,
+		Version:       file.Version,
+		Type:          string(prompt.Type),
+		Model:         c.Model,
+		PromptName:    prompt.Name,
+		PromptVersion: prompt.Version,
+		InputHash:     c.InputHash,
+		Output:        c.Output,
+		LatencyMs:     int(time.Since(started).Milliseconds()),
+		Cached:        true,
+	}
+	if err := s.repo.CreateAnalysis(ctx, a); err != nil {
+		return nil, fmt.Errorf("save analysis result: %w", err)
+	}
+
+	if prompt.Type == analysis.TypeSummary {
+		updated, resume, err := s.applySummary(ctx, file.ID, c.Output)
+		if err != nil {
+			return nil, err
+		}
+
+		// Extracted text was indexed on upload; files without any are
+		// found by their summary.
+		text, err := s.repo.GetExtractedText(ctx, file.ID)
+		if err != nil {
+			return nil, fmt.Errorf("get extracted text: %w", err)
+		}
+		if text == "" {
+			s.indexEmbeddings(ctx, updated, resume)
+		}
+	}
+
+	return a, nil
+}
+
+// applySummary makes the summary output of an analysis the resume of a
+// file.
+func (s *FileService) applySummary(ctx context.Context, id int64, output json.RawMessage) (*File, string, error) {
+	var resume string
+	if err := json.Unmarshal(output, &resume); err != nil {
+		return nil, "", fmt.Errorf("decode summary: %w", err)
+	}
+
+	updated, err := s.repo.UpdateResume(ctx, id, resume)
+	if err != nil {
+		return nil, "", fmt.Errorf("save analysis result: %w", err)
+	}
+
+	return updated, resume, nil
+}
+
+// prepareAnalysis validates opts and returns the file to analyze with the
+// prompt of the analysis.
+func (s *FileService) prepareAnalysis(ctx context.Context, id int64, opts AnalysisOptions) (*File, *resolvedPrompt, error) {
+	if err := checkTargetLanguage(opts.TargetLanguage); err != nil {
+		return nil, nil, err
+	}
+
+	file, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("file not found: %w", err)
+	}
+	if isMedia(file.MimeType) && file.Size > maxTranscriptionSize {
+		return nil, nil, fmt.Errorf("recordings of up to %d MiB can be analyzed: %w", maxTranscriptionSize>>20, ErrTooLarge)
+	}
+
+	prompt, err := s.resolvePrompt(ctx, file, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if prompt.Type == analysis.TypeImage && prompt.ImageSize == 0 {
+		return nil, nil, fmt.Errorf("image analyses need a JPEG, PNG, GIF or WebP image: %w", ErrInvalid)
+	}
+
+	return file, prompt, nil
+}
+
+// truncateText returns at most the first n bytes of text, cut back to the
+// start of a rune so no character is split.
+func truncateText(text string, n int) string {
+	if len(text) <= n {
+		return text
+	}
+	for n > 0 && !utf8.RuneStart(text[n]) {
+		n--
+	}
+	return text[:n]
+}
+
+func checkTargetLanguage(lang string) error {
+	if len(lang) > maxTargetLanguageLen || strings.ContainsFunc(lang, unicode.IsControl) {
+		return fmt.Errorf("target language must be at most %d characters on one line: %w", maxTargetLanguageLen, ErrInvalid)
+	}
+	return nil
+}
+
+// progress reports the percentage of an analysis done to o.Progress.
+func (o AnalysisOptions) progress(percent int) {
+	if o.Progress != nil {
+		o.Progress(percent)
+	}
+}
+
+// resolvePrompt renders the prompt template selected by opts, or else the
+// built-in prompt of the analysis type, for file.
+func (s *FileService) resolvePrompt(ctx context.Context, file *File, opts AnalysisOptions) (*resolvedPrompt, error) {
+	p := &resolvedPrompt{Redacted: s.redactPII}
+	if s.vision != nil && isVisionImage(file.MimeType) {
+		// Images have no text to redact.
+		p.ImageSize, p.Redacted = s.visionMaxSize, false
+	}
+	var name, text string
+
+	if opts.Prompt != "" {
+		if s.prompts == nil {
+			return nil, fmt.Errorf("prompt templates are not configured: %w", ErrUnavailable)
+		}
+
+		tmpl, err := s.prompts.GetTemplate(ctx, opts.Prompt, opts.PromptVersion)
+		if errors.Is(err, prompts.ErrNotFound) {
+			return nil, fmt.Errorf("%v: %w", err, ErrNotFound)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("get prompt template: %w", err)
+		}
+
+		if opts.Type == "" {
+			opts.Type = tmpl.Type
+		} else if opts.Type != tmpl.Type {
+			return nil, fmt.Errorf("prompt template %q is for %s analyses, not %s: %w", tmpl.Name, tmpl.Type, opts.Type, ErrInvalid)
+		}
+
+		name, text = tmpl.Name, tmpl.Template
+		p.Name, p.Version = &tmpl.Name, strconv.Itoa(tmpl.Version)
+	} else if opts.PromptVersion != 0 {
+		return nil, fmt.Errorf("a prompt version requires a prompt template: %w", ErrInvalid)
+	}
+
+	if opts.Type == "" {
+		opts.Type = string(analysis.TypeSummary)
+	}
+	t, err := analysis.ParseType(opts.Type)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", err, ErrInvalid)
+	}
+	p.Type = t
+	if t == analysis.TypeImage && s.vision == nil {
+		return nil, fmt.Errorf("image analyses are not configured: %w", ErrUnavailable)
+	}
+
+	if p.Name == nil {
+		builtin := analysis.DefaultPrompt(t)
+		name, text, p.Version = string(t), builtin.Template, builtin.Version
+	}
+
+	p.Instructions, err = analysis.RenderPrompt(name, text, analysis.PromptData{
+		FileName:       file.Name,
+		MimeType:       file.MimeType,
+		TargetLanguage: opts.TargetLanguage,
+		Type:           t,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// ListAnalyses returns the analysis history of a file, newest first.
+func (s *FileService) ListAnalyses(ctx context.Context, id int64, filter AnalysisFilter) ([]Analysis, error) {
+	if filter.Type != "" {
+		if _, err := analysis.ParseType(filter.Type); err != nil {
+			return nil, fmt.Errorf("%v: %w", err, ErrInvalid)
+		}
+	}
+
+	if _, err := s.repo.GetByID(ctx, id); err != nil {
+		return nil, fmt.Errorf("file not found: %w", err)
+	}
+
+	analyses, err := s.repo.ListAnalyses(ctx, id, filter)
+	if err != nil {
+		return nil, fmt.Errorf("list analyses: %w", err)
+	}
+
+	if analyses == nil {
+		analyses = []Analysis{}
+	}
+
+	return analyses, nil
+}
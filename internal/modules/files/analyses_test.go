@@ -0,0 +1,24 @@
+package files
+
+import "testing"
+
+func TestTruncateText(t *testing.T) {
+	tests := []struct {
+		text string
+		n    int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"exact", 5, "exact"},
+		{"longer text", 6, "longer"},
+		{"Grüße", 3, "Gr"}, // ü is two bytes
+		{"Grüße", 4, "Grü"},
+		{"日本", 2, ""},
+		{"", 0, ""},
+	}
+	for _, tt := range tests {
+		if got := truncateText(tt.text, tt.n); got != tt.want {
+			t.Errorf("truncateText(%q, %d) = %q, want %q", tt.text, tt.n, got, tt.want)
+		}
+	}
+}
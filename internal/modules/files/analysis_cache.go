@@ -0,0 +1,86 @@
+package files
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// lookupAnalysis returns the result cached for key, checking the in-process
+// cache before the database, or nil if there is none. The cache is
+// best-effort: lookup failures are logged and treated as misses.
+func (s *FileService) lookupAnalysis(ctx context.Context, key AnalysisCacheKey) *CachedAnalysis {
+	if s.analysisCache != nil {
+		if c, ok := s.analysisCache.Get(key); ok {
+			return c
+		}
+	}
+
+	c, err := s.repo.GetCachedAnalysis(ctx, key)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		log.Printf("get cached %s analysis: %v", key.Type, err)
+		return nil
+	}
+
+	if s.analysisCache != nil {
+		s.analysisCache.Add(key, c)
+	}
+	return c
+}
+
+// cacheAnalysis stores a result for reuse. Failures are logged: the result
+// has already been recorded in the analysis history.
+func (s *FileService) cacheAnalysis(ctx context.Context, key AnalysisCacheKey, c *CachedAnalysis) {
+	if err := s.repo.SaveCachedAnalysis(ctx, key, c); err != nil {
+		log.Printf("cache %s analysis: %v", key.Type, err)
+		return
+	}
+
+	if s.analysisCache != nil {
+		s.analysisCache.Add(key, c)
+	}
+}
+
+// AnalysisCacheStats reports the hit rate of the analysis cache, overall
+// and per analysis type, over the analyses recorded since since (all of
+// them when nil).
+func (s *FileService) AnalysisCacheStats(ctx context.Context, since *time.Time) (*AnalysisCacheStats, error) {
+	types, err := s.repo.AnalysisCacheHits(ctx, since)
+	if err != nil {
+		return nil, fmt.Errorf("count cache hits: %w", err)
+	}
+
+	entries, err := s.repo.CountCachedAnalyses(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("count cached analyses: %w", err)
+	}
+
+	stats := &AnalysisCacheStats{Since: since, Entries: entries, Types: []AnalysisTypeStats{}}
+	for _, t := range types {
+		t.HitRate = hitRate(t.Hits, t.Requests)
+		stats.Types = append(stats.Types, t)
+		stats.Requests += t.Requests
+		stats.Hits += t.Hits
+	}
+	stats.HitRate = hitRate(stats.Hits, stats.Requests)
+
+	if s.analysisCache != nil {
+		memory := s.analysisCache.Stats()
+		stats.Memory = &memory
+	}
+
+	return stats, nil
+}
+
+// hitRate returns hits as a fraction of requests, 0 when there were none.
+func hitRate(hits, requests int) float64 {
+	if requests == 0 {
+		return 0
+	}
+	return float64(hits) / float64(requests)
+}
@@ -0,0 +1,202 @@
+package files
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mamed-gasimov/file-service/internal/modules/usage"
+)
+
+// maxQuestionLen caps the length of a question, in characters.
+const maxQuestionLen = 2000
+
+// askSources is the number of passages an answer is grounded in.
+const askSources = 6
+
+// citationPattern matches the source references of an answer, such as [2]
+// or [1, 3].
+var citationPattern = regexp.MustCompile(`\[(\d+(?:\s*,\s*\d+)*)\]`)
+
+// AskFile answers a question about a file from the passages of its text
+// most relevant to it. When stream is non-nil it receives the answer piece
+// by piece as it is generated.
+func (s *FileService) AskFile(ctx context.Context, id int64, question string, stream func(delta string) error) (*Answer, error) {
+	if s.answerer == nil {
+		return nil, fmt.Errorf("question answering is not configured: %w", ErrUnavailable)
+	}
+
+	question = strings.TrimSpace(question)
+	if question == "" {
+		return nil, fmt.Errorf("empty question: %w", ErrInvalid)
+	}
+	if utf8.RuneCountInString(question) > maxQuestionLen {
+		return nil, fmt.Errorf("question longer than %d characters: %w", maxQuestionLen, ErrInvalid)
+	}
+
+	file, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("file not found: %w", err)
+	}
+
+	if err := s.checkBudget(ctx); err != nil {
+		return nil, err
+	}
+
+	chunks, err := s.retrieveChunks(ctx, file, question)
+	if err != nil {
+		return nil, err
+	}
+	if len(chunks) == 0 {
+		return nil, fmt.Errorf("file %d has no text to answer from: %w", id, ErrInvalid)
+	}
+
+	sources := make([]string, len(chunks))
+	for i, c := range chunks {
+		sources[i] = c.Content
+	}
+	if s.redactPII {
+		redact, err := s.redactor(ctx, file)
+		if err != nil {
+			return nil, err
+		}
+		for i := range sources {
+			sources[i] = redact(sources[i])
+		}
+	}
+
+	answer, u, err := s.answerer.Answer(ctx, question, sources, stream)
+	s.recordUsage(ctx, usage.OperationAnswer, id, u)
+	if err != nil {
+		return nil, fmt.Errorf("answer question: %w", err)
+	}
+
+	return &Answer{FileID: id, Question: question, Answer: answer, Citations: citations(answer, chunks)}, nil
+}
+
+// retrieveChunks returns the passages of a file's text most relevant to a
+// question, best first. Chunks embedded for semantic search are ranked by
+// similarity to the question; otherwise the text is chunked on the fly and
+// ranked by the question's words. Files without extracted text are answered
+// from their summary.
+func (s *FileService) retrieveChunks(ctx context.Context, f *File, question string) ([]Chunk, error) {
+	if s.embedder != nil {
+		chunks, err := s.repo.ListChunks(ctx, f.ID, f.Version, s.embedder.EmbeddingModel())
+		if err != nil {
+			return nil, fmt.Errorf("list chunks: %w", err)
+		}
+
+		if len(chunks) > 0 {
+			vectors, u, err := s.embedder.Embed(ctx, []string{question})
+			s.recordUsage(ctx, usage.OperationEmbed, f.ID, u)
+			if err != nil {
+				return nil, fmt.Errorf("embed question: %w", err)
+			}
+
+			scores := make([]float64, len(chunks))
+			for i, c := range chunks {
+				scores[i] = math.Inf(-1)
+				if len(c.Embedding) == len(vectors[0]) {
+					scores[i] = cosineSimilarity(vectors[0], c.Embedding)
+				}
+			}
+			return topChunks(chunks, scores, askSources), nil
+		}
+	}
+
+	text, err := s.repo.GetExtractedText(ctx, f.ID)
+	if err != nil {
+		return nil, fmt.Errorf("file not found: %w", err)
+	}
+	if text == "" && f.Resume != nil {
+		text = *f.Resume
+	}
+
+	chunks := chunkText(text)
+	return topChunks(chunks, keywordScores(chunks, question), askSources), nil
+}
+
+// topChunks returns the n chunks with the highest scores, best first. Ties
+// keep text order, so a question matching nothing is answered from the
+// beginning of the text.
+func topChunks(chunks []Chunk, scores []float64, n int) []Chunk {
+	order := make([]int, len(chunks))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		switch {
+		case scores[a] > scores[b]:
+			return -1
+		case scores[a] < scores[b]:
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	top := make([]Chunk, 0, min(n, len(order)))
+	for _, i := range order[:min(n, len(order))] {
+		top = append(top, chunks[i])
+	}
+	return top
+}
+
+// keywordScores scores each chunk by the words of the question it contains.
+// Every distinct word found counts, with diminishing weight for repeats;
+// words shorter than three letters are ignored.
+func keywordScores(chunks []Chunk, question string) []float64 {
+	terms := make(map[string]bool)
+	for _, w := range words(question) {
+		if utf8.RuneCountInString(w) >= 3 {
+			terms[w] = true
+		}
+	}
+
+	scores := make([]float64, len(chunks))
+	for i, c := range chunks {
+		counts := make(map[string]int)
+		for _, w := range words(c.Content) {
+			if terms[w] {
+				counts[w]++
+			}
+		}
+		for _, n := range counts {
+			scores[i] += 1 + math.Log(float64(n))
+		}
+	}
+	return scores
+}
+
+// words splits text into lower-case words of letters and digits.
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// citations returns the sources an answer cites, in the order first cited.
+// References to sources that were not provided are ignored.
+func citations(answer string, sources []Chunk) []Citation {
+	cited := []Citation{}
+	seen := make(map[int]bool)
+	for _, m := range citationPattern.FindAllStringSubmatch(answer, -1) {
+		for _, ref := range strings.Split(m[1], ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(ref))
+			if err != nil || n < 1 || n > len(sources) || seen[n] {
+				continue
+			}
+			seen[n] = true
+
+			c := sources[n-1]
+			cited = append(cited, Citation{Source: n, Index: c.Index, Start: c.Start, End: c.End, Content: c.Content})
+		}
+	}
+	return cited
+}
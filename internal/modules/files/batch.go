@@ -0,0 +1,260 @@
+package files
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/mamed-gasimov/file-service/internal/modules/analysis"
+	"github.com/mamed-gasimov/file-service/internal/modules/jobs"
+)
+
+const (
+	// maxBatchSize caps how many files one batch analysis covers.
+	maxBatchSize = 10000
+
+	// maxBatchErrors caps how many failures a batch result lists.
+	maxBatchErrors = 100
+
+	defaultBatchConcurrency = 4
+)
+
+// analysisBatchJobParams are the parameters of an analyze_batch job. The
+// files are resolved when the batch is submitted.
+type analysisBatchJobParams struct {
+	IDs []int64 `json:"ids"`
+	analysisJobParams
+}
+
+// waitAnalysisRate blocks until the rate limit lets another analysis call
+// the model.
+func (s *FileService) waitAnalysisRate(ctx context.Context) error {
+	if s.analysisLimiter == nil {
+		return nil
+	}
+	return s.analysisLimiter.Wait(ctx)
+}
+
+// batchFileIDs returns the files a batch analysis covers: the listed IDs
+// without duplicates, or else the live files matching the filter.
+func (s *FileService) batchFileIDs(ctx context.Context, opts BatchOptions) ([]int64, error) {
+	var ids []int64
+	if len(opts.IDs) > 0 {
+		ids = slices.Clone(opts.IDs)
+		slices.Sort(ids)
+		ids = slices.Compact(ids)
+	} else {
+		filter := opts.Filter
+		filter.IncludeDeleted = false
+		var err error
+		if filter.Tags, err = normalizeTags(filter.Tags); err != nil {
+			return nil, err
+		}
+		if ids, err = s.repo.ListIDs(ctx, filter); err != nil {
+			return nil, fmt.Errorf("list files: %w", err)
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no files to analyze: %w", ErrInvalid)
+	}
+	if len(ids) > maxBatchSize {
+		return nil, fmt.Errorf("%d files selected, at most %d per batch: %w", len(ids), maxBatchSize, ErrInvalid)
+	}
+
+	return ids, nil
+}
+
+// batchAnalysisType validates the options of a batch analysis before any
+// file is looked at and returns the type of analysis they select.
+func (s *FileService) batchAnalysisType(ctx context.Context, opts AnalysisOptions) (analysis.Type, error) {
+	if err := checkTargetLanguage(opts.TargetLanguage); err != nil {
+		return "", err
+	}
+
+	// The prompt is rendered for every file; this only checks that it can be.
+	prompt, err := s.resolvePrompt(ctx, &File{}, opts)
+	if err != nil {
+		return "", err
+	}
+
+	return prompt.Type, nil
+}
+
+// SubmitAnalysisBatch queues an analysis of many files as one job. The
+// files are resolved now, and the options and budget checked, so a job is
+// only created for a batch that can run.
+func (s *FileService) SubmitAnalysisBatch(ctx context.Context, opts BatchOptions) (*jobs.Job, error) {
+	if s.jobs == nil {
+		return nil, fmt.Errorf("background jobs are not configured: %w", ErrUnavailable)
+	}
+
+	if _, err := s.batchAnalysisType(ctx, opts.Analysis); err != nil {
+		return nil, err
+	}
+	ids, err := s.batchFileIDs(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkBudget(ctx); err != nil {
+		return nil, err
+	}
+
+	a := opts.Analysis
+	job, err := s.jobs.Submit(ctx, jobs.TypeAnalyzeBatch, nil, analysisBatchJobParams{
+		IDs: ids,
+		analysisJobParams: analysisJobParams{
+			Type:           a.Type,
+			Prompt:         a.Prompt,
+			PromptVersion:  a.PromptVersion,
+			TargetLanguage: a.TargetLanguage,
+			Force:          a.Force,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("submit analysis batch: %w", err)
+	}
+
+	return job, nil
+}
+
+// AnalyzeBatch runs an analysis on every selected file, up to the batch
+// concurrency at a time and within the analysis rate limit. A failed file
+// is counted and the batch goes on; a spent budget stops it, returning the
+// result so far with the error.
+func (s *FileService) AnalyzeBatch(ctx context.Context, opts BatchOptions) (*BatchResult, error) {
+	t, err := s.batchAnalysisType(ctx, opts.Analysis)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := s.batchFileIDs(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	result := &BatchResult{Total: len(ids), Errors: []BatchError{}}
+	var mu sync.Mutex
+	done := 0
+
+	next := make(chan int64)
+	var wg sync.WaitGroup
+	for range min(s.batchConcurrency, len(ids)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range next {
+				outcome, err := s.analyzeInBatch(ctx, id, t, opts)
+
+				mu.Lock()
+				switch {
+				case err == nil:
+					switch outcome {
+					case "skipped":
+						result.Skipped++
+					case "cached":
+						result.Cached++
+					default:
+						result.Analyzed++
+					}
+				case errors.Is(err, ErrBudgetExceeded):
+					cancel(err)
+				case ctx.Err() != nil:
+					// The batch is stopping; the file is left as it was.
+				default:
+					result.Failed++
+					if len(result.Errors) < maxBatchErrors {
+						result.Errors = append(result.Errors, BatchError{FileID: id, Error: err.Error()})
+					}
+				}
+				done = result.Analyzed + result.Cached + result.Skipped + result.Failed
+				if opts.Progress != nil {
+					opts.Progress(done, len(ids))
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+feed:
+	for _, id := range ids {
+		select {
+		case <-ctx.Done():
+			break feed
+		case next <- id:
+		}
+	}
+	close(next)
+	wg.Wait()
+
+	if err := context.Cause(ctx); err != nil {
+		return result, fmt.Errorf("stopped after %d of %d files: %w", done, len(ids), err)
+	}
+
+	return result, nil
+}
+
+// analyzeInBatch analyzes one file of a batch, reporting whether it was
+// "analyzed", answered from the "cached" result or "skipped".
+func (s *FileService) analyzeInBatch(ctx context.Context, id int64, t analysis.Type, opts BatchOptions) (string, error) {
+	if opts.Since != nil {
+		recorded, err := s.repo.ListAnalyses(ctx, id, AnalysisFilter{Type: string(t), Since: opts.Since, Limit: 1})
+		if err != nil {
+			return "", fmt.Errorf("list analyses: %w", err)
+		}
+		if len(recorded) > 0 {
+			return "skipped", nil
+		}
+	}
+
+	a, err := s.AnalyzeFile(ctx, id, opts.Analysis)
+	if err != nil {
+		return "", err
+	}
+	if a.Cached {
+		return "cached", nil
+	}
+	return "analyzed", nil
+}
+
+// RunAnalysisBatchJob is the jobs.Handler of analyze_batch jobs. Its result
+// is the BatchResult. A job retried after an interruption skips the files
+// it already analyzed.
+func (s *FileService) RunAnalysisBatchJob(ctx context.Context, job *jobs.Job, p analysisBatchJobParams, progress func(percent int)) (json.RawMessage, error) {
+	opts := BatchOptions{
+		IDs: p.IDs,
+		Analysis: AnalysisOptions{
+			Type:           p.Type,
+			Prompt:         p.Prompt,
+			PromptVersion:  p.PromptVersion,
+			TargetLanguage: p.TargetLanguage,
+			Force:          p.Force,
+		},
+		Progress: func(done, total int) {
+			progress(100 * done / total)
+		},
+	}
+	if job.Attempts > 1 {
+		opts.Since = &job.CreatedAt
+	}
+
+	started := time.Now()
+	result, err := s.AnalyzeBatch(ctx, opts)
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrInvalid) || errors.Is(err, ErrBudgetExceeded) {
+		return nil, jobs.Permanent(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("analysis batch %d: %d files analyzed, %d cached, %d skipped, %d failed in %s",
+		job.ID, result.Analyzed, result.Cached, result.Skipped, result.Failed, time.Since(started).Round(time.Second))
+
+	return json.Marshal(result)
+}
@@ -0,0 +1,223 @@
+package files
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/mamed-gasimov/file-service/internal/modules/jobs"
+	"github.com/mamed-gasimov/file-service/internal/storage"
+)
+
+const (
+	// reapBatchSize is how many tombstoned files the reaper handles per pass.
+	reapBatchSize = 100
+
+	// reapDelay leaves a fresh tombstone to the request that wrote it before
+	// the reaper retries it.
+	reapDelay = time.Minute
+
+	// orphanGrace is how old an unreferenced object must be before it is
+	// considered an orphan. Objects are uploaded before their row is
+	// inserted, so younger ones may belong to an upload in flight.
+	orphanGrace = time.Hour
+)
+
+// purge removes the objects of a tombstoned file, then its row. Every step
+// tolerates having already been done, so it can be retried after a failure.
+func (s *FileService) purge(ctx context.Context, file *File) error {
+	if err := s.deleteRenditions(ctx, file.ID); err != nil {
+		return err
+	}
+
+	versions, err := s.repo.ListVersions(ctx, file.ID)
+	if err != nil {
+		return fmt.Errorf("list versions: %w", err)
+	}
+	for _, v := range versions {
+		if err := s.storage.Delete(ctx, v.ObjectKey); err != nil {
+			return fmt.Errorf("delete version from storage: %w", err)
+		}
+	}
+
+	if err := s.storage.Delete(ctx, file.ObjectKey); err != nil {
+		return fmt.Errorf("delete from storage: %w", err)
+	}
+
+	if err := s.repo.Delete(ctx, file.ID); err != nil && !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("delete file record: %w", err)
+	}
+
+	return nil
+}
+
+// ReapDeleted finishes the deletion of files left tombstoned by an
+// interrupted delete. It returns the number of files purged.
+func (s *FileService) ReapDeleted(ctx context.Context) (int, error) {
+	reaped := 0
+	for {
+		files, err := s.repo.ListDeleting(ctx, time.Now().Add(-reapDelay), reapBatchSize)
+		if err != nil {
+			return reaped, fmt.Errorf("list deleting files: %w", err)
+		}
+
+		for i := range files {
+			if err := s.purge(ctx, &files[i]); err != nil {
+				return reaped, fmt.Errorf("purge file %d: %w", files[i].ID, err)
+			}
+			reaped++
+		}
+
+		if len(files) < reapBatchSize {
+			return reaped, nil
+		}
+	}
+}
+
+// ExpireTrash permanently deletes the files that have been in the trash for
+// longer than the configured retention. It returns the number of files
+// deleted.
+func (s *FileService) ExpireTrash(ctx context.Context) (int, error) {
+	if s.trashRetention <= 0 {
+		return 0, nil
+	}
+
+	expired := 0
+	for {
+		files, err := s.repo.ListTrashedBefore(ctx, time.Now().Add(-s.trashRetention), reapBatchSize)
+		if err != nil {
+			return expired, fmt.Errorf("list expired trash: %w", err)
+		}
+
+		for _, f := range files {
+			if err := s.hardDelete(ctx, f.ID, true); err != nil && !errors.Is(err, ErrNotFound) {
+				return expired, fmt.Errorf("delete file %d: %w", f.ID, err)
+			}
+			expired++
+		}
+
+		if len(files) < reapBatchSize {
+			return expired, nil
+		}
+	}
+}
+
+// Reconcile compares the bucket with the object keys referenced by files,
+// versions and renditions. With clean set, orphan objects are deleted, older
+// versions and renditions whose object is missing are dropped and files whose
+// object is missing are moved to the trash, where they can still be
+// restored, or purged, until the trash retention expires.
+func (s *FileService) Reconcile(ctx context.Context, clean bool) (*ReconcileReport, error) {
+	refs, err := s.repo.ListObjectRefs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list object refs: %w", err)
+	}
+
+	byKey := make(map[string]ObjectRef, len(refs))
+	for _, ref := range refs {
+		byKey[ref.ObjectKey] = ref
+	}
+
+	report := &ReconcileReport{OrphanObjects: []string{}, MissingObjects: []string{}, Cleaned: clean}
+	seen := make(map[string]bool, len(refs))
+	cutoff := time.Now().Add(-orphanGrace)
+
+	err = s.storage.Walk(ctx, "", func(obj storage.Object) error {
+		if _, ok := byKey[obj.Key]; ok {
+			seen[obj.Key] = true
+			return nil
+		}
+		if obj.LastModified.Before(cutoff) {
+			report.OrphanObjects = append(report.OrphanObjects, obj.Key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walk storage: %w", err)
+	}
+
+	var missing []ObjectRef
+	for _, ref := range refs {
+		// Objects of tombstoned files may already be gone; the reaper owns them.
+		if seen[ref.ObjectKey] || ref.Status == StatusDeleting {
+			continue
+		}
+		missing = append(missing, ref)
+		report.MissingObjects = append(report.MissingObjects, ref.ObjectKey)
+	}
+
+	if !clean {
+		return report, nil
+	}
+
+	for _, key := range report.OrphanObjects {
+		if err := s.storage.Delete(ctx, key); err != nil {
+			return report, fmt.Errorf("delete orphan object: %w", err)
+		}
+	}
+
+	for _, ref := range missing {
+		switch {
+		case ref.RenditionID != 0:
+			if err := s.repo.DeleteRendition(ctx, ref.RenditionID); err != nil {
+				return report, err
+			}
+			continue
+		case ref.VersionID != 0:
+			if err := s.repo.DeleteVersion(ctx, ref.VersionID); err != nil {
+				return report, err
+			}
+			continue
+		}
+		// Already trashed files are left to the trash retention.
+		if _, err := s.repo.Trash(ctx, ref.FileID); err != nil && !errors.Is(err, ErrNotFound) {
+			return report, fmt.Errorf("trash file %d: %w", ref.FileID, err)
+		}
+	}
+
+	return report, nil
+}
+
+// RunReapJob is the jobs.Handler of reap jobs. It calls ExpireTrash and
+// ReapDeleted and returns how many files each deleted.
+func (s *FileService) RunReapJob(ctx context.Context, _ *jobs.Job, _ func(percent int)) (json.RawMessage, error) {
+	expired, expireErr := s.ExpireTrash(ctx)
+	if expired > 0 {
+		log.Printf("permanently deleted %d files from the trash", expired)
+	}
+
+	reaped, reapErr := s.ReapDeleted(ctx)
+	if reaped > 0 {
+		log.Printf("reaped %d deleted files", reaped)
+	}
+
+	if err := errors.Join(expireErr, reapErr); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(map[string]int{"expired": expired, "reaped": reaped})
+}
+
+// ReconcileJob returns the jobs.Handler of reconcile jobs, which call
+// Reconcile with clean, log what it finds and return the report.
+func (s *FileService) ReconcileJob(clean bool) jobs.Handler {
+	return func(ctx context.Context, _ *jobs.Job, _ func(percent int)) (json.RawMessage, error) {
+		report, err := s.Reconcile(ctx, clean)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range report.OrphanObjects {
+			log.Printf("reconcile: orphan object %q", key)
+		}
+		for _, key := range report.MissingObjects {
+			log.Printf("reconcile: missing object %q", key)
+		}
+		log.Printf("reconcile: %d orphan objects, %d missing objects (cleaned: %t)",
+			len(report.OrphanObjects), len(report.MissingObjects), report.Cleaned)
+
+		return json.Marshal(report)
+	}
+}
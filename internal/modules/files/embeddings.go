@@ -0,0 +1,304 @@
+package files
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/mamed-gasimov/file-service/internal/modules/jobs"
+	"github.com/mamed-gasimov/file-service/internal/modules/usage"
+)
+
+// Text is split into chunks of about chunkSize runes, each repeating the
+// last chunkOverlap runes of the previous one so a sentence cut in two is
+// still found whole in one of them.
+const (
+	chunkSize    = 1000
+	chunkOverlap = 200
+)
+
+// embedBatchSize is the number of chunks embedded per provider call.
+const embedBatchSize = 96
+
+// defaultSemanticLimit is the page size of semantic searches that do not
+// set a limit.
+const defaultSemanticLimit = 10
+
+// maxChunksPerHit caps the matching chunks returned with each file.
+const maxChunksPerHit = 3
+
+// maxSemanticCandidates caps the chunks ranked for one semantic search,
+// and with it the offset a search can page to.
+const maxSemanticCandidates = 1000
+
+// requestEmbeddings queues an embed job for the current version of a file,
+// so that its text is indexed for semantic search after the upload. Without
+// background jobs, the text is indexed right away.
+func (s *FileService) requestEmbeddings(ctx context.Context, f *File, text string) {
+	if s.embedder == nil {
+		return
+	}
+
+	if s.jobs == nil {
+		s.indexEmbeddings(ctx, f, text)
+		return
+	}
+
+	_, err := s.jobs.Submit(ctx, jobs.TypeEmbed, &f.ID, embedJobParams{Version: f.Version},
+		jobs.UniqueKey(fmt.Sprintf("embed:%d:%d", f.ID, f.Version)))
+	if err != nil {
+		log.Printf("queue embeddings for file %d: %v", f.ID, err)
+	}
+}
+
+// embedJobParams are the parameters of an embed job.
+type embedJobParams struct {
+	Version int `json:"version"`
+}
+
+// RunEmbedJob is the jobs.Handler of embed jobs. It indexes the text of the
+// version the job was queued for, unless the file has changed since, and
+// returns the number of chunks stored.
+func (s *FileService) RunEmbedJob(ctx context.Context, job *jobs.Job, p embedJobParams, progress func(percent int)) (json.RawMessage, error) {
+	if job.FileID == nil {
+		return nil, jobs.Permanent(fmt.Errorf("embed job %d has no file", job.ID))
+	}
+
+	f, err := s.repo.GetByID(ctx, *job.FileID)
+	if errors.Is(err, ErrNotFound) {
+		return nil, jobs.Permanent(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if f.Version != p.Version || s.embedder == nil {
+		return nil, nil
+	}
+
+	text, err := s.repo.GetExtractedText(ctx, f.ID)
+	if err != nil {
+		return nil, fmt.Errorf("get extracted text: %w", err)
+	}
+	progress(10)
+
+	chunks, err := s.embed(ctx, f, text)
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrBudgetExceeded) {
+		return nil, jobs.Permanent(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(map[string]int{"chunks": chunks})
+}
+
+// indexEmbeddings replaces the chunks of the current version of f with
+// embeddings of text. Indexing is best-effort: failures are logged and the
+// file stays searchable by keywords.
+func (s *FileService) indexEmbeddings(ctx context.Context, f *File, text string) {
+	if s.embedder == nil {
+		return
+	}
+	if _, err := s.embed(ctx, f, text); err != nil {
+		log.Printf("embed file %d: %v", f.ID, err)
+	}
+}
+
+// embed replaces the chunks of the current version of f with embeddings of
+// text and returns their number. An empty text only removes the old chunks.
+// The budget is checked before each provider call, so a spent budget leaves
+// the old chunks in place. With redaction on, the chunks are embedded with
+// their personal data replaced, and stored as they are.
+func (s *FileService) embed(ctx context.Context, f *File, text string) (int, error) {
+	redact := func(input string) string { return input }
+	if s.redactPII {
+		var err error
+		if redact, err = s.redactor(ctx, f); err != nil {
+			return 0, err
+		}
+	}
+
+	chunks := chunkText(text)
+	for start := 0; start < len(chunks); start += embedBatchSize {
+		batch := chunks[start:min(start+embedBatchSize, len(chunks))]
+
+		inputs := make([]string, len(batch))
+		for i, c := range batch {
+			inputs[i] = redact(c.Content)
+		}
+
+		if err := s.checkBudget(ctx); err != nil {
+			return 0, err
+		}
+
+		vectors, u, err := s.embedder.Embed(ctx, inputs)
+		s.recordUsage(ctx, usage.OperationEmbed, f.ID, u)
+		if err != nil {
+			return 0, err
+		}
+		for i := range batch {
+			batch[i].Embedding = vectors[i]
+		}
+	}
+
+	if err := s.repo.ReplaceChunks(ctx, f.ID, f.Version, s.embedder.EmbeddingModel(), chunks); err != nil {
+		return 0, fmt.Errorf("save embeddings: %w", err)
+	}
+	return len(chunks), nil
+}
+
+// SemanticSearch returns the files whose text is the closest in meaning to
+// q, narrowed by filter, with their best matching chunks.
+func (s *FileService) SemanticSearch(ctx context.Context, q string, filter ListFilter) (*SemanticResults, error) {
+	if s.embedder == nil {
+		return nil, fmt.Errorf("semantic search is not configured: %w", ErrUnavailable)
+	}
+
+	q = strings.TrimSpace(q)
+	if q == "" {
+		return nil, fmt.Errorf("empty search query: %w", ErrInvalid)
+	}
+
+	var err error
+	if filter.Tags, err = normalizeTags(filter.Tags); err != nil {
+		return nil, err
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultSemanticLimit
+	}
+
+	if err := s.checkBudget(ctx); err != nil {
+		return nil, err
+	}
+
+	vectors, u, err := s.embedder.Embed(ctx, []string{q})
+	s.recordUsage(ctx, usage.OperationEmbed, 0, u)
+	if err != nil {
+		return nil, fmt.Errorf("embed query: %w", err)
+	}
+
+	matches, err := s.repo.NearestChunks(ctx, s.embedder.EmbeddingModel(), vectors[0], filter, maxSemanticCandidates)
+	if err != nil {
+		return nil, fmt.Errorf("find similar chunks: %w", err)
+	}
+
+	// Matches come best first, so the first chunk of a file sets its rank.
+	var hits []SemanticHit
+	index := make(map[int64]int)
+	for _, m := range matches {
+		i, ok := index[m.FileID]
+		if !ok {
+			i = len(hits)
+			index[m.FileID] = i
+			hits = append(hits, SemanticHit{File: File{ID: m.FileID}, Score: m.Score})
+		}
+		if len(hits[i].Chunks) < maxChunksPerHit {
+			hits[i].Chunks = append(hits[i].Chunks, m)
+		}
+	}
+
+	hits = hits[min(filter.Offset, len(hits)):]
+	hits = hits[:min(filter.Limit, len(hits))]
+
+	page := make([]SemanticHit, 0, len(hits))
+	for _, h := range hits {
+		f, err := s.repo.GetByID(ctx, h.File.ID)
+		if errors.Is(err, ErrNotFound) {
+			continue // deleted since the chunks were ranked
+		}
+		if err != nil {
+			return nil, fmt.Errorf("load file %d: %w", h.File.ID, err)
+		}
+		h.File = *f
+		page = append(page, h)
+	}
+
+	return &SemanticResults{Hits: page, Limit: filter.Limit, Offset: filter.Offset}, nil
+}
+
+// chunkText splits text into overlapping chunks, preferring to cut at a
+// paragraph, sentence or word boundary in the last part of a chunk.
+func chunkText(text string) []Chunk {
+	runes := []rune(text)
+	var chunks []Chunk
+	for start := 0; start < len(runes); {
+		end := min(start+chunkSize, len(runes))
+		if end < len(runes) {
+			end = chunkBoundary(runes, start+chunkSize/2, end)
+		}
+
+		from, to := start, end
+		for from < to && unicode.IsSpace(runes[from]) {
+			from++
+		}
+		for to > from && unicode.IsSpace(runes[to-1]) {
+			to--
+		}
+		if from < to {
+			chunks = append(chunks, Chunk{Index: len(chunks), Start: from, End: to, Content: string(runes[from:to])})
+		}
+		if end == len(runes) {
+			break
+		}
+		next := max(end-chunkOverlap, start+1)
+		for i := next; i < end; i++ {
+			if unicode.IsSpace(runes[i-1]) {
+				next = i
+				break
+			}
+		}
+		start = next
+	}
+
+	return chunks
+}
+
+// chunkBoundary returns the best position in runes[from:to] to end a chunk
+// at: after a blank line, else after a sentence, else after a space, else
+// to itself.
+func chunkBoundary(runes []rune, from, to int) int {
+	word, sentence := -1, -1
+	for i := to - 1; i > from; i-- {
+		if !unicode.IsSpace(runes[i]) {
+			continue
+		}
+		if runes[i] == '\n' && runes[i-1] == '\n' {
+			return i + 1
+		}
+		if sentence < 0 && strings.ContainsRune(".!?", runes[i-1]) {
+			sentence = i + 1
+		}
+		if word < 0 {
+			word = i + 1
+		}
+	}
+
+	switch {
+	case sentence >= 0:
+		return sentence
+	case word >= 0:
+		return word
+	default:
+		return to
+	}
+}
+
+// cosineSimilarity returns the cosine of the angle between a and b, which
+// must have the same length, or 0 if either is a zero vector.
+func cosineSimilarity(a, b []float32) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		x, y := float64(a[i]), float64(b[i])
+		dot += x * y
+		na += x * x
+		nb += y * y
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
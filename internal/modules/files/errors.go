@@ -0,0 +1,27 @@
+package files
+
+import "errors"
+
+// ErrNotFound is returned when a file or one of its derived objects does not exist.
+var ErrNotFound = errors.New("not found")
+
+// ErrTooLarge is returned when content exceeds a size limit of the requested operation.
+var ErrTooLarge = errors.New("content too large")
+
+// ErrRangeNotSatisfiable is returned when a requested byte range lies outside the content.
+var ErrRangeNotSatisfiable = errors.New("range not satisfiable")
+
+// ErrInvalid is returned when user-supplied values, such as tags or metadata, are not acceptable.
+var ErrInvalid = errors.New("invalid input")
+
+// ErrPreconditionRequired is returned when a conditional update is attempted without a precondition.
+var ErrPreconditionRequired = errors.New("precondition required")
+
+// ErrPreconditionFailed is returned when a file changed since the version the caller based an update on.
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// ErrUnavailable is returned when an operation depends on a feature that is not configured.
+var ErrUnavailable = errors.New("unavailable")
+
+// ErrBudgetExceeded is returned when the daily budget for AI calls has been spent.
+var ErrBudgetExceeded = errors.New("budget exceeded")
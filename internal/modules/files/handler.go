@@ -1,8 +1,18 @@
 package files
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/labstack/echo/v4"
 )
@@ -16,39 +26,292 @@ func NewFileHandler(svc service) *FileHandler {
 }
 
 func (h *FileHandler) ListFiles(c echo.Context) error {
-	files, err := h.svc.ListFiles(c.Request().Context())
+	filter, err := parseListFilter(c)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return err
+	}
+
+	files, err := h.svc.ListFiles(c.Request().Context(), filter)
+	if err != nil {
+		return httpError(err)
 	}
 
 	return c.JSON(http.StatusOK, files)
 }
 
-func (h *FileHandler) UploadFile(c echo.Context) error {
-	fileHeader, err := c.FormFile("file")
+// SearchFiles runs a full-text search, narrowed by the list filters.
+func (h *FileHandler) SearchFiles(c echo.Context) error {
+	q := c.QueryParam("q")
+	if strings.TrimSpace(q) == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "query parameter 'q' is required")
+	}
+
+	filter, err := parseListFilter(c)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, "field 'file' is required")
+		return err
 	}
 
-	src, err := fileHeader.Open()
+	results, err := h.svc.SearchFiles(c.Request().Context(), q, filter)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "cannot open uploaded file")
+		return httpError(err)
 	}
-	defer src.Close()
 
-	contentType := fileHeader.Header.Get("Content-Type")
-	if contentType == "" {
-		contentType = "application/octet-stream"
+	return c.JSON(http.StatusOK, results)
+}
+
+// SemanticSearch finds files similar in meaning to a query, narrowed by the
+// list filters.
+func (h *FileHandler) SemanticSearch(c echo.Context) error {
+	q := c.QueryParam("q")
+	if strings.TrimSpace(q) == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "query parameter 'q' is required")
 	}
 
-	f, err := h.svc.UploadFile(c.Request().Context(), fileHeader.Filename, src, fileHeader.Size, contentType)
+	filter, err := parseListFilter(c)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return err
+	}
+
+	results, err := h.svc.SemanticSearch(c.Request().Context(), q, filter)
+	if err != nil {
+		return httpError(err)
+	}
+
+	return c.JSON(http.StatusOK, results)
+}
+
+// parseListFilter reads the filters shared by the list and search endpoints.
+func parseListFilter(c echo.Context) (ListFilter, error) {
+	var filter ListFilter
+	var err error
+	if v := c.QueryParam("include_deleted"); v != "" {
+		filter.IncludeDeleted, err = strconv.ParseBool(v)
+		if err != nil {
+			return filter, echo.NewHTTPError(http.StatusBadRequest, "invalid include_deleted flag")
+		}
+	}
+	if v := c.QueryParam("folder_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id < 0 {
+			return filter, echo.NewHTTPError(http.StatusBadRequest, "invalid folder_id")
+		}
+		filter.FolderID = &id
+	}
+	filter.Limit, filter.Offset, err = parsePage(c)
+	if err != nil {
+		return filter, err
+	}
+	filter.Tags = parseTags(c.QueryParams()["tags"])
+	filter.Metadata = parseMetadata(c.QueryParams())
+
+	return filter, nil
+}
+
+func (h *FileHandler) UploadFile(c echo.Context) error {
+	u, err := formUpload(c)
+	if err != nil {
+		return err
+	}
+	defer u.src.Close()
+
+	f, err := h.svc.UploadFile(c.Request().Context(), u.header.Filename, u.src, u.header.Size, u.contentType, u.opts)
+	if err != nil {
+		return httpError(err)
 	}
 
 	return c.JSON(http.StatusCreated, f)
 }
 
+// maxPatchSize caps the body of a PATCH request.
+const maxPatchSize = 1 << 20
+
+func (h *FileHandler) GetFile(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid file id")
+	}
+
+	f, err := h.svc.GetFile(c.Request().Context(), id)
+	if err != nil {
+		return httpError(err)
+	}
+
+	c.Response().Header().Set("ETag", f.ETag())
+	return c.JSON(http.StatusOK, f)
+}
+
+// PatchFile applies a JSON Merge Patch to a file. The If-Match header must
+// carry the file's current ETag.
+func (h *FileHandler) PatchFile(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid file id")
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	if mediaType != "application/merge-patch+json" && mediaType != echo.MIMEApplicationJSON {
+		return echo.NewHTTPError(http.StatusUnsupportedMediaType, "content type must be application/merge-patch+json")
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request().Body, maxPatchSize+1))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "cannot read request body")
+	}
+	if len(body) > maxPatchSize {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "patch too large")
+	}
+
+	patch, err := DecodeMergePatch(body)
+	if err != nil {
+		return httpError(err)
+	}
+
+	f, err := h.svc.UpdateFile(c.Request().Context(), id, c.Request().Header.Get("If-Match"), patch)
+	if err != nil {
+		return httpError(err)
+	}
+
+	c.Response().Header().Set("ETag", f.ETag())
+	return c.JSON(http.StatusOK, f)
+}
+
+func (h *FileHandler) UpdateContent(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid file id")
+	}
+
+	u, err := formUpload(c)
+	if err != nil {
+		return err
+	}
+	defer u.src.Close()
+
+	f, err := h.svc.UpdateContent(c.Request().Context(), id, u.src, u.header.Size, u.contentType, u.opts)
+	if err != nil {
+		return httpError(err)
+	}
+
+	return c.JSON(http.StatusOK, f)
+}
+
+func (h *FileHandler) ListVersions(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid file id")
+	}
+
+	versions, err := h.svc.ListVersions(c.Request().Context(), id)
+	if err != nil {
+		return httpError(err)
+	}
+
+	return c.JSON(http.StatusOK, versions)
+}
+
+func (h *FileHandler) RestoreVersion(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid file id")
+	}
+
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil || version < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid version")
+	}
+
+	f, err := h.svc.RestoreVersion(c.Request().Context(), id, version)
+	if err != nil {
+		return httpError(err)
+	}
+
+	return c.JSON(http.StatusOK, f)
+}
+
+func (h *FileHandler) ListTranslations(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid file id")
+	}
+
+	translations, err := h.svc.ListTranslations(c.Request().Context(), id)
+	if err != nil {
+		return httpError(err)
+	}
+
+	return c.JSON(http.StatusOK, translations)
+}
+
+func (h *FileHandler) GetTranslation(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid file id")
+	}
+
+	t, err := h.svc.GetTranslation(c.Request().Context(), id, c.Param("lang"))
+	if err != nil {
+		return httpError(err)
+	}
+
+	return c.JSON(http.StatusOK, t)
+}
+
+// upload is a file received as multipart/form-data field "file".
+type upload struct {
+	header      *multipart.FileHeader
+	src         multipart.File
+	contentType string
+	opts        UploadOptions
+}
+
+// formUpload opens the uploaded file and parses the upload options. The
+// caller must close src.
+func formUpload(c echo.Context) (*upload, error) {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "field 'file' is required")
+	}
+
+	u := &upload{header: fileHeader}
+
+	u.contentType = fileHeader.Header.Get("Content-Type")
+	if u.contentType == "" {
+		u.contentType = "application/octet-stream"
+	}
+
+	if v := c.FormValue("strip_metadata"); v != "" {
+		u.opts.StripMetadata, err = strconv.ParseBool(v)
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "invalid strip_metadata flag")
+		}
+	}
+
+	if v := c.FormValue("folder_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id < 0 {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "invalid folder_id")
+		}
+		if id != 0 {
+			u.opts.FolderID = &id
+		}
+	}
+
+	form, err := c.FormParams()
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "invalid form")
+	}
+	u.opts.Tags = parseTags(form["tags"])
+	u.opts.Metadata = parseMetadata(form)
+	u.opts.TargetLanguages = parseTags(form["target_languages"])
+
+	u.src, err = fileHeader.Open()
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "cannot open uploaded file")
+	}
+
+	return u, nil
+}
+
 func (h *FileHandler) DeleteFile(c echo.Context) error {
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
@@ -56,27 +319,527 @@ func (h *FileHandler) DeleteFile(c echo.Context) error {
 	}
 
 	if err := h.svc.DeleteFile(c.Request().Context(), id); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return httpError(err)
 	}
 
 	return c.NoContent(http.StatusNoContent)
 }
 
+func (h *FileHandler) ListTrash(c echo.Context) error {
+	files, err := h.svc.ListTrash(c.Request().Context())
+	if err != nil {
+		return httpError(err)
+	}
+
+	return c.JSON(http.StatusOK, files)
+}
+
+func (h *FileHandler) RestoreFile(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid file id")
+	}
+
+	f, err := h.svc.RestoreFile(c.Request().Context(), id)
+	if err != nil {
+		return httpError(err)
+	}
+
+	return c.JSON(http.StatusOK, f)
+}
+
+func (h *FileHandler) PurgeFile(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid file id")
+	}
+
+	if err := h.svc.PurgeFile(c.Request().Context(), id); err != nil {
+		return httpError(err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+type analyzeRequest struct {
+	Type           string `json:"type"`
+	Prompt         string `json:"prompt"`
+	PromptVersion  int    `json:"prompt_version"`
+	TargetLanguage string `json:"target_language"`
+	Force          bool   `json:"force"`
+	Stream         bool   `json:"stream"`
+}
+
+// AnalyzeFile runs the analysis described by the optional JSON body, a
+// summary with the built-in prompt by default. A cached result is returned
+// unless the body or the force query parameter sets force. The analysis
+// runs as a background job: the response is the queued job, 202 Accepted
+// with its Location. When the request sets "stream" or only accepts
+// text/event-stream, the analysis runs in the request instead and its
+// output is streamed as server-sent events: "delta" events carry pieces of
+// the output, then a "done" event carries the recorded analysis, or an
+// "error" event the failure.
 func (h *FileHandler) AnalyzeFile(c echo.Context) error {
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, "invalid file id")
 	}
 
-	f, err := h.svc.AnalyzeFile(c.Request().Context(), id)
+	body, err := io.ReadAll(io.LimitReader(c.Request().Body, maxJSONBodySize+1))
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return echo.NewHTTPError(http.StatusBadRequest, "cannot read request body")
+	}
+	if len(body) > maxJSONBodySize {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "request too large")
 	}
 
-	err = c.JSON(http.StatusOK, f)
+	var req analyzeRequest
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+		}
+	}
+
+	if v := c.QueryParam("force"); v != "" {
+		force, err := strconv.ParseBool(v)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid force")
+		}
+		req.Force = req.Force || force
+	}
+
+	opts := AnalysisOptions{
+		Type:           req.Type,
+		Prompt:         req.Prompt,
+		PromptVersion:  req.PromptVersion,
+		TargetLanguage: req.TargetLanguage,
+		Force:          req.Force,
+	}
+
+	if !req.Stream && !acceptsEventStream(c) {
+		job, err := h.svc.SubmitAnalysis(c.Request().Context(), id, opts)
+		if err != nil {
+			return httpError(err)
+		}
+
+		c.Response().Header().Set(echo.HeaderLocation, "/api/jobs/"+strconv.FormatInt(job.ID, 10))
+		return c.JSON(http.StatusAccepted, job)
+	}
+
+	events := &eventStream{res: c.Response()}
+	opts.Stream = func(delta string) error {
+		return events.send("delta", map[string]string{"text": delta})
+	}
+	a, err := h.svc.AnalyzeFile(c.Request().Context(), id, opts)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return events.fail(err)
+	}
+
+	return events.send("done", a)
+}
+
+// maxBatchBodySize caps the body of a batch analyze request, which can
+// list thousands of file IDs.
+const maxBatchBodySize = 1 << 20
+
+type analyzeBatchRequest struct {
+	IDs            []int64 `json:"ids"`
+	Type           string  `json:"type"`
+	Prompt         string  `json:"prompt"`
+	PromptVersion  int     `json:"prompt_version"`
+	TargetLanguage string  `json:"target_language"`
+	Force          bool    `json:"force"`
+}
+
+// AnalyzeBatch queues the analysis described by the JSON body for many
+// files as one background job: the files listed in "ids", or else the
+// files matching the list filters of the query. The response is the
+// queued job, 202 Accepted with its Location.
+func (h *FileHandler) AnalyzeBatch(c echo.Context) error {
+	filter, err := parseListFilter(c)
+	if err != nil {
+		return err
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request().Body, maxBatchBodySize+1))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "cannot read request body")
+	}
+	if len(body) > maxBatchBodySize {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "request too large")
+	}
+
+	var req analyzeBatchRequest
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+		}
+	}
+
+	job, err := h.svc.SubmitAnalysisBatch(c.Request().Context(), BatchOptions{
+		IDs:    req.IDs,
+		Filter: filter,
+		Analysis: AnalysisOptions{
+			Type:           req.Type,
+			Prompt:         req.Prompt,
+			PromptVersion:  req.PromptVersion,
+			TargetLanguage: req.TargetLanguage,
+			Force:          req.Force,
+		},
+	})
+	if err != nil {
+		return httpError(err)
+	}
+
+	c.Response().Header().Set(echo.HeaderLocation, "/api/jobs/"+strconv.FormatInt(job.ID, 10))
+	return c.JSON(http.StatusAccepted, job)
+}
+
+// ListAnalyses returns the analysis history of a file, optionally of one
+// type.
+func (h *FileHandler) ListAnalyses(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid file id")
+	}
+
+	filter := AnalysisFilter{Type: c.QueryParam("type")}
+	filter.Limit, filter.Offset, err = parsePage(c)
+	if err != nil {
+		return err
+	}
+
+	analyses, err := h.svc.ListAnalyses(c.Request().Context(), id, filter)
+	if err != nil {
+		return httpError(err)
+	}
+
+	return c.JSON(http.StatusOK, analyses)
+}
+
+// AnalysisCacheStats reports the hit rate of the analysis cache, over the
+// analyses recorded since the optional since query parameter (RFC 3339).
+func (h *FileHandler) AnalysisCacheStats(c echo.Context) error {
+	var since *time.Time
+	if v := c.QueryParam("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid since, expected RFC 3339")
+		}
+		since = &t
+	}
+
+	stats, err := h.svc.AnalysisCacheStats(c.Request().Context(), since)
+	if err != nil {
+		return httpError(err)
+	}
+
+	return c.JSON(http.StatusOK, stats)
+}
+
+// maxJSONBodySize caps the JSON body of ask and analyze requests.
+const maxJSONBodySize = 64 << 10
+
+type askRequest struct {
+	Question string `json:"question"`
+	Stream   bool   `json:"stream"`
+}
+
+// AskFile answers a question about a file. The answer is streamed as
+// server-sent events when the request sets "stream" or only accepts
+// text/event-stream: "delta" events carry pieces of the answer, then a
+// "done" event carries the whole answer with its citations, or an "error"
+// event the failure.
+func (h *FileHandler) AskFile(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid file id")
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request().Body, maxJSONBodySize+1))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "cannot read request body")
+	}
+	if len(body) > maxJSONBodySize {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "request too large")
+	}
+
+	var req askRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+	if strings.TrimSpace(req.Question) == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "question is required")
+	}
+
+	if !req.Stream && !acceptsEventStream(c) {
+		a, err := h.svc.AskFile(c.Request().Context(), id, req.Question, nil)
+		if err != nil {
+			return httpError(err)
+		}
+		return c.JSON(http.StatusOK, a)
+	}
+
+	events := &eventStream{res: c.Response()}
+	a, err := h.svc.AskFile(c.Request().Context(), id, req.Question, func(delta string) error {
+		return events.send("delta", map[string]string{"text": delta})
+	})
+	if err != nil {
+		return events.fail(err)
+	}
+
+	return events.send("done", a)
+}
+
+func (h *FileHandler) GetThumbnail(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid file id")
+	}
+
+	size := 0
+	if v := c.QueryParam("size"); v != "" {
+		size, err = strconv.Atoi(v)
+		if err != nil || size < 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid thumbnail size")
+		}
+	}
+
+	rd, rc, err := h.svc.GetThumbnail(c.Request().Context(), id, size)
+	if err != nil {
+		return httpError(err)
+	}
+	defer rc.Close()
+
+	c.Response().Header().Set(echo.HeaderContentLength, strconv.FormatInt(rd.ByteSize, 10))
+	c.Response().Header().Set("Cache-Control", "public, max-age=86400")
+	return c.Stream(http.StatusOK, rd.MimeType, rc)
+}
+
+func (h *FileHandler) GetTranscript(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid file id")
+	}
+
+	t, err := h.svc.GetTranscript(c.Request().Context(), id)
+	if err != nil {
+		return httpError(err)
+	}
+
+	return c.JSON(http.StatusOK, t)
+}
+
+func (h *FileHandler) GetPIIReport(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid file id")
+	}
+
+	report, err := h.svc.GetPIIReport(c.Request().Context(), id)
+	if err != nil {
+		return httpError(err)
+	}
+
+	return c.JSON(http.StatusOK, report)
+}
+
+func (h *FileHandler) GetRedacted(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid file id")
+	}
+
+	rd, rc, err := h.svc.GetRedacted(c.Request().Context(), id)
+	if err != nil {
+		return httpError(err)
+	}
+	defer rc.Close()
+
+	c.Response().Header().Set(echo.HeaderContentLength, strconv.FormatInt(rd.ByteSize, 10))
+	c.Response().Header().Set("Cache-Control", "no-cache")
+	return c.Stream(http.StatusOK, rd.MimeType, rc)
+}
+
+func (h *FileHandler) DownloadFile(c echo.Context) error {
+	return h.download(c, 0)
+}
+
+func (h *FileHandler) DownloadVersion(c echo.Context) error {
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil || version < 1 {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid version")
+	}
+
+	return h.download(c, version)
+}
+
+// download streams the current content of a file, or the given version.
+func (h *FileHandler) download(c echo.Context, version int) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid file id")
 	}
 
-	return nil
+	rng, err := parseRange(c.Request().Header.Get("Range"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	accept := parseAcceptEncoding(c.Request().Header.Get(echo.HeaderAcceptEncoding))
+
+	d, err := h.svc.DownloadFile(c.Request().Context(), id, version, rng, accept)
+	if errors.Is(err, ErrRangeNotSatisfiable) && d != nil {
+		c.Response().Header().Set("Content-Range", fmt.Sprintf("bytes */%d", d.File.Size))
+	}
+	if err != nil {
+		return httpError(err)
+	}
+	defer d.Content.Close()
+
+	header := c.Response().Header()
+	header.Set("Accept-Ranges", "bytes")
+	header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": d.File.Name}))
+	header.Add(echo.HeaderVary, echo.HeaderAcceptEncoding)
+	if d.Encoding != "" {
+		header.Set(echo.HeaderContentEncoding, d.Encoding)
+	}
+	if d.Length >= 0 {
+		header.Set(echo.HeaderContentLength, strconv.FormatInt(d.Length, 10))
+	}
+
+	status := http.StatusOK
+	if d.Partial {
+		header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", d.Offset, d.Offset+d.Length-1, d.File.Size))
+		status = http.StatusPartialContent
+	}
+
+	return c.Stream(status, d.File.MimeType, d.Content)
+}
+
+// maxPageSize caps the limit query parameter of paginated lists.
+const maxPageSize = 1000
+
+// parsePage reads the limit and offset query parameters of a paginated list.
+// A missing limit means no limit.
+func parsePage(c echo.Context) (limit, offset int, err error) {
+	if v := c.QueryParam("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return 0, 0, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxPageSize))
+		}
+	}
+	if v := c.QueryParam("offset"); v != "" {
+		offset, err = strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return 0, 0, echo.NewHTTPError(http.StatusBadRequest, "invalid offset")
+		}
+	}
+	return limit, offset, nil
+}
+
+// parseTags splits tags given as repeated and/or comma-separated values.
+func parseTags(values []string) []string {
+	var tags []string
+	for _, v := range values {
+		for _, tag := range strings.Split(v, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// parseMetadata collects the metadata[<key>]=<value> parameters. A repeated
+// key keeps its last value.
+func parseMetadata(values url.Values) map[string]string {
+	var metadata map[string]string
+	for name, vs := range values {
+		key, ok := strings.CutPrefix(name, "metadata[")
+		if !ok || !strings.HasSuffix(key, "]") || len(vs) == 0 {
+			continue
+		}
+		if metadata == nil {
+			metadata = make(map[string]string)
+		}
+		metadata[strings.TrimSuffix(key, "]")] = vs[len(vs)-1]
+	}
+	return metadata
+}
+
+// parseAcceptEncoding returns the content codings the client accepts, in
+// header order, skipping those explicitly refused with q=0.
+func parseAcceptEncoding(header string) []string {
+	var encodings []string
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "" || coding == "*" {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				continue
+			}
+		}
+		encodings = append(encodings, coding)
+	}
+	return encodings
+}
+
+// parseRange parses a single-range "bytes=" Range header. It returns nil for
+// an empty header and for multi-range requests, which are served in full.
+func parseRange(header string) (*ByteRange, error) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return nil, nil
+	}
+
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return nil, errors.New("invalid range header")
+	}
+
+	rng := &ByteRange{Start: -1, End: -1}
+	var err error
+	if first != "" {
+		if rng.Start, err = strconv.ParseInt(first, 10, 64); err != nil || rng.Start < 0 {
+			return nil, errors.New("invalid range header")
+		}
+	}
+	if last != "" {
+		if rng.End, err = strconv.ParseInt(last, 10, 64); err != nil || rng.End < 0 {
+			return nil, errors.New("invalid range header")
+		}
+	}
+	if first == "" && last == "" {
+		return nil, errors.New("invalid range header")
+	}
+
+	return rng, nil
+}
+
+// httpError maps service errors to HTTP errors.
+func httpError(err error) error {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrInvalid):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	case errors.Is(err, ErrPreconditionRequired):
+		return echo.NewHTTPError(http.StatusPreconditionRequired, err.Error())
+	case errors.Is(err, ErrPreconditionFailed):
+		return echo.NewHTTPError(http.StatusPreconditionFailed, err.Error())
+	case errors.Is(err, ErrTooLarge):
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, err.Error())
+	case errors.Is(err, ErrRangeNotSatisfiable):
+		return echo.NewHTTPError(http.StatusRequestedRangeNotSatisfiable, err.Error())
+	case errors.Is(err, ErrUnavailable):
+		return echo.NewHTTPError(http.StatusServiceUnavailable, err.Error())
+	case errors.Is(err, ErrBudgetExceeded):
+		return echo.NewHTTPError(http.StatusTooManyRequests, err.Error())
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
 }
@@ -0,0 +1,80 @@
+package files
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/mamed-gasimov/file-service/internal/modules/jobs"
+)
+
+// jobQueue is the part of the jobs module background analyses, thumbnails
+// and personal data scans are submitted to.
+type jobQueue interface {
+	Submit(ctx context.Context, typ string, fileID *int64, params any, opts ...jobs.SubmitOption) (*jobs.Job, error)
+}
+
+// analysisJobParams are the parameters of an analyze job.
+type analysisJobParams struct {
+	Type           string `json:"type,omitempty"`
+	Prompt         string `json:"prompt,omitempty"`
+	PromptVersion  int    `json:"prompt_version,omitempty"`
+	TargetLanguage string `json:"target_language,omitempty"`
+	Force          bool   `json:"force,omitempty"`
+}
+
+// SubmitAnalysis queues an analysis of a file as a job. The file, prompt
+// and budget are checked first, so a job is only created for an analysis
+// that can run.
+func (s *FileService) SubmitAnalysis(ctx context.Context, id int64, opts AnalysisOptions) (*jobs.Job, error) {
+	if s.jobs == nil {
+		return nil, fmt.Errorf("background jobs are not configured: %w", ErrUnavailable)
+	}
+
+	if _, _, err := s.prepareAnalysis(ctx, id, opts); err != nil {
+		return nil, err
+	}
+	if err := s.checkBudget(ctx); err != nil {
+		return nil, err
+	}
+
+	job, err := s.jobs.Submit(ctx, jobs.TypeAnalyze, &id, analysisJobParams{
+		Type:           opts.Type,
+		Prompt:         opts.Prompt,
+		PromptVersion:  opts.PromptVersion,
+		TargetLanguage: opts.TargetLanguage,
+		Force:          opts.Force,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("submit analysis: %w", err)
+	}
+
+	return job, nil
+}
+
+// RunAnalysisJob is the jobs.Handler of analyze jobs. Its result is the
+// recorded analysis. Errors retrying cannot fix, such as a deleted file or
+// a spent budget, fail the job right away.
+func (s *FileService) RunAnalysisJob(ctx context.Context, job *jobs.Job, p analysisJobParams, progress func(percent int)) (json.RawMessage, error) {
+	if job.FileID == nil {
+		return nil, jobs.Permanent(fmt.Errorf("analyze job %d has no file", job.ID))
+	}
+
+	a, err := s.AnalyzeFile(ctx, *job.FileID, AnalysisOptions{
+		Type:           p.Type,
+		Prompt:         p.Prompt,
+		PromptVersion:  p.PromptVersion,
+		TargetLanguage: p.TargetLanguage,
+		Force:          p.Force,
+		Progress:       progress,
+	})
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrInvalid) || errors.Is(err, ErrTooLarge) || errors.Is(err, ErrBudgetExceeded) {
+		return nil, jobs.Permanent(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(a)
+}
@@ -0,0 +1,59 @@
+package files
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Limits on user-defined labels.
+const (
+	maxTags        = 50
+	maxTagLen      = 64
+	maxMetadata    = 50
+	maxMetadataKey = 64
+	maxMetadataVal = 1024
+)
+
+// normalizeTags trims tags, drops duplicates and sorts them. It keeps a
+// non-nil result for a non-nil input, so an empty list still clears tags.
+func normalizeTags(tags []string) ([]string, error) {
+	out := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		switch {
+		case tag == "":
+			return nil, fmt.Errorf("empty tag: %w", ErrInvalid)
+		case len(tag) > maxTagLen:
+			return nil, fmt.Errorf("tag %q is longer than %d bytes: %w", tag, maxTagLen, ErrInvalid)
+		case strings.Contains(tag, ","):
+			return nil, fmt.Errorf("tag %q contains a comma: %w", tag, ErrInvalid)
+		}
+		out = append(out, tag)
+	}
+
+	slices.Sort(out)
+	out = slices.Compact(out)
+	if len(out) > maxTags {
+		return nil, fmt.Errorf("more than %d tags: %w", maxTags, ErrInvalid)
+	}
+
+	return out, nil
+}
+
+func validateMetadata(metadata map[string]string) error {
+	if len(metadata) > maxMetadata {
+		return fmt.Errorf("more than %d metadata keys: %w", maxMetadata, ErrInvalid)
+	}
+	for k, v := range metadata {
+		switch {
+		case k == "":
+			return fmt.Errorf("empty metadata key: %w", ErrInvalid)
+		case len(k) > maxMetadataKey:
+			return fmt.Errorf("metadata key %q is longer than %d bytes: %w", k, maxMetadataKey, ErrInvalid)
+		case len(v) > maxMetadataVal:
+			return fmt.Errorf("metadata value of %q is longer than %d bytes: %w", k, maxMetadataVal, ErrInvalid)
+		}
+	}
+	return nil
+}
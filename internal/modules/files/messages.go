@@ -1,17 +1,25 @@
 package files
 
-// AnalyzeRequest is published to "file.analyze" after every successful upload.
+// AnalyzeRequest is published to "file.analyze" after every successful upload
+// and every new content version. TargetLanguages lists the BCP 47 tags of
+// the languages to translate the summary into.
 type AnalyzeRequest struct {
-	FileID        int64  `json:"file_id"`
-	ObjectKey     string `json:"object_key"`
-	ContentType   string `json:"content_type"`
-	CorrelationID string `json:"correlation_id"`
+	FileID          int64    `json:"file_id"`
+	Version         int      `json:"version"`
+	ObjectKey       string   `json:"object_key"`
+	ContentType     string   `json:"content_type"`
+	TargetLanguages []string `json:"target_languages,omitempty"`
+	CorrelationID   string   `json:"correlation_id"`
 }
 
-// AnalysisReply is consumed from "file.analysis.result".
+// AnalysisReply is consumed from "file.analysis.result". Version echoes the
+// request; replies without it apply to the current version. Translations
+// maps the requested languages to the translated summary.
 type AnalysisReply struct {
-	FileID             int64  `json:"file_id"`
-	TranslationSummary string `json:"translation_summary"`
-	CorrelationID      string `json:"correlation_id"`
-	Error              string `json:"error"`
+	FileID             int64             `json:"file_id"`
+	Version            int               `json:"version"`
+	TranslationSummary string            `json:"translation_summary"`
+	Translations       map[string]string `json:"translations"`
+	CorrelationID      string            `json:"correlation_id"`
+	Error              string            `json:"error"`
 }
@@ -1,6 +1,15 @@
 package files
 
-import "time"
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/mamed-gasimov/file-service/internal/cache"
+	"github.com/mamed-gasimov/file-service/internal/pii"
+	"github.com/mamed-gasimov/file-service/internal/storage"
+)
 
 type File struct {
 	ID                 int64     `json:"id"`
@@ -12,4 +21,447 @@ type File struct {
 	UpdatedAt          time.Time `json:"updated_at"`
 	Resume             *string   `json:"resume"`
 	TranslationSummary *string   `json:"translation_summary"`
+	// Version is the number of the current content version, starting at 1.
+	// ContentHash is the hex SHA-256 of that content, nil for files stored
+	// before hashes were recorded.
+	Version     int     `json:"version"`
+	ContentHash *string `json:"content_hash"`
+	// Properties holds technical metadata extracted from the content, such
+	// as image dimensions, EXIF tags, PDF page count or audio duration.
+	Properties map[string]any `json:"properties"`
+	// Tags are user-defined labels, sorted by name. Metadata holds
+	// user-defined key/value pairs, such as a project or customer.
+	Tags     []string          `json:"tags"`
+	Metadata map[string]string `json:"metadata"`
+	// FolderID is the folder holding the file, nil for the root.
+	FolderID *int64 `json:"folder_id"`
+	// DeletedAt is set while the file is in the trash.
+	DeletedAt *time.Time `json:"deleted_at"`
+	// ContentEncoding is the compression applied at rest ("zstd"), nil if
+	// the content is stored as is. Size is always the original size;
+	// StoredSize is the number of bytes the content occupies in storage.
+	ContentEncoding *string `json:"content_encoding"`
+	StoredSize      int64   `json:"stored_size"`
+	// StorageInfo records how the object is encoded at rest. It is written
+	// on create and read by storage decorators, never exposed over the API.
+	StorageInfo storage.ObjectInfo `json:"-"`
+	// ExtractedText is the text of the content indexed for search. It is
+	// written on create but not read back with the file.
+	ExtractedText *string `json:"-"`
+}
+
+// ETag identifies the state of the file's record and content. It changes
+// whenever the file is updated or gets a new version.
+func (f *File) ETag() string {
+	return fmt.Sprintf(`"%d-%d"`, f.Version, f.UpdatedAt.UnixMicro())
+}
+
+// Version is a stored revision of a file's content. The file itself always
+// mirrors its newest version.
+type Version struct {
+	ID                 int64          `json:"id"`
+	FileID             int64          `json:"file_id"`
+	Version            int            `json:"version"`
+	Size               int64          `json:"size"`
+	MimeType           string         `json:"mime_type"`
+	ObjectKey          string         `json:"object_key"`
+	ContentHash        *string        `json:"content_hash"`
+	Properties         map[string]any `json:"properties"`
+	Resume             *string        `json:"resume"`
+	TranslationSummary *string        `json:"translation_summary"`
+	ContentEncoding    *string        `json:"content_encoding"`
+	StoredSize         int64          `json:"stored_size"`
+	CreatedAt          time.Time      `json:"created_at"`
+
+	StorageInfo storage.ObjectInfo `json:"-"`
+	// ExtractedText is indexed for search while the version is current. It
+	// is only set on new versions and is not kept per version.
+	ExtractedText *string `json:"-"`
+}
+
+// apply returns a copy of f describing version v instead of the current
+// content, so it can be downloaded like the file itself.
+func (v *Version) apply(f *File) *File {
+	c := *f
+	c.Version = v.Version
+	c.Size = v.Size
+	c.MimeType = v.MimeType
+	c.ObjectKey = v.ObjectKey
+	c.ContentHash = v.ContentHash
+	c.Properties = v.Properties
+	c.Resume = v.Resume
+	c.TranslationSummary = v.TranslationSummary
+	c.ContentEncoding = v.ContentEncoding
+	c.StoredSize = v.StoredSize
+	return &c
+}
+
+// ListFilter narrows the files returned by ListFiles.
+type ListFilter struct {
+	// IncludeDeleted also returns files that are in the trash.
+	IncludeDeleted bool
+	// FolderID restricts the list to one folder, 0 being the root. Nil
+	// lists files in every folder.
+	FolderID *int64
+	// Limit caps the number of files returned (0 means no limit), after
+	// skipping Offset files.
+	Limit  int
+	Offset int
+	// Tags keeps files carrying every one of these tags. Metadata keeps
+	// files whose metadata contains every one of these key/value pairs.
+	Tags     []string
+	Metadata map[string]string
+}
+
+// SearchHit is a file matching a search query. Snippet holds fragments of
+// the matching text with the matched words wrapped in <mark> and </mark>;
+// the text itself is not HTML-escaped.
+type SearchHit struct {
+	File    File    `json:"file"`
+	Rank    float64 `json:"rank"`
+	Snippet string  `json:"snippet"`
+}
+
+// SearchResults is one page of search hits, best match first. Total counts
+// all hits.
+type SearchResults struct {
+	Hits   []SearchHit `json:"hits"`
+	Total  int         `json:"total"`
+	Limit  int         `json:"limit"`
+	Offset int         `json:"offset"`
+}
+
+// Chunk is a piece of a file's text and its embedding. Start and End are
+// the character offsets of the piece in the text, End being exclusive.
+type Chunk struct {
+	Index     int
+	Start     int
+	End       int
+	Content   string
+	Embedding []float32
+}
+
+// ChunkMatch is a chunk similar to a semantic search query. Score is the
+// cosine similarity of the chunk and the query, between -1 and 1.
+type ChunkMatch struct {
+	FileID  int64   `json:"-"`
+	Index   int     `json:"index"`
+	Start   int     `json:"start"`
+	End     int     `json:"end"`
+	Content string  `json:"content"`
+	Score   float64 `json:"score"`
+}
+
+// SemanticHit is a file with the chunks most similar to a semantic search
+// query, best first. Score is that of its best chunk.
+type SemanticHit struct {
+	File   File         `json:"file"`
+	Score  float64      `json:"score"`
+	Chunks []ChunkMatch `json:"chunks"`
+}
+
+// SemanticResults is one page of semantic search hits, best first.
+type SemanticResults struct {
+	Hits   []SemanticHit `json:"hits"`
+	Limit  int           `json:"limit"`
+	Offset int           `json:"offset"`
+}
+
+// Analysis is the stored result of analyzing a version of a file. Output is
+// a JSON string for summaries and a JSON object for structured types.
+// InputHash is the hex SHA-256 of the text sent to the model.
+type Analysis struct {
+	ID      int64  `json:"id"`
+	FileID  int64  `json:"file_id"`
+	Version int    `json:"version"`
+	Type    string `json:"type"`
+	Model   string `json:"model"`
+	// PromptName is the prompt template used, nil for the built-in prompt.
+	// PromptVersion is the template's version number, or the version of the
+	// built-in prompt, such as "summary-v2".
+	PromptName    *string         `json:"prompt_name"`
+	PromptVersion string          `json:"prompt_version"`
+	InputHash     string          `json:"input_hash"`
+	Output        json.RawMessage `json:"output"`
+	InputTokens   int             `json:"input_tokens"`
+	OutputTokens  int             `json:"output_tokens"`
+	LatencyMs     int             `json:"latency_ms"`
+	// Cached is set when the output was reused from an earlier analysis of
+	// the same content; no tokens were spent on it.
+	Cached    bool      `json:"cached"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AnalysisCacheKey identifies reusable analysis results: the same content
+// analyzed with the same type, model and prompt. PromptVersion names the
+// template and version, and PromptHash is the SHA-256 of the rendered
+// instructions, which vary with the file name or target language.
+type AnalysisCacheKey struct {
+	ContentHash   string
+	Type          string
+	Model         string
+	PromptVersion string
+	PromptHash    string
+}
+
+// CachedAnalysis is a provider result stored for reuse. Model is the model
+// that produced it.
+type CachedAnalysis struct {
+	Model        string
+	InputHash    string
+	Output       json.RawMessage
+	InputTokens  int
+	OutputTokens int
+}
+
+// AnalysisCacheStats reports how often analyses were served from the cache
+// since Since (all time when nil). Entries counts the cached results and
+// Memory describes the in-process cache, nil when it is disabled.
+type AnalysisCacheStats struct {
+	Since    *time.Time          `json:"since"`
+	Entries  int                 `json:"entries"`
+	Requests int                 `json:"requests"`
+	Hits     int                 `json:"hits"`
+	HitRate  float64             `json:"hit_rate"`
+	Types    []AnalysisTypeStats `json:"types"`
+	Memory   *cache.Stats        `json:"memory"`
+}
+
+// AnalysisTypeStats reports cache hits of one analysis type.
+type AnalysisTypeStats struct {
+	Type     string  `json:"type"`
+	Requests int     `json:"requests"`
+	Hits     int     `json:"hits"`
+	HitRate  float64 `json:"hit_rate"`
+}
+
+// AnalysisOptions selects the analysis run by AnalyzeFile.
+type AnalysisOptions struct {
+	// Type is the kind of analysis, a summary when empty. It defaults to the
+	// type of Prompt when that is set.
+	Type string
+	// Prompt names a prompt template to use instead of the built-in prompt,
+	// at PromptVersion or, when that is 0, its latest version.
+	Prompt        string
+	PromptVersion int
+	// TargetLanguage is passed to the prompt, asking for output in that
+	// language.
+	TargetLanguage string
+	// Force runs the analysis even when a cached result exists.
+	Force bool
+	// Stream, when non-nil, receives the output piece by piece as it is
+	// generated, or whole when it comes from the cache.
+	Stream func(delta string) error
+	// Progress, when non-nil, is told the percentage of the analysis done.
+	Progress func(percent int)
+}
+
+// BatchOptions selects the files and the analysis of a batch analysis.
+type BatchOptions struct {
+	// IDs lists the files to analyze. When it is empty, the files matching
+	// Filter are analyzed instead.
+	IDs    []int64
+	Filter ListFilter
+	// Analysis is the analysis run on every file.
+	Analysis AnalysisOptions
+	// Since skips the files that already have an analysis of the type
+	// recorded at or after a time, such as by an interrupted run of the
+	// same batch.
+	Since *time.Time
+	// Progress, when non-nil, is told how many of the files are done.
+	Progress func(done, total int)
+}
+
+// BatchResult counts the outcomes of a batch analysis: files analyzed by
+// the model, answered from the cache, skipped as already analyzed, and
+// failed, with the errors of the first failures.
+type BatchResult struct {
+	Total    int          `json:"total"`
+	Analyzed int          `json:"analyzed"`
+	Cached   int          `json:"cached"`
+	Skipped  int          `json:"skipped"`
+	Failed   int          `json:"failed"`
+	Errors   []BatchError `json:"errors"`
+}
+
+// BatchError is why the analysis of one file of a batch failed.
+type BatchError struct {
+	FileID int64  `json:"file_id"`
+	Error  string `json:"error"`
+}
+
+// AnalysisFilter narrows the analyses returned by ListAnalyses.
+type AnalysisFilter struct {
+	// Type keeps analyses of one type; empty keeps every type.
+	Type string
+	// Since keeps analyses recorded at or after a time.
+	Since *time.Time
+	// Limit caps the number of analyses returned (0 means no limit), after
+	// skipping Offset analyses.
+	Limit  int
+	Offset int
+}
+
+// Answer is the answer to a question about a file. Citations are the
+// passages of the file's text the answer cites, in the order first cited.
+type Answer struct {
+	FileID    int64      `json:"file_id"`
+	Question  string     `json:"question"`
+	Answer    string     `json:"answer"`
+	Citations []Citation `json:"citations"`
+}
+
+// Citation is a passage of a file's text that an answer cites as [Source].
+// Start and End are the character offsets of the passage in the text, End
+// being exclusive.
+type Citation struct {
+	Source  int    `json:"source"`
+	Index   int    `json:"chunk_index"`
+	Start   int    `json:"start"`
+	End     int    `json:"end"`
+	Content string `json:"content"`
+}
+
+// FilePatch is a decoded JSON Merge Patch of a file's editable fields. Nil
+// fields are left unchanged.
+type FilePatch struct {
+	Name     *string
+	MimeType *string
+	// Tags replaces the tags of the file when non-nil.
+	Tags []string
+	// Metadata is merged into the file's metadata; keys mapped to nil are
+	// removed. ReplaceMetadata clears the existing metadata first.
+	Metadata        map[string]*string
+	ReplaceMetadata bool
+}
+
+// UploadOptions controls optional processing of an upload.
+type UploadOptions struct {
+	// StripMetadata removes EXIF and XMP metadata (GPS position, device
+	// serials) from JPEG, PNG and WebP images before they are stored.
+	StripMetadata bool
+	// FolderID places a new file in a folder instead of the root.
+	FolderID *int64
+	// Tags and Metadata label a new file.
+	Tags     []string
+	Metadata map[string]string
+	// TargetLanguages are the languages, as BCP 47 tags, to translate the
+	// summary of the content into. Without them, the configured default
+	// languages are used.
+	TargetLanguages []string
+}
+
+// Translation is the summary of a file version translated into Language,
+// a BCP 47 tag such as "de" or "pt-BR".
+type Translation struct {
+	FileID    int64     `json:"file_id"`
+	Version   int       `json:"version"`
+	Language  string    `json:"language"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Rendition is an object derived from a file, such as a thumbnail.
+type Rendition struct {
+	ID        int64     `json:"id"`
+	FileID    int64     `json:"file_id"`
+	Kind      string    `json:"kind"`
+	Size      int       `json:"size"`
+	Width     int       `json:"width"`
+	Height    int       `json:"height"`
+	MimeType  string    `json:"mime_type"`
+	ByteSize  int64     `json:"byte_size"`
+	ObjectKey string    `json:"object_key"`
+	CreatedAt time.Time `json:"created_at"`
+
+	StorageInfo storage.ObjectInfo `json:"-"`
+}
+
+// Rendition kinds. A redacted rendition is the text of a file with its
+// personal data replaced, and a transcript the text of a recording with
+// timestamps.
+const (
+	RenditionThumbnail  = "thumbnail"
+	RenditionRedacted   = "redacted"
+	RenditionTranscript = "transcript"
+)
+
+// PIIReport is the personal data found in the text of a file version, with
+// the number of findings per type. ScannedAt is nil until the version has
+// been scanned.
+type PIIReport struct {
+	FileID    int64            `json:"file_id"`
+	Version   int              `json:"version"`
+	ScannedAt *time.Time       `json:"scanned_at"`
+	Counts    map[pii.Type]int `json:"counts"`
+	Findings  []pii.Finding    `json:"findings"`
+}
+
+// File statuses. A file is marked deleting before its objects are removed,
+// so a delete interrupted half-way can be finished by the reaper.
+const (
+	StatusActive   = "active"
+	StatusDeleting = "deleting"
+)
+
+// ObjectRef is a database row that references a storage object: a file's
+// current content, one of its older versions when VersionID is set, or one
+// of its renditions when RenditionID is set.
+type ObjectRef struct {
+	FileID      int64
+	VersionID   int64
+	RenditionID int64
+	ObjectKey   string
+	Status      string
+}
+
+// ReconcileReport lists the inconsistencies found between the database and
+// the bucket. OrphanObjects are stored objects no row references;
+// MissingObjects are object keys referenced by rows but absent from the
+// bucket.
+type ReconcileReport struct {
+	OrphanObjects  []string `json:"orphan_objects"`
+	MissingObjects []string `json:"missing_objects"`
+	Cleaned        bool     `json:"cleaned"`
+}
+
+// Download is an open file download. Content is encoded with Encoding (for
+// example "zstd" or "gzip"), or sent as is when Encoding is empty. When a
+// range was requested, Content holds Length bytes starting at Offset.
+type Download struct {
+	File     *File
+	Content  io.ReadCloser
+	Encoding string
+	Offset   int64
+	Length   int64
+	Partial  bool
+}
+
+// ByteRange is a single HTTP byte range. End is inclusive and -1 means
+// through the end of the file; a Start of -1 requests the last End bytes.
+type ByteRange struct {
+	Start int64
+	End   int64
+}
+
+// Resolve returns the offset and length of the range within content of size
+// bytes.
+func (r ByteRange) Resolve(size int64) (offset, length int64, err error) {
+	switch {
+	case r.Start < 0:
+		length = min(r.End, size)
+		if length <= 0 {
+			return 0, 0, fmt.Errorf("suffix range of %d bytes: %w", r.End, ErrRangeNotSatisfiable)
+		}
+		return size - length, length, nil
+	case r.Start >= size:
+		return 0, 0, fmt.Errorf("range starts at %d of %d bytes: %w", r.Start, size, ErrRangeNotSatisfiable)
+	case r.End < 0 || r.End >= size:
+		return r.Start, size - r.Start, nil
+	case r.End < r.Start:
+		return 0, 0, fmt.Errorf("range %d-%d: %w", r.Start, r.End, ErrRangeNotSatisfiable)
+	default:
+		return r.Start, r.End - r.Start + 1, nil
+	}
 }
@@ -0,0 +1,160 @@
+package files
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"mime"
+	"strings"
+)
+
+// maxNameLen caps the length of a file name set by a patch.
+const maxNameLen = 255
+
+// GetFile returns a live file.
+func (s *FileService) GetFile(ctx context.Context, id int64) (*File, error) {
+	f, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("file not found: %w", err)
+	}
+
+	return f, nil
+}
+
+// UpdateFile applies patch to the editable fields of a live file. ifMatch is
+// the If-Match header of the request: it is required and must list the
+// current ETag of the file (or be "*"), so concurrent editors cannot
+// overwrite each other's changes.
+func (s *FileService) UpdateFile(ctx context.Context, id int64, ifMatch string, patch FilePatch) (*File, error) {
+	if strings.TrimSpace(ifMatch) == "" {
+		return nil, fmt.Errorf("If-Match header is required: %w", ErrPreconditionRequired)
+	}
+
+	if err := validatePatch(&patch); err != nil {
+		return nil, err
+	}
+
+	file, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("file not found: %w", err)
+	}
+	if !etagMatches(ifMatch, file.ETag()) {
+		return nil, fmt.Errorf("file with id %d changed: %w", id, ErrPreconditionFailed)
+	}
+	if err := validateMetadata(mergeMetadata(file.Metadata, patch)); err != nil {
+		return nil, err
+	}
+
+	f, err := s.repo.Update(ctx, id, file.Version, file.UpdatedAt, patch)
+	if err != nil {
+		return nil, fmt.Errorf("update file: %w", err)
+	}
+
+	return f, nil
+}
+
+// DecodeMergePatch decodes a JSON Merge Patch (RFC 7396) of a file. Only
+// name, mime_type, tags and metadata can be patched; name and mime_type
+// cannot be removed.
+func DecodeMergePatch(body []byte) (FilePatch, error) {
+	var patch FilePatch
+
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(body, &doc); err != nil || doc == nil {
+		return patch, fmt.Errorf("patch must be a JSON object: %w", ErrInvalid)
+	}
+
+	for field, raw := range doc {
+		null := bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+
+		var err error
+		switch field {
+		case "name":
+			if null {
+				return patch, fmt.Errorf("name cannot be removed: %w", ErrInvalid)
+			}
+			err = json.Unmarshal(raw, &patch.Name)
+		case "mime_type":
+			if null {
+				return patch, fmt.Errorf("mime_type cannot be removed: %w", ErrInvalid)
+			}
+			err = json.Unmarshal(raw, &patch.MimeType)
+		case "tags":
+			patch.Tags = []string{}
+			if !null {
+				err = json.Unmarshal(raw, &patch.Tags)
+			}
+		case "metadata":
+			if null {
+				patch.ReplaceMetadata = true
+				continue
+			}
+			err = json.Unmarshal(raw, &patch.Metadata)
+		default:
+			return patch, fmt.Errorf("field %q cannot be patched: %w", field, ErrInvalid)
+		}
+		if err != nil {
+			return patch, fmt.Errorf("invalid %s: %w", field, ErrInvalid)
+		}
+	}
+
+	return patch, nil
+}
+
+// validatePatch checks the name, MIME type and tags of a patch and
+// normalizes the tags. Metadata is checked once merged.
+func validatePatch(patch *FilePatch) error {
+	if patch.Name != nil {
+		name := strings.TrimSpace(*patch.Name)
+		if name == "" || len(name) > maxNameLen {
+			return fmt.Errorf("name must be 1 to %d bytes: %w", maxNameLen, ErrInvalid)
+		}
+		patch.Name = &name
+	}
+
+	if patch.MimeType != nil {
+		if _, _, err := mime.ParseMediaType(*patch.MimeType); err != nil {
+			return fmt.Errorf("invalid mime_type %q: %w", *patch.MimeType, ErrInvalid)
+		}
+	}
+
+	if patch.Tags != nil {
+		tags, err := normalizeTags(patch.Tags)
+		if err != nil {
+			return err
+		}
+		patch.Tags = tags
+	}
+
+	return nil
+}
+
+// mergeMetadata returns the metadata resulting from applying patch to current.
+func mergeMetadata(current map[string]string, patch FilePatch) map[string]string {
+	merged := make(map[string]string, len(current)+len(patch.Metadata))
+	if !patch.ReplaceMetadata {
+		maps.Copy(merged, current)
+	}
+	for k, v := range patch.Metadata {
+		if v == nil {
+			delete(merged, k)
+			continue
+		}
+		merged[k] = *v
+	}
+	return merged
+}
+
+// etagMatches reports whether an If-Match header lists etag or is "*". Weak
+// entity tags never match, as If-Match uses strong comparison.
+func etagMatches(ifMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
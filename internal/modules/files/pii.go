@@ -0,0 +1,261 @@
+package files
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/mamed-gasimov/file-service/internal/modules/jobs"
+	"github.com/mamed-gasimov/file-service/internal/modules/usage"
+	"github.com/mamed-gasimov/file-service/internal/pii"
+)
+
+// requestPIIScan queues a detect_pii job for the current version of a file
+// with text. Without background jobs, the text is scanned right away, and
+// so it is with redaction on: the analysis request published next and the
+// embeddings need the findings.
+func (s *FileService) requestPIIScan(ctx context.Context, f *File, text string) {
+	if !s.detectPII || text == "" {
+		return
+	}
+
+	if s.jobs == nil || s.redactPII {
+		if _, _, err := s.scanPII(ctx, f, text); err != nil {
+			log.Printf("scan file %d for personal data: %v", f.ID, err)
+		}
+		return
+	}
+
+	_, err := s.jobs.Submit(ctx, jobs.TypeDetectPII, &f.ID, piiJobParams{Version: f.Version},
+		jobs.UniqueKey(fmt.Sprintf("detect_pii:%d:%d", f.ID, f.Version)))
+	if err != nil {
+		log.Printf("queue personal data scan for file %d: %v", f.ID, err)
+	}
+}
+
+// piiJobParams are the parameters of a detect_pii job.
+type piiJobParams struct {
+	Version int `json:"version"`
+}
+
+// RunPIIJob is the jobs.Handler of detect_pii jobs. It scans the text of
+// the version the job was queued for, unless the file has changed since,
+// and returns the number of findings.
+func (s *FileService) RunPIIJob(ctx context.Context, job *jobs.Job, p piiJobParams, progress func(percent int)) (json.RawMessage, error) {
+	if job.FileID == nil {
+		return nil, jobs.Permanent(fmt.Errorf("detect_pii job %d has no file", job.ID))
+	}
+
+	f, err := s.repo.GetByID(ctx, *job.FileID)
+	if errors.Is(err, ErrNotFound) {
+		return nil, jobs.Permanent(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if f.Version != p.Version {
+		return nil, nil
+	}
+
+	text, err := s.repo.GetExtractedText(ctx, f.ID)
+	if err != nil {
+		return nil, fmt.Errorf("get extracted text: %w", err)
+	}
+	if text == "" {
+		return nil, nil
+	}
+	progress(10)
+
+	findings, _, err := s.scanPII(ctx, f, text)
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrBudgetExceeded) {
+		return nil, jobs.Permanent(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(map[string]int{"findings": len(findings)})
+}
+
+// scanPII finds the personal data in the text of the current version of f,
+// stores the findings and a redacted rendition of the text, and returns
+// both. The rendition is nil when f has changed since.
+func (s *FileService) scanPII(ctx context.Context, f *File, text string) ([]pii.Finding, *Rendition, error) {
+	findings := pii.Detect(text)
+	if s.piiModel != nil {
+		found, err := s.detectPIIWithModel(ctx, f.ID, text, findings)
+		if err != nil {
+			return nil, nil, err
+		}
+		findings = pii.Merge(findings, found)
+	}
+
+	current, err := s.repo.ReplacePIIFindings(ctx, f.ID, f.Version, findings)
+	if err != nil {
+		return nil, nil, fmt.Errorf("save personal data findings: %w", err)
+	}
+	if !current {
+		return findings, nil, nil
+	}
+
+	rd, err := s.saveRedacted(ctx, f.ID, pii.Redact(text, findings))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return findings, rd, nil
+}
+
+// detectPIIWithModel asks the model for the personal data in text and
+// locates every entity it reports. With redaction on, the findings of the
+// patterns are replaced in the text before it is sent.
+func (s *FileService) detectPIIWithModel(ctx context.Context, fileID int64, text string, findings []pii.Finding) ([]pii.Finding, error) {
+	if err := s.checkBudget(ctx); err != nil {
+		return nil, err
+	}
+
+	input := text
+	if s.redactPII {
+		input = pii.Redact(text, findings)
+	}
+	input = truncateText(input, maxAnalysisContentLen)
+
+	entities, u, err := s.piiModel.DetectPII(ctx, input)
+	s.recordUsage(ctx, usage.OperationDetectPII, fileID, u)
+	if err != nil {
+		return nil, fmt.Errorf("detect personal data: %w", err)
+	}
+
+	var found []pii.Finding
+	for _, e := range entities {
+		t, err := pii.ParseType(e.Type)
+		if err != nil {
+			continue
+		}
+		found = pii.Merge(found, pii.Locate(text, t, e.Text))
+	}
+
+	return found, nil
+}
+
+func (s *FileService) saveRedacted(ctx context.Context, fileID int64, text string) (*Rendition, error) {
+	rd := &Rendition{
+		FileID:    fileID,
+		Kind:      RenditionRedacted,
+		MimeType:  "text/plain; charset=utf-8",
+		ByteSize:  int64(len(text)),
+		ObjectKey: renditionObjectKey(fileID, RenditionRedacted+".txt"),
+	}
+
+	if err := s.saveRendition(ctx, rd, strings.NewReader(text)); err != nil {
+		return nil, err
+	}
+
+	return rd, nil
+}
+
+// redactor returns a function replacing the personal data in texts taken
+// from the current version of file, such as the input of an analysis or
+// the passages a question is answered from. Patterns are matched in each
+// text itself; entities the model found when the version was scanned are
+// looked up in it by their text.
+func (s *FileService) redactor(ctx context.Context, file *File) (func(string) string, error) {
+	type entity struct {
+		typ   pii.Type
+		value string
+	}
+	var entities []entity
+
+	if s.piiModel != nil {
+		report, err := s.repo.GetPIIReport(ctx, file.ID, file.Version)
+		if err != nil {
+			return nil, fmt.Errorf("get personal data findings: %w", err)
+		}
+		text, err := s.repo.GetExtractedText(ctx, file.ID)
+		if err != nil {
+			return nil, fmt.Errorf("get extracted text: %w", err)
+		}
+		runes := []rune(text)
+		for _, f := range report.Findings {
+			if f.Detector == pii.DetectorModel {
+				entities = append(entities, entity{f.Type, string(runes[min(f.Start, len(runes)):min(f.End, len(runes))])})
+			}
+		}
+	}
+
+	return func(input string) string {
+		findings := pii.Detect(input)
+		for _, e := range entities {
+			findings = pii.Merge(findings, pii.Locate(input, e.typ, e.value))
+		}
+		return pii.Redact(input, findings)
+	}, nil
+}
+
+// redactedRendition returns the redacted rendition of the text of the
+// current version of f, scanning the text first when it has none yet.
+func (s *FileService) redactedRendition(ctx context.Context, f *File) (*Rendition, error) {
+	renditions, err := s.repo.ListRenditions(ctx, f.ID, RenditionRedacted)
+	if err != nil {
+		return nil, fmt.Errorf("list renditions: %w", err)
+	}
+	if len(renditions) > 0 {
+		return &renditions[0], nil
+	}
+
+	text, err := s.repo.GetExtractedText(ctx, f.ID)
+	if err != nil {
+		return nil, fmt.Errorf("get extracted text: %w", err)
+	}
+	if text == "" {
+		return nil, fmt.Errorf("text of file %d %w", f.ID, ErrNotFound)
+	}
+
+	_, rd, err := s.scanPII(ctx, f, text)
+	if err != nil {
+		return nil, err
+	}
+	// The file got new content meanwhile; its own scan will follow.
+	if rd == nil {
+		return nil, fmt.Errorf("redacted text of file %d %w", f.ID, ErrNotFound)
+	}
+
+	return rd, nil
+}
+
+// GetPIIReport returns the personal data found in the text of the current
+// version of a live file.
+func (s *FileService) GetPIIReport(ctx context.Context, id int64) (*PIIReport, error) {
+	f, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("file not found: %w", err)
+	}
+
+	return s.repo.GetPIIReport(ctx, id, f.Version)
+}
+
+// GetRedacted returns the text of the current version of a live file with
+// its personal data replaced. Text that has not been scanned yet is
+// scanned first.
+func (s *FileService) GetRedacted(ctx context.Context, id int64) (*Rendition, io.ReadCloser, error) {
+	f, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("file not found: %w", err)
+	}
+
+	rd, err := s.redactedRendition(ctx, f)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rc, err := s.storage.Download(ctx, rd.ObjectKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("download from storage: %w", err)
+	}
+
+	return rd, rc, nil
+}
@@ -0,0 +1,196 @@
+package files
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/mamed-gasimov/file-service/internal/pii"
+	"github.com/mamed-gasimov/file-service/internal/storage"
+	"github.com/mamed-gasimov/file-service/internal/storage/compressed"
+)
+
+// memStorage keeps objects in memory.
+type memStorage struct {
+	objects map[string][]byte
+}
+
+func (m *memStorage) Upload(_ context.Context, objectKey string, reader io.Reader, _ int64, _ string) error {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	m.objects[objectKey] = data
+	return nil
+}
+
+func (m *memStorage) Download(ctx context.Context, objectKey string) (io.ReadCloser, error) {
+	return m.DownloadRange(ctx, objectKey, 0, -1)
+}
+
+func (m *memStorage) DownloadRange(_ context.Context, objectKey string, offset, length int64) (io.ReadCloser, error) {
+	data, ok := m.objects[objectKey]
+	if !ok {
+		return nil, fmt.Errorf("object %q not found", objectKey)
+	}
+	data = data[min(offset, int64(len(data))):]
+	if length >= 0 {
+		data = data[:min(length, int64(len(data)))]
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (m *memStorage) Delete(_ context.Context, objectKey string) error {
+	delete(m.objects, objectKey)
+	return nil
+}
+
+func (m *memStorage) Walk(_ context.Context, prefix string, fn func(storage.Object) error) error {
+	for key, data := range m.objects {
+		if strings.HasPrefix(key, prefix) {
+			if err := fn(storage.Object{Key: key, Size: int64(len(data))}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (m *memStorage) EnsureBucket(context.Context, string) error { return nil }
+
+// renditionRepo stores the file, text and renditions the redacted text
+// needs, and serves the object info of renditions as FileRepository does.
+type renditionRepo struct {
+	repository
+
+	file       File
+	text       string
+	renditions []Rendition
+}
+
+func (r *renditionRepo) GetByID(_ context.Context, id int64) (*File, error) {
+	if id != r.file.ID {
+		return nil, fmt.Errorf("file with id %d %w", id, ErrNotFound)
+	}
+	f := r.file
+	return &f, nil
+}
+
+func (r *renditionRepo) GetExtractedText(context.Context, int64) (string, error) {
+	return r.text, nil
+}
+
+func (r *renditionRepo) ReplacePIIFindings(context.Context, int64, int, []pii.Finding) (bool, error) {
+	return true, nil
+}
+
+func (r *renditionRepo) SaveRendition(_ context.Context, rd *Rendition) (string, error) {
+	for i, old := range r.renditions {
+		if old.FileID == rd.FileID && old.Kind == rd.Kind && old.Size == rd.Size {
+			rd.ID = old.ID
+			r.renditions[i] = *rd
+			return old.ObjectKey, nil
+		}
+	}
+	rd.ID = int64(len(r.renditions) + 1)
+	r.renditions = append(r.renditions, *rd)
+	return "", nil
+}
+
+func (r *renditionRepo) ListRenditions(_ context.Context, fileID int64, kind string) ([]Rendition, error) {
+	var renditions []Rendition
+	for _, rd := range r.renditions {
+		if rd.FileID == fileID && (kind == "" || rd.Kind == kind) {
+			// Listing does not load the storage info.
+			rd.StorageInfo = storage.ObjectInfo{}
+			renditions = append(renditions, rd)
+		}
+	}
+	return renditions, nil
+}
+
+func (r *renditionRepo) ObjectInfo(_ context.Context, objectKey string) (*storage.ObjectInfo, error) {
+	for _, rd := range r.renditions {
+		if rd.ObjectKey == objectKey {
+			info := rd.StorageInfo
+			return &info, nil
+		}
+	}
+	return nil, nil
+}
+
+func TestRedactedRenditionReadsBack(t *testing.T) {
+	ctx := context.Background()
+	line := "Contact anna@example.com or +49 30 1234567 about the invoice.\n"
+	want := strings.Repeat("Contact [EMAIL] or [PHONE] about the invoice.\n", 50)
+
+	repo := &renditionRepo{
+		file: File{ID: 7, Version: 2, MimeType: "text/plain"},
+		text: strings.Repeat(line, 50),
+	}
+	objects := &memStorage{objects: map[string][]byte{}}
+	s := NewFileService(repo, compressed.New(objects, repo), nil, nil)
+
+	// The first read scans the text and stores the rendition, the second
+	// one reads the stored rendition back.
+	for i := range 2 {
+		rd, rc, err := s.GetRedacted(ctx, repo.file.ID)
+		if err != nil {
+			t.Fatalf("read %d: GetRedacted: %v", i, err)
+		}
+		got, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("read %d: read redacted text: %v", i, err)
+		}
+		if string(got) != want {
+			t.Errorf("read %d: redacted text = %q, want %q", i, got, want)
+		}
+		if rd.ByteSize != int64(len(want)) {
+			t.Errorf("read %d: byte size = %d, want %d", i, rd.ByteSize, len(want))
+		}
+	}
+
+	if len(repo.renditions) != 1 {
+		t.Fatalf("%d renditions saved, want 1", len(repo.renditions))
+	}
+	saved := repo.renditions[0]
+	if saved.StorageInfo.ContentEncoding != compressed.EncodingZstd {
+		t.Errorf("content encoding = %q, want %q", saved.StorageInfo.ContentEncoding, compressed.EncodingZstd)
+	}
+	if stored := int64(len(objects.objects[saved.ObjectKey])); saved.StorageInfo.StoredSize != stored || stored >= saved.ByteSize {
+		t.Errorf("stored size = %d, object has %d bytes of %d", saved.StorageInfo.StoredSize, stored, saved.ByteSize)
+	}
+}
+
+func TestSaveRenditionReplacesObject(t *testing.T) {
+	ctx := context.Background()
+	repo := &renditionRepo{file: File{ID: 7, Version: 1}}
+	objects := &memStorage{objects: map[string][]byte{}}
+	s := NewFileService(repo, objects, nil, nil)
+
+	first, err := s.saveRedacted(ctx, 7, "first [EMAIL]")
+	if err != nil {
+		t.Fatalf("save first: %v", err)
+	}
+	second, err := s.saveRedacted(ctx, 7, "second [PHONE]")
+	if err != nil {
+		t.Fatalf("save second: %v", err)
+	}
+
+	if first.ObjectKey == second.ObjectKey {
+		t.Fatalf("both writes used object key %q", first.ObjectKey)
+	}
+	if len(repo.renditions) != 1 || repo.renditions[0].ObjectKey != second.ObjectKey {
+		t.Fatalf("renditions = %+v, want only %q", repo.renditions, second.ObjectKey)
+	}
+	if _, ok := objects.objects[first.ObjectKey]; ok {
+		t.Errorf("replaced object %q was not deleted", first.ObjectKey)
+	}
+	if got := string(objects.objects[second.ObjectKey]); got != "second [PHONE]" {
+		t.Errorf("object = %q, want %q", got, "second [PHONE]")
+	}
+}
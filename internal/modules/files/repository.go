@@ -1,47 +1,442 @@
 package files
 
 import (
+	"container/heap"
 	"context"
+	"errors"
 	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/mamed-gasimov/file-service/internal/pii"
+	"github.com/mamed-gasimov/file-service/internal/storage"
+	"github.com/mamed-gasimov/file-service/internal/storage/encrypted"
 )
 
 type repository interface {
 	Create(ctx context.Context, f *File) error
-	List(ctx context.Context) ([]File, error)
+	List(ctx context.Context, filter ListFilter) ([]File, error)
+	ListIDs(ctx context.Context, filter ListFilter) ([]int64, error)
+	Count(ctx context.Context, filter ListFilter) (int, error)
+	Search(ctx context.Context, tsQuery string, filter ListFilter) ([]SearchHit, error)
+	CountSearch(ctx context.Context, tsQuery string, filter ListFilter) (int, error)
+	Move(ctx context.Context, id int64, folderID *int64, name string) (*File, error)
+	Update(ctx context.Context, id int64, version int, updatedAt time.Time, patch FilePatch) (*File, error)
+	TrashInFolders(ctx context.Context, folderIDs []int64) (int, error)
 	GetByID(ctx context.Context, id int64) (*File, error)
 	UpdateResume(ctx context.Context, id int64, resume string) (*File, error)
+	Trash(ctx context.Context, id int64) (*File, error)
+	Restore(ctx context.Context, id int64) (*File, error)
+	ListTrash(ctx context.Context) ([]File, error)
+	ListTrashedBefore(ctx context.Context, before time.Time, limit int) ([]File, error)
+	MarkDeleting(ctx context.Context, id int64, trashedOnly bool) (*File, error)
+	ListDeleting(ctx context.Context, before time.Time, limit int) ([]File, error)
 	Delete(ctx context.Context, id int64) error
-	UpdateTranslationSummary(ctx context.Context, id int64, summary string) error
+	UpdateTranslationSummary(ctx context.Context, id int64, version int, summary string) error
+	SaveTranslation(ctx context.Context, t *Translation) error
+	ListTranslations(ctx context.Context, fileID int64, version int) ([]Translation, error)
+	GetTranslation(ctx context.Context, fileID int64, version int, language string) (*Translation, error)
+	CopyTranslations(ctx context.Context, fileID int64, from, to int) error
+	ReplacePIIFindings(ctx context.Context, fileID int64, version int, findings []pii.Finding) (bool, error)
+	GetPIIReport(ctx context.Context, fileID int64, version int) (*PIIReport, error)
+	AddVersion(ctx context.Context, fileID int64, v *Version, maxVersions int) (*File, []Version, error)
+	ListVersions(ctx context.Context, fileID int64) ([]Version, error)
+	GetVersion(ctx context.Context, fileID int64, version int) (*Version, error)
+	DeleteVersion(ctx context.Context, id int64) error
+	SaveRendition(ctx context.Context, r *Rendition) (string, error)
+	ListRenditions(ctx context.Context, fileID int64, kind string) ([]Rendition, error)
+	DeleteRendition(ctx context.Context, id int64) error
+	ListObjectRefs(ctx context.Context) ([]ObjectRef, error)
+	ReplaceChunks(ctx context.Context, fileID int64, version int, model string, chunks []Chunk) error
+	NearestChunks(ctx context.Context, model string, query []float32, filter ListFilter, limit int) ([]ChunkMatch, error)
+	ListChunks(ctx context.Context, fileID int64, version int, model string) ([]Chunk, error)
+	GetExtractedText(ctx context.Context, id int64) (string, error)
+	CreateAnalysis(ctx context.Context, a *Analysis) error
+	ListAnalyses(ctx context.Context, fileID int64, filter AnalysisFilter) ([]Analysis, error)
+	GetCachedAnalysis(ctx context.Context, key AnalysisCacheKey) (*CachedAnalysis, error)
+	SaveCachedAnalysis(ctx context.Context, key AnalysisCacheKey, c *CachedAnalysis) error
+	CountCachedAnalyses(ctx context.Context) (int, error)
+	AnalysisCacheHits(ctx context.Context, since *time.Time) ([]AnalysisTypeStats, error)
+}
+
+var (
+	_ repository         = (*FileRepository)(nil)
+	_ storage.InfoStore  = (*FileRepository)(nil)
+	_ encrypted.KeyStore = (*FileRepository)(nil)
+)
+
+// fileColumns lists the files columns in the order scanFile expects them.
+// Tags are aggregated from file_tags, so queries must name the table files.
+const fileColumns = `id, name, size, mime_type, object_key, created_at, updated_at, resume, translation_summary, properties,
+	content_encoding, stored_size, deleted_at, version, content_hash, folder_id, metadata,
+	COALESCE((SELECT array_agg(t.name ORDER BY t.name) FROM file_tags ft JOIN tags t ON t.id = ft.tag_id
+	          WHERE ft.file_id = files.id), '{}') AS tags`
+
+func scanFile(row pgx.Row, f *File) error {
+	return row.Scan(
+		&f.ID, &f.Name, &f.Size, &f.MimeType, &f.ObjectKey, &f.CreatedAt, &f.UpdatedAt, &f.Resume, &f.TranslationSummary, &f.Properties,
+		&f.ContentEncoding, &f.StoredSize, &f.DeletedAt, &f.Version, &f.ContentHash, &f.FolderID, &f.Metadata, &f.Tags,
+	)
+}
+
+// extraColumns scans the columns that follow fileColumns in a row.
+type extraColumns struct {
+	pgx.Row
+	dest []any
+}
+
+func (r extraColumns) Scan(dest ...any) error {
+	return r.Row.Scan(append(dest, r.dest...)...)
 }
 
-var _ repository = (*FileRepository)(nil)
+// versionColumns lists the file_versions columns in the order scanVersion expects them.
+const versionColumns = `id, file_id, version, size, mime_type, object_key, content_hash, properties, resume, translation_summary,
+	content_encoding, stored_size, created_at`
+
+func scanVersion(row pgx.Row, v *Version) error {
+	return row.Scan(
+		&v.ID, &v.FileID, &v.Version, &v.Size, &v.MimeType, &v.ObjectKey, &v.ContentHash, &v.Properties, &v.Resume, &v.TranslationSummary,
+		&v.ContentEncoding, &v.StoredSize, &v.CreatedAt,
+	)
+}
 
 type FileRepository struct {
 	pool *pgxpool.Pool
+
+	// pgvector reports whether the vector extension is installed; it is
+	// checked on the first similarity search.
+	pgvectorOnce sync.Once
+	pgvector     bool
 }
 
 func NewFileRepository(pool *pgxpool.Pool) *FileRepository {
 	return &FileRepository{pool: pool}
 }
 
+// Create inserts the file together with its first version and its tags.
 func (r *FileRepository) Create(ctx context.Context, f *File) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	f.Version = 1
 	query := `
-		INSERT INTO files (name, size, mime_type, object_key, resume)
-		VALUES ($1, $2, $3, $4, $5)
+		INSERT INTO files (name, size, mime_type, object_key, resume, properties, wrapped_key, key_id, content_encoding, stored_size,
+		                   version, content_hash, folder_id, metadata, extracted_text)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, COALESCE($14::jsonb, '{}'), $15)
 		RETURNING id, created_at, updated_at`
 
-	return r.pool.QueryRow(ctx, query,
-		f.Name, f.Size, f.MimeType, f.ObjectKey, f.Resume,
+	err = tx.QueryRow(ctx, query,
+		f.Name, f.Size, f.MimeType, f.ObjectKey, f.Resume, f.Properties,
+		f.StorageInfo.WrappedKey, nullString(f.StorageInfo.KeyID), f.ContentEncoding, f.StoredSize,
+		f.Version, f.ContentHash, f.FolderID, f.Metadata, f.ExtractedText,
 	).Scan(&f.ID, &f.CreatedAt, &f.UpdatedAt)
+	if isForeignKeyViolation(err) {
+		return fmt.Errorf("folder %d %w", *f.FolderID, ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("insert file: %w", err)
+	}
+
+	if err := insertVersion(ctx, tx, f.ID, &Version{
+		Version:         f.Version,
+		Size:            f.Size,
+		MimeType:        f.MimeType,
+		ObjectKey:       f.ObjectKey,
+		ContentHash:     f.ContentHash,
+		Properties:      f.Properties,
+		Resume:          f.Resume,
+		ContentEncoding: f.ContentEncoding,
+		StoredSize:      f.StoredSize,
+		StorageInfo:     f.StorageInfo,
+	}); err != nil {
+		return err
+	}
+
+	if err := setTags(ctx, tx, f.ID, f.Tags); err != nil {
+		return err
+	}
+	if f.Tags == nil {
+		f.Tags = []string{}
+	}
+	if f.Metadata == nil {
+		f.Metadata = map[string]string{}
+	}
+
+	return tx.Commit(ctx)
 }
 
-func (r *FileRepository) List(ctx context.Context) ([]File, error) {
-	query := `SELECT id, name, size, mime_type, object_key, created_at, updated_at, resume, translation_summary
-	           FROM files ORDER BY created_at DESC`
+// setTags replaces the tags of a file, creating tags that do not exist yet.
+func setTags(ctx context.Context, tx pgx.Tx, fileID int64, tags []string) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM file_tags WHERE file_id = $1`, fileID); err != nil {
+		return fmt.Errorf("clear tags: %w", err)
+	}
+	if len(tags) == 0 {
+		return nil
+	}
 
-	rows, err := r.pool.Query(ctx, query)
+	if _, err := tx.Exec(ctx, `INSERT INTO tags (name) SELECT unnest($1::text[])
+	           ON CONFLICT (name) DO NOTHING`, tags); err != nil {
+		return fmt.Errorf("insert tags: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `INSERT INTO file_tags (file_id, tag_id)
+	           SELECT $1, id FROM tags WHERE name = ANY($2)`, fileID, tags); err != nil {
+		return fmt.Errorf("tag file: %w", err)
+	}
+
+	return nil
+}
+
+func insertVersion(ctx context.Context, tx pgx.Tx, fileID int64, v *Version) error {
+	query := `
+		INSERT INTO file_versions (file_id, version, size, mime_type, object_key, content_hash, properties, resume, translation_summary,
+		                           wrapped_key, key_id, content_encoding, stored_size)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		RETURNING id, created_at`
+
+	v.FileID = fileID
+	err := tx.QueryRow(ctx, query,
+		fileID, v.Version, v.Size, v.MimeType, v.ObjectKey, v.ContentHash, v.Properties, v.Resume, v.TranslationSummary,
+		v.StorageInfo.WrappedKey, nullString(v.StorageInfo.KeyID), v.ContentEncoding, v.StoredSize,
+	).Scan(&v.ID, &v.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("insert version: %w", err)
+	}
+
+	return nil
+}
+
+// listWhere is the condition shared by List and Count, taking the arguments
+// returned by listArgs. A folder filter of 0 selects the root, where
+// folder_id is NULL; the metadata filter is a containment test served by the
+// GIN index on metadata.
+const listWhere = `status = 'active' AND ($1 OR deleted_at IS NULL)
+	           AND ($2::bigint IS NULL OR folder_id IS NOT DISTINCT FROM NULLIF($2, 0))
+	           AND ($3::text[] IS NULL OR files.id IN (
+	               SELECT ft.file_id FROM file_tags ft JOIN tags t ON t.id = ft.tag_id
+	               WHERE t.name = ANY($3)
+	               GROUP BY ft.file_id HAVING count(*) = cardinality($3)))
+	           AND ($4::jsonb IS NULL OR metadata @> $4)`
+
+func listArgs(filter ListFilter) []any {
+	var tags []string
+	if len(filter.Tags) > 0 {
+		tags = filter.Tags
+	}
+	var metadata map[string]string
+	if len(filter.Metadata) > 0 {
+		metadata = filter.Metadata
+	}
+	return []any{filter.IncludeDeleted, filter.FolderID, tags, metadata}
+}
+
+func (r *FileRepository) List(ctx context.Context, filter ListFilter) ([]File, error) {
+	query := `SELECT ` + fileColumns + `
+	           FROM files WHERE ` + listWhere + `
+	           ORDER BY created_at DESC
+	           LIMIT NULLIF($5, 0) OFFSET $6`
+
+	return r.queryFiles(ctx, query, append(listArgs(filter), filter.Limit, filter.Offset)...)
+}
+
+// ListIDs returns the IDs of the files matching filter, oldest first.
+func (r *FileRepository) ListIDs(ctx context.Context, filter ListFilter) ([]int64, error) {
+	query := `SELECT id FROM files WHERE ` + listWhere + `
+	           ORDER BY id
+	           LIMIT NULLIF($5, 0) OFFSET $6`
+
+	rows, err := r.pool.Query(ctx, query, append(listArgs(filter), filter.Limit, filter.Offset)...)
+	if err != nil {
+		return nil, fmt.Errorf("list file ids: %w", err)
+	}
+
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan file id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// searchConfig is the text search configuration of the search_vector column.
+const searchConfig = "english"
+
+// Search returns the files matching a to_tsquery expression and filter, best
+// match first, with a highlighted snippet of the matching text.
+func (r *FileRepository) Search(ctx context.Context, tsQuery string, filter ListFilter) ([]SearchHit, error) {
+	query := `SELECT ` + fileColumns + `,
+	               ts_rank_cd(search_vector, q)::float8 AS rank,
+	               ts_headline('` + searchConfig + `',
+	                   concat_ws(E'\n', name, resume, translation_summary, extracted_text), q,
+	                   'StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=30, MinWords=10') AS snippet
+	           FROM files, to_tsquery('` + searchConfig + `', $5) q
+	           WHERE ` + listWhere + ` AND search_vector @@ q
+	           ORDER BY rank DESC, created_at DESC
+	           LIMIT NULLIF($6, 0) OFFSET $7`
+
+	rows, err := r.pool.Query(ctx, query, append(listArgs(filter), tsQuery, filter.Limit, filter.Offset)...)
+	if err != nil {
+		return nil, fmt.Errorf("search files: %w", err)
+	}
+	defer rows.Close()
+
+	var hits []SearchHit
+	for rows.Next() {
+		var h SearchHit
+		if err := scanFile(extraColumns{rows, []any{&h.Rank, &h.Snippet}}, &h.File); err != nil {
+			return nil, fmt.Errorf("scan search hit: %w", err)
+		}
+		hits = append(hits, h)
+	}
+
+	return hits, rows.Err()
+}
+
+// CountSearch returns how many files match a to_tsquery expression and
+// filter, ignoring Limit and Offset.
+func (r *FileRepository) CountSearch(ctx context.Context, tsQuery string, filter ListFilter) (int, error) {
+	query := `SELECT count(*) FROM files
+	           WHERE ` + listWhere + ` AND search_vector @@ to_tsquery('` + searchConfig + `', $5)`
+
+	var n int
+	if err := r.pool.QueryRow(ctx, query, append(listArgs(filter), tsQuery)...).Scan(&n); err != nil {
+		return 0, fmt.Errorf("count search hits: %w", err)
+	}
+
+	return n, nil
+}
+
+// Count returns how many files match filter, ignoring Limit and Offset.
+func (r *FileRepository) Count(ctx context.Context, filter ListFilter) (int, error) {
+	query := `SELECT count(*) FROM files WHERE ` + listWhere
+
+	var n int
+	if err := r.pool.QueryRow(ctx, query, listArgs(filter)...).Scan(&n); err != nil {
+		return 0, fmt.Errorf("count files: %w", err)
+	}
+
+	return n, nil
+}
+
+// Move puts a live file into a folder (nil for the root) under the given name.
+func (r *FileRepository) Move(ctx context.Context, id int64, folderID *int64, name string) (*File, error) {
+	query := `UPDATE files SET folder_id = $2, name = $3, updated_at = NOW()
+	           WHERE id = $1 AND status = 'active' AND deleted_at IS NULL
+	           RETURNING ` + fileColumns
+
+	f, err := r.updateFile(ctx, "move file", query, id, folderID, name)
+	if isForeignKeyViolation(err) {
+		return nil, fmt.Errorf("folder %d %w", *folderID, ErrNotFound)
+	}
+	return f, err
+}
+
+// Update applies patch to a live file and returns the updated file. The
+// update only happens if the file still has the given version and
+// updated_at, otherwise ErrPreconditionFailed is returned.
+func (r *FileRepository) Update(ctx context.Context, id int64, version int, updatedAt time.Time, patch FilePatch) (*File, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var set map[string]string
+	var remove []string
+	for k, v := range patch.Metadata {
+		if v == nil {
+			remove = append(remove, k)
+			continue
+		}
+		if set == nil {
+			set = make(map[string]string)
+		}
+		set[k] = *v
+	}
+
+	query := `UPDATE files SET name = COALESCE($4, name), mime_type = COALESCE($5, mime_type),
+	               metadata = (CASE WHEN $6 THEN '{}'::jsonb ELSE metadata END || COALESCE($7::jsonb, '{}'))
+	                          - COALESCE($8::text[], '{}'),
+	               updated_at = NOW()
+	           WHERE id = $1 AND status = 'active' AND deleted_at IS NULL AND version = $2 AND updated_at = $3`
+
+	ct, err := tx.Exec(ctx, query, id, version, updatedAt, patch.Name, patch.MimeType, patch.ReplaceMetadata, set, remove)
+	if err != nil {
+		return nil, fmt.Errorf("update file: %w", err)
+	}
+	if ct.RowsAffected() == 0 {
+		var exists bool
+		err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM files
+		           WHERE id = $1 AND status = 'active' AND deleted_at IS NULL)`, id).Scan(&exists)
+		if err != nil {
+			return nil, fmt.Errorf("check file: %w", err)
+		}
+		if exists {
+			return nil, fmt.Errorf("file with id %d changed: %w", id, ErrPreconditionFailed)
+		}
+		return nil, fmt.Errorf("file with id %d %w", id, ErrNotFound)
+	}
+
+	if patch.MimeType != nil {
+		_, err := tx.Exec(ctx, `UPDATE file_versions SET mime_type = $3 WHERE file_id = $1 AND version = $2`,
+			id, version, *patch.MimeType)
+		if err != nil {
+			return nil, fmt.Errorf("update current version: %w", err)
+		}
+	}
+
+	if patch.Tags != nil {
+		if err := setTags(ctx, tx, id, patch.Tags); err != nil {
+			return nil, err
+		}
+	}
+
+	var f File
+	err = scanFile(tx.QueryRow(ctx, `SELECT `+fileColumns+` FROM files WHERE id = $1`, id), &f)
+	if err != nil {
+		return nil, fmt.Errorf("get updated file: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit tx: %w", err)
+	}
+
+	return &f, nil
+}
+
+// TrashInFolders moves the live files of the given folders to the trash and
+// returns how many were moved.
+func (r *FileRepository) TrashInFolders(ctx context.Context, folderIDs []int64) (int, error) {
+	query := `UPDATE files SET deleted_at = NOW(), updated_at = NOW()
+	           WHERE folder_id = ANY($1) AND status = 'active' AND deleted_at IS NULL`
+
+	ct, err := r.pool.Exec(ctx, query, folderIDs)
+	if err != nil {
+		return 0, fmt.Errorf("trash files in folders: %w", err)
+	}
+
+	return int(ct.RowsAffected()), nil
+}
+
+// queryFiles runs a query selecting fileColumns and scans every row.
+func (r *FileRepository) queryFiles(ctx context.Context, query string, args ...any) ([]File, error) {
+	rows, err := r.pool.Query(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("query files: %w", err)
 	}
@@ -50,7 +445,7 @@ func (r *FileRepository) List(ctx context.Context) ([]File, error) {
 	var files []File
 	for rows.Next() {
 		var f File
-		if err := rows.Scan(&f.ID, &f.Name, &f.Size, &f.MimeType, &f.ObjectKey, &f.CreatedAt, &f.UpdatedAt, &f.Resume, &f.TranslationSummary); err != nil {
+		if err := scanFile(rows, &f); err != nil {
 			return nil, fmt.Errorf("scan file: %w", err)
 		}
 		files = append(files, f)
@@ -65,13 +460,14 @@ func (r *FileRepository) List(ctx context.Context) ([]File, error) {
 }
 
 func (r *FileRepository) GetByID(ctx context.Context, id int64) (*File, error) {
-	query := `SELECT id, name, size, mime_type, object_key, created_at, updated_at, resume, translation_summary
-	           FROM files WHERE id = $1`
+	query := `SELECT ` + fileColumns + `
+	           FROM files WHERE id = $1 AND status = 'active' AND deleted_at IS NULL`
 
 	var f File
-	err := r.pool.QueryRow(ctx, query, id).Scan(
-		&f.ID, &f.Name, &f.Size, &f.MimeType, &f.ObjectKey, &f.CreatedAt, &f.UpdatedAt, &f.Resume, &f.TranslationSummary,
-	)
+	err := scanFile(r.pool.QueryRow(ctx, query, id), &f)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("file with id %d %w", id, ErrNotFound)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("get file by id: %w", err)
 	}
@@ -80,14 +476,21 @@ func (r *FileRepository) GetByID(ctx context.Context, id int64) (*File, error) {
 }
 
 func (r *FileRepository) UpdateResume(ctx context.Context, id int64, resume string) (*File, error) {
-	query := `UPDATE files SET resume = $1, updated_at = NOW()
-	           WHERE id = $2
-	           RETURNING id, name, size, mime_type, object_key, created_at, updated_at, resume, translation_summary`
+	query := `WITH f AS (
+	               UPDATE files SET resume = $1, updated_at = NOW()
+	               WHERE id = $2 AND status = 'active' AND deleted_at IS NULL
+	               RETURNING ` + fileColumns + `
+	           ), v AS (
+	               UPDATE file_versions fv SET resume = $1
+	               FROM f WHERE fv.file_id = f.id AND fv.version = f.version
+	           )
+	           SELECT * FROM f`
 
 	var f File
-	err := r.pool.QueryRow(ctx, query, resume, id).Scan(
-		&f.ID, &f.Name, &f.Size, &f.MimeType, &f.ObjectKey, &f.CreatedAt, &f.UpdatedAt, &f.Resume, &f.TranslationSummary,
-	)
+	err := scanFile(r.pool.QueryRow(ctx, query, resume, id), &f)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("file with id %d %w", id, ErrNotFound)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("update resume: %w", err)
 	}
@@ -95,6 +498,77 @@ func (r *FileRepository) UpdateResume(ctx context.Context, id int64, resume stri
 	return &f, nil
 }
 
+// Trash moves a file to the trash.
+func (r *FileRepository) Trash(ctx context.Context, id int64) (*File, error) {
+	query := `UPDATE files SET deleted_at = NOW(), updated_at = NOW()
+	           WHERE id = $1 AND status = 'active' AND deleted_at IS NULL
+	           RETURNING ` + fileColumns
+
+	return r.updateFile(ctx, "trash file", query, id)
+}
+
+// Restore takes a file out of the trash.
+func (r *FileRepository) Restore(ctx context.Context, id int64) (*File, error) {
+	query := `UPDATE files SET deleted_at = NULL, updated_at = NOW()
+	           WHERE id = $1 AND status = 'active' AND deleted_at IS NOT NULL
+	           RETURNING ` + fileColumns
+
+	return r.updateFile(ctx, "restore file", query, id)
+}
+
+// ListTrash returns the files in the trash, most recently deleted first.
+func (r *FileRepository) ListTrash(ctx context.Context) ([]File, error) {
+	query := `SELECT ` + fileColumns + `
+	           FROM files WHERE status = 'active' AND deleted_at IS NOT NULL
+	           ORDER BY deleted_at DESC`
+
+	return r.queryFiles(ctx, query)
+}
+
+// ListTrashedBefore returns up to limit files moved to the trash before the given time.
+func (r *FileRepository) ListTrashedBefore(ctx context.Context, before time.Time, limit int) ([]File, error) {
+	query := `SELECT ` + fileColumns + `
+	           FROM files WHERE status = 'active' AND deleted_at < $1
+	           ORDER BY deleted_at LIMIT $2`
+
+	return r.queryFiles(ctx, query, before, limit)
+}
+
+// MarkDeleting tombstones an active file and returns it. The file is hidden
+// from reads from then on, and its row is removed once its objects are.
+// With trashedOnly set, only a file in the trash is tombstoned.
+func (r *FileRepository) MarkDeleting(ctx context.Context, id int64, trashedOnly bool) (*File, error) {
+	query := `UPDATE files SET status = 'deleting', updated_at = NOW()
+	           WHERE id = $1 AND status = 'active' AND (NOT $2 OR deleted_at IS NOT NULL)
+	           RETURNING ` + fileColumns
+
+	return r.updateFile(ctx, "mark file deleting", query, id, trashedOnly)
+}
+
+// updateFile runs an UPDATE ... RETURNING fileColumns on a single file,
+// reporting ErrNotFound when no row matched.
+func (r *FileRepository) updateFile(ctx context.Context, op, query string, id int64, args ...any) (*File, error) {
+	var f File
+	err := scanFile(r.pool.QueryRow(ctx, query, append([]any{id}, args...)...), &f)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("file with id %d %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &f, nil
+}
+
+// ListDeleting returns up to limit tombstoned files marked before the given time.
+func (r *FileRepository) ListDeleting(ctx context.Context, before time.Time, limit int) ([]File, error) {
+	query := `SELECT ` + fileColumns + `
+	           FROM files WHERE status = 'deleting' AND updated_at < $1
+	           ORDER BY updated_at LIMIT $2`
+
+	return r.queryFiles(ctx, query, before, limit)
+}
+
 func (r *FileRepository) Delete(ctx context.Context, id int64) error {
 	query := `DELETE FROM files WHERE id = $1`
 
@@ -104,23 +578,872 @@ func (r *FileRepository) Delete(ctx context.Context, id int64) error {
 	}
 
 	if ct.RowsAffected() == 0 {
-		return fmt.Errorf("file with id %d not found", id)
+		return fmt.Errorf("file with id %d %w", id, ErrNotFound)
 	}
 
 	return nil
 }
 
-func (r *FileRepository) UpdateTranslationSummary(ctx context.Context, id int64, summary string) error {
-	query := `UPDATE files SET translation_summary = $1, updated_at = NOW() WHERE id = $2`
+// UpdateTranslationSummary stores the summary of a version, mirrored on the
+// file while that version is current. A version of 0 means the current one.
+func (r *FileRepository) UpdateTranslationSummary(ctx context.Context, id int64, version int, summary string) error {
+	query := `WITH v AS (
+	               UPDATE file_versions SET translation_summary = $1
+	               WHERE file_id = $2
+	                 AND version = COALESCE(NULLIF($3, 0), (SELECT version FROM files WHERE id = $2 AND status = 'active'))
+	               RETURNING file_id, version
+	           ), f AS (
+	               UPDATE files SET translation_summary = $1, updated_at = NOW()
+	               FROM v WHERE files.id = v.file_id AND files.version = v.version AND files.status = 'active'
+	           )
+	           SELECT count(*) FROM v`
 
-	ct, err := r.pool.Exec(ctx, query, summary, id)
-	if err != nil {
+	var affected int
+	if err := r.pool.QueryRow(ctx, query, summary, id, version).Scan(&affected); err != nil {
 		return fmt.Errorf("update translation summary: %w", err)
 	}
 
-	if ct.RowsAffected() == 0 {
-		return fmt.Errorf("file with id %d not found", id)
+	if affected == 0 {
+		return fmt.Errorf("file with id %d version %d %w", id, version, ErrNotFound)
+	}
+
+	return nil
+}
+
+// AddVersion makes v the current version of a live file and returns the
+// updated file. When maxVersions is positive, the oldest versions beyond
+// that count are removed and returned so their objects can be deleted.
+func (r *FileRepository) AddVersion(ctx context.Context, fileID int64, v *Version, maxVersions int) (*File, []Version, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, `SELECT version + 1 FROM files
+	           WHERE id = $1 AND status = 'active' AND deleted_at IS NULL
+	           FOR UPDATE`, fileID).Scan(&v.Version)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil, fmt.Errorf("file with id %d %w", fileID, ErrNotFound)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("lock file: %w", err)
+	}
+
+	if err := insertVersion(ctx, tx, fileID, v); err != nil {
+		return nil, nil, err
+	}
+
+	query := `UPDATE files SET version = $2, size = $3, mime_type = $4, object_key = $5, content_hash = $6, properties = $7,
+	               resume = $8, translation_summary = $9, wrapped_key = $10, key_id = $11, content_encoding = $12, stored_size = $13,
+	               extracted_text = $14, updated_at = NOW()
+	           WHERE id = $1
+	           RETURNING ` + fileColumns
+
+	var f File
+	err = scanFile(tx.QueryRow(ctx, query,
+		fileID, v.Version, v.Size, v.MimeType, v.ObjectKey, v.ContentHash, v.Properties,
+		v.Resume, v.TranslationSummary, v.StorageInfo.WrappedKey, nullString(v.StorageInfo.KeyID), v.ContentEncoding, v.StoredSize,
+		v.ExtractedText,
+	), &f)
+	if err != nil {
+		return nil, nil, fmt.Errorf("update file: %w", err)
+	}
+
+	var pruned []Version
+	if maxVersions > 0 {
+		rows, err := tx.Query(ctx, `DELETE FROM file_versions
+		           WHERE file_id = $1 AND version <= $2
+		           RETURNING `+versionColumns, fileID, v.Version-maxVersions)
+		if err != nil {
+			return nil, nil, fmt.Errorf("prune versions: %w", err)
+		}
+		pruned, err = collectVersions(rows)
+		if err != nil {
+			return nil, nil, fmt.Errorf("prune versions: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, fmt.Errorf("commit tx: %w", err)
+	}
+
+	return &f, pruned, nil
+}
+
+// ListVersions returns the versions of a file, newest first.
+func (r *FileRepository) ListVersions(ctx context.Context, fileID int64) ([]Version, error) {
+	query := `SELECT ` + versionColumns + `
+	           FROM file_versions WHERE file_id = $1
+	           ORDER BY version DESC`
+
+	rows, err := r.pool.Query(ctx, query, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("query versions: %w", err)
+	}
+
+	return collectVersions(rows)
+}
+
+func (r *FileRepository) GetVersion(ctx context.Context, fileID int64, version int) (*Version, error) {
+	query := `SELECT ` + versionColumns + `
+	           FROM file_versions WHERE file_id = $1 AND version = $2`
+
+	var v Version
+	err := scanVersion(r.pool.QueryRow(ctx, query, fileID, version), &v)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("version %d of file %d %w", version, fileID, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get version: %w", err)
+	}
+
+	return &v, nil
+}
+
+func (r *FileRepository) DeleteVersion(ctx context.Context, id int64) error {
+	query := `DELETE FROM file_versions WHERE id = $1`
+
+	if _, err := r.pool.Exec(ctx, query, id); err != nil {
+		return fmt.Errorf("delete version: %w", err)
+	}
+
+	return nil
+}
+
+func collectVersions(rows pgx.Rows) ([]Version, error) {
+	defer rows.Close()
+
+	var versions []Version
+	for rows.Next() {
+		var v Version
+		if err := scanVersion(rows, &v); err != nil {
+			return nil, fmt.Errorf("scan version: %w", err)
+		}
+		versions = append(versions, v)
+	}
+
+	return versions, rows.Err()
+}
+
+// SaveTranslation inserts a translation or replaces the existing one in the
+// same language. A zero version targets the current version of a live file.
+func (r *FileRepository) SaveTranslation(ctx context.Context, t *Translation) error {
+	query := `
+		INSERT INTO file_translations (file_id, version, language, content)
+		SELECT fv.file_id, fv.version, $3, $4
+		FROM file_versions fv
+		WHERE fv.file_id = $1
+		  AND fv.version = COALESCE(NULLIF($2, 0), (SELECT version FROM files WHERE id = $1 AND status = 'active'))
+		ON CONFLICT (file_id, version, language) DO UPDATE
+		SET content = EXCLUDED.content, updated_at = now()
+		RETURNING version, created_at, updated_at`
+
+	err := r.pool.QueryRow(ctx, query, t.FileID, t.Version, t.Language, t.Content).
+		Scan(&t.Version, &t.CreatedAt, &t.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("file with id %d version %d %w", t.FileID, t.Version, ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("save translation: %w", err)
+	}
+
+	return nil
+}
+
+// ListTranslations returns the translations of a file version ordered by
+// language.
+func (r *FileRepository) ListTranslations(ctx context.Context, fileID int64, version int) ([]Translation, error) {
+	query := `SELECT file_id, version, language, content, created_at, updated_at
+	           FROM file_translations
+	           WHERE file_id = $1 AND version = $2
+	           ORDER BY language`
+
+	rows, err := r.pool.Query(ctx, query, fileID, version)
+	if err != nil {
+		return nil, fmt.Errorf("query translations: %w", err)
+	}
+	defer rows.Close()
+
+	var translations []Translation
+	for rows.Next() {
+		var t Translation
+		if err := rows.Scan(&t.FileID, &t.Version, &t.Language, &t.Content, &t.CreatedAt, &t.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan translation: %w", err)
+		}
+		translations = append(translations, t)
+	}
+
+	return translations, rows.Err()
+}
+
+func (r *FileRepository) GetTranslation(ctx context.Context, fileID int64, version int, language string) (*Translation, error) {
+	query := `SELECT file_id, version, language, content, created_at, updated_at
+	           FROM file_translations
+	           WHERE file_id = $1 AND version = $2 AND language = $3`
+
+	var t Translation
+	err := r.pool.QueryRow(ctx, query, fileID, version, language).
+		Scan(&t.FileID, &t.Version, &t.Language, &t.Content, &t.CreatedAt, &t.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("translation %q of file %d %w", language, fileID, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get translation: %w", err)
+	}
+
+	return &t, nil
+}
+
+// CopyTranslations copies the translations of one version of a file to
+// another, keeping any the target version already has.
+func (r *FileRepository) CopyTranslations(ctx context.Context, fileID int64, from, to int) error {
+	query := `
+		INSERT INTO file_translations (file_id, version, language, content)
+		SELECT file_id, $3, language, content
+		FROM file_translations
+		WHERE file_id = $1 AND version = $2
+		ON CONFLICT (file_id, version, language) DO NOTHING`
+
+	if _, err := r.pool.Exec(ctx, query, fileID, from, to); err != nil {
+		return fmt.Errorf("copy translations: %w", err)
+	}
+
+	return nil
+}
+
+// ReplacePIIFindings replaces the personal data found in a file version and
+// marks the version as scanned. It reports false, changing nothing, when
+// the version is no longer the current one.
+func (r *FileRepository) ReplacePIIFindings(ctx context.Context, fileID int64, version int, findings []pii.Finding) (bool, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var current int
+	err = tx.QueryRow(ctx, `SELECT version FROM files WHERE id = $1 AND status = 'active' FOR UPDATE`, fileID).Scan(&current)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, fmt.Errorf("file with id %d %w", fileID, ErrNotFound)
+	}
+	if err != nil {
+		return false, fmt.Errorf("lock file: %w", err)
+	}
+	if current != version {
+		return false, nil
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM file_pii_findings WHERE file_id = $1 AND version = $2`, fileID, version); err != nil {
+		return false, fmt.Errorf("delete pii findings: %w", err)
+	}
+
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"file_pii_findings"},
+		[]string{"file_id", "version", "type", "start_offset", "end_offset", "detector"},
+		pgx.CopyFromSlice(len(findings), func(i int) ([]any, error) {
+			f := findings[i]
+			return []any{fileID, version, string(f.Type), f.Start, f.End, f.Detector}, nil
+		}))
+	if err != nil {
+		return false, fmt.Errorf("insert pii findings: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE file_versions SET pii_scanned_at = now() WHERE file_id = $1 AND version = $2`, fileID, version)
+	if err != nil {
+		return false, fmt.Errorf("mark version scanned: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("commit tx: %w", err)
+	}
+
+	return true, nil
+}
+
+// GetPIIReport returns the personal data found in a file version, ordered
+// by offset.
+func (r *FileRepository) GetPIIReport(ctx context.Context, fileID int64, version int) (*PIIReport, error) {
+	report := &PIIReport{FileID: fileID, Version: version, Counts: map[pii.Type]int{}, Findings: []pii.Finding{}}
+
+	err := r.pool.QueryRow(ctx, `SELECT pii_scanned_at FROM file_versions WHERE file_id = $1 AND version = $2`,
+		fileID, version).Scan(&report.ScannedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("version %d of file %d %w", version, fileID, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get pii scan: %w", err)
+	}
+
+	query := `SELECT type, start_offset, end_offset, detector
+	           FROM file_pii_findings
+	           WHERE file_id = $1 AND version = $2
+	           ORDER BY start_offset`
+
+	rows, err := r.pool.Query(ctx, query, fileID, version)
+	if err != nil {
+		return nil, fmt.Errorf("query pii findings: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var f pii.Finding
+		if err := rows.Scan(&f.Type, &f.Start, &f.End, &f.Detector); err != nil {
+			return nil, fmt.Errorf("scan pii finding: %w", err)
+		}
+		report.Findings = append(report.Findings, f)
+		report.Counts[f.Type]++
+	}
+
+	return report, rows.Err()
+}
+
+// SaveRendition inserts a rendition or replaces the existing one of the same
+// kind and size for the file, along with how its object is stored. It
+// returns the object key of the rendition replaced, if any.
+func (r *FileRepository) SaveRendition(ctx context.Context, rd *Rendition) (string, error) {
+	query := `
+		WITH old AS (
+			SELECT object_key FROM file_renditions WHERE file_id = $1 AND kind = $2 AND size = $3
+		)
+		INSERT INTO file_renditions (file_id, kind, size, width, height, mime_type, byte_size, object_key,
+		                             wrapped_key, key_id, content_encoding, stored_size)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (file_id, kind, size) DO UPDATE
+		SET width = EXCLUDED.width, height = EXCLUDED.height, mime_type = EXCLUDED.mime_type,
+		    byte_size = EXCLUDED.byte_size, object_key = EXCLUDED.object_key,
+		    wrapped_key = EXCLUDED.wrapped_key, key_id = EXCLUDED.key_id,
+		    content_encoding = EXCLUDED.content_encoding, stored_size = EXCLUDED.stored_size, created_at = now()
+		RETURNING id, created_at, (SELECT object_key FROM old)`
+
+	var replaced *string
+	storedSize := rd.ByteSize
+	if rd.StorageInfo.ContentEncoding != "" {
+		storedSize = rd.StorageInfo.StoredSize
+	}
+
+	err := r.pool.QueryRow(ctx, query,
+		rd.FileID, rd.Kind, rd.Size, rd.Width, rd.Height, rd.MimeType, rd.ByteSize, rd.ObjectKey,
+		rd.StorageInfo.WrappedKey, nullString(rd.StorageInfo.KeyID),
+		nullString(rd.StorageInfo.ContentEncoding), storedSize,
+	).Scan(&rd.ID, &rd.CreatedAt, &replaced)
+	if err != nil {
+		return "", fmt.Errorf("save rendition: %w", err)
+	}
+
+	if replaced == nil || *replaced == rd.ObjectKey {
+		return "", nil
+	}
+	return *replaced, nil
+}
+
+// ListRenditions returns the renditions of a file ordered by size. An empty
+// kind matches every kind.
+func (r *FileRepository) ListRenditions(ctx context.Context, fileID int64, kind string) ([]Rendition, error) {
+	query := `SELECT id, file_id, kind, size, width, height, mime_type, byte_size, object_key, created_at
+	           FROM file_renditions
+	           WHERE file_id = $1 AND ($2 = '' OR kind = $2)
+	           ORDER BY kind, size`
+
+	rows, err := r.pool.Query(ctx, query, fileID, kind)
+	if err != nil {
+		return nil, fmt.Errorf("query renditions: %w", err)
+	}
+	defer rows.Close()
+
+	var renditions []Rendition
+	for rows.Next() {
+		var rd Rendition
+		if err := rows.Scan(&rd.ID, &rd.FileID, &rd.Kind, &rd.Size, &rd.Width, &rd.Height, &rd.MimeType, &rd.ByteSize, &rd.ObjectKey, &rd.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan rendition: %w", err)
+		}
+		renditions = append(renditions, rd)
+	}
+
+	return renditions, rows.Err()
+}
+
+func (r *FileRepository) DeleteRendition(ctx context.Context, id int64) error {
+	query := `DELETE FROM file_renditions WHERE id = $1`
+
+	if _, err := r.pool.Exec(ctx, query, id); err != nil {
+		return fmt.Errorf("delete rendition: %w", err)
+	}
+
+	return nil
+}
+
+// ListObjectRefs returns every file, version and rendition row with its object key.
+func (r *FileRepository) ListObjectRefs(ctx context.Context) ([]ObjectRef, error) {
+	query := `SELECT id, 0, 0, object_key, status FROM files
+	           UNION ALL
+	           SELECT fv.file_id, fv.id, 0, fv.object_key, f.status
+	           FROM file_versions fv JOIN files f ON f.id = fv.file_id
+	           WHERE fv.version <> f.version
+	           UNION ALL
+	           SELECT rd.file_id, 0, rd.id, rd.object_key, f.status
+	           FROM file_renditions rd JOIN files f ON f.id = rd.file_id`
+
+	rows, err := r.pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("query object refs: %w", err)
+	}
+	defer rows.Close()
+
+	var refs []ObjectRef
+	for rows.Next() {
+		var ref ObjectRef
+		if err := rows.Scan(&ref.FileID, &ref.VersionID, &ref.RenditionID, &ref.ObjectKey, &ref.Status); err != nil {
+			return nil, fmt.Errorf("scan object ref: %w", err)
+		}
+		refs = append(refs, ref)
+	}
+
+	return refs, rows.Err()
+}
+
+// ObjectInfo returns the data key and content encoding recorded for a file
+// version or rendition object.
+func (r *FileRepository) ObjectInfo(ctx context.Context, objectKey string) (*storage.ObjectInfo, error) {
+	query := `SELECT wrapped_key, key_id, content_encoding, stored_size FROM file_versions WHERE object_key = $1
+	           UNION ALL
+	           SELECT wrapped_key, key_id, content_encoding, stored_size FROM file_renditions WHERE object_key = $1
+	           LIMIT 1`
+
+	var info storage.ObjectInfo
+	var keyID, encoding *string
+	err := r.pool.QueryRow(ctx, query, objectKey).Scan(&info.WrappedKey, &keyID, &encoding, &info.StoredSize)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get object info: %w", err)
+	}
+
+	if keyID != nil {
+		info.KeyID = *keyID
+	}
+	if encoding != nil {
+		info.ContentEncoding = *encoding
+	}
+	return &info, nil
+}
+
+// StaleKeys returns objects whose data key is wrapped by a master key other than keyID.
+func (r *FileRepository) StaleKeys(ctx context.Context, keyID string, limit int) (map[string]storage.ObjectInfo, error) {
+	query := `SELECT object_key, wrapped_key, key_id FROM file_versions
+	           WHERE wrapped_key IS NOT NULL AND key_id <> $1
+	           UNION ALL
+	           SELECT object_key, wrapped_key, key_id FROM file_renditions
+	           WHERE wrapped_key IS NOT NULL AND key_id <> $1
+	           LIMIT $2`
+
+	rows, err := r.pool.Query(ctx, query, keyID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query stale keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := map[string]storage.ObjectInfo{}
+	for rows.Next() {
+		var objectKey string
+		var info storage.ObjectInfo
+		if err := rows.Scan(&objectKey, &info.WrappedKey, &info.KeyID); err != nil {
+			return nil, fmt.Errorf("scan stale key: %w", err)
+		}
+		keys[objectKey] = info
+	}
+
+	return keys, rows.Err()
+}
+
+// UpdateKey replaces the wrapped data key of a file version or rendition
+// object, and of the file while the version is current.
+func (r *FileRepository) UpdateKey(ctx context.Context, objectKey string, info storage.ObjectInfo) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var affected int64
+	for _, query := range []string{
+		`UPDATE files SET wrapped_key = $1, key_id = $2 WHERE object_key = $3`,
+		`UPDATE file_versions SET wrapped_key = $1, key_id = $2 WHERE object_key = $3`,
+		`UPDATE file_renditions SET wrapped_key = $1, key_id = $2 WHERE object_key = $3`,
+	} {
+		ct, err := tx.Exec(ctx, query, info.WrappedKey, info.KeyID, objectKey)
+		if err != nil {
+			return fmt.Errorf("update wrapped key: %w", err)
+		}
+		affected += ct.RowsAffected()
+	}
+
+	if affected == 0 {
+		return fmt.Errorf("object %q %w", objectKey, ErrNotFound)
+	}
+
+	return tx.Commit(ctx)
+}
+
+// foreignKeyViolation is the PostgreSQL SQLSTATE for foreign_key_violation.
+const foreignKeyViolation = "23503"
+
+func isForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolation
+}
+
+func nullString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// ReplaceChunks replaces the chunks of a file with chunks of the given
+// version. It does nothing if the file has moved on to another version in
+// the meantime, so a slow indexing run cannot overwrite a newer one.
+func (r *FileRepository) ReplaceChunks(ctx context.Context, fileID int64, version int, model string, chunks []Chunk) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var current int
+	err = tx.QueryRow(ctx, `SELECT version FROM files WHERE id = $1 AND status = 'active' FOR UPDATE`, fileID).Scan(&current)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("file with id %d %w", fileID, ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("lock file: %w", err)
+	}
+	if current != version {
+		return nil
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM file_chunks WHERE file_id = $1`, fileID); err != nil {
+		return fmt.Errorf("delete chunks: %w", err)
+	}
+
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"file_chunks"},
+		[]string{"file_id", "version", "chunk_index", "start_offset", "end_offset", "content", "model", "embedding"},
+		pgx.CopyFromSlice(len(chunks), func(i int) ([]any, error) {
+			c := chunks[i]
+			return []any{fileID, version, c.Index, c.Start, c.End, c.Content, model, c.Embedding}, nil
+		}))
+	if err != nil {
+		return fmt.Errorf("insert chunks: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit tx: %w", err)
+	}
+
+	return nil
+}
+
+func (r *FileRepository) CreateAnalysis(ctx context.Context, a *Analysis) error {
+	query := `
+		INSERT INTO analyses (file_id, version, type, model, prompt_name, prompt_version, input_hash, output,
+		                      input_tokens, output_tokens, latency_ms, cached)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING id, created_at`
+
+	err := r.pool.QueryRow(ctx, query,
+		a.FileID, a.Version, a.Type, a.Model, a.PromptName, a.PromptVersion, a.InputHash, a.Output,
+		a.InputTokens, a.OutputTokens, a.LatencyMs, a.Cached,
+	).Scan(&a.ID, &a.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("insert analysis: %w", err)
 	}
 
 	return nil
 }
+
+// ListAnalyses returns the analyses of a file, newest first.
+func (r *FileRepository) ListAnalyses(ctx context.Context, fileID int64, filter AnalysisFilter) ([]Analysis, error) {
+	query := `SELECT id, file_id, version, type, model, prompt_name, prompt_version, input_hash, output,
+	                 input_tokens, output_tokens, latency_ms, cached, created_at
+	           FROM analyses
+	           WHERE file_id = $1 AND ($2 = '' OR type = $2)
+	             AND ($5::timestamptz IS NULL OR created_at >= $5)
+	           ORDER BY created_at DESC, id DESC
+	           LIMIT NULLIF($3, 0) OFFSET $4`
+
+	rows, err := r.pool.Query(ctx, query, fileID, filter.Type, filter.Limit, filter.Offset, filter.Since)
+	if err != nil {
+		return nil, fmt.Errorf("query analyses: %w", err)
+	}
+	defer rows.Close()
+
+	var analyses []Analysis
+	for rows.Next() {
+		var a Analysis
+		err := rows.Scan(&a.ID, &a.FileID, &a.Version, &a.Type, &a.Model, &a.PromptName, &a.PromptVersion, &a.InputHash, &a.Output,
+			&a.InputTokens, &a.OutputTokens, &a.LatencyMs, &a.Cached, &a.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("scan analysis: %w", err)
+		}
+		analyses = append(analyses, a)
+	}
+
+	return analyses, rows.Err()
+}
+
+func (r *FileRepository) GetCachedAnalysis(ctx context.Context, key AnalysisCacheKey) (*CachedAnalysis, error) {
+	query := `SELECT response_model, input_hash, output, input_tokens, output_tokens
+	           FROM analysis_cache
+	           WHERE content_hash = $1 AND type = $2 AND model = $3 AND prompt_version = $4 AND prompt_hash = $5`
+
+	var c CachedAnalysis
+	err := r.pool.QueryRow(ctx, query, key.ContentHash, key.Type, key.Model, key.PromptVersion, key.PromptHash).
+		Scan(&c.Model, &c.InputHash, &c.Output, &c.InputTokens, &c.OutputTokens)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("cached %s analysis %w", key.Type, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get cached analysis: %w", err)
+	}
+
+	return &c, nil
+}
+
+// SaveCachedAnalysis stores a result for reuse, replacing any result cached
+// under the same key, such as the one a forced analysis re-ran.
+func (r *FileRepository) SaveCachedAnalysis(ctx context.Context, key AnalysisCacheKey, c *CachedAnalysis) error {
+	query := `
+		INSERT INTO analysis_cache (content_hash, type, model, prompt_version, prompt_hash,
+		                            response_model, input_hash, output, input_tokens, output_tokens)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (content_hash, type, model, prompt_version, prompt_hash) DO UPDATE
+		SET response_model = EXCLUDED.response_model, input_hash = EXCLUDED.input_hash, output = EXCLUDED.output,
+		    input_tokens = EXCLUDED.input_tokens, output_tokens = EXCLUDED.output_tokens, created_at = now()`
+
+	_, err := r.pool.Exec(ctx, query,
+		key.ContentHash, key.Type, key.Model, key.PromptVersion, key.PromptHash,
+		c.Model, c.InputHash, c.Output, c.InputTokens, c.OutputTokens,
+	)
+	if err != nil {
+		return fmt.Errorf("save cached analysis: %w", err)
+	}
+
+	return nil
+}
+
+func (r *FileRepository) CountCachedAnalyses(ctx context.Context) (int, error) {
+	var n int
+	if err := r.pool.QueryRow(ctx, `SELECT COUNT(*) FROM analysis_cache`).Scan(&n); err != nil {
+		return 0, fmt.Errorf("count cached analyses: %w", err)
+	}
+	return n, nil
+}
+
+// AnalysisCacheHits counts the analyses of each type recorded since since
+// (all of them when nil) and how many of them were served from the cache.
+func (r *FileRepository) AnalysisCacheHits(ctx context.Context, since *time.Time) ([]AnalysisTypeStats, error) {
+	query := `SELECT type, COUNT(*), COUNT(*) FILTER (WHERE cached)
+	           FROM analyses
+	           WHERE $1::timestamptz IS NULL OR created_at >= $1
+	           GROUP BY type
+	           ORDER BY type`
+
+	rows, err := r.pool.Query(ctx, query, since)
+	if err != nil {
+		return nil, fmt.Errorf("query analysis cache hits: %w", err)
+	}
+	defer rows.Close()
+
+	var stats []AnalysisTypeStats
+	for rows.Next() {
+		var st AnalysisTypeStats
+		if err := rows.Scan(&st.Type, &st.Requests, &st.Hits); err != nil {
+			return nil, fmt.Errorf("scan analysis cache hits: %w", err)
+		}
+		stats = append(stats, st)
+	}
+
+	return stats, rows.Err()
+}
+
+// ListChunks returns the chunks of a version of a file embedded with model,
+// in text order.
+func (r *FileRepository) ListChunks(ctx context.Context, fileID int64, version int, model string) ([]Chunk, error) {
+	query := `SELECT chunk_index, start_offset, end_offset, content, embedding
+	           FROM file_chunks WHERE file_id = $1 AND version = $2 AND model = $3
+	           ORDER BY chunk_index`
+
+	rows, err := r.pool.Query(ctx, query, fileID, version, model)
+	if err != nil {
+		return nil, fmt.Errorf("query chunks: %w", err)
+	}
+	defer rows.Close()
+
+	var chunks []Chunk
+	for rows.Next() {
+		var c Chunk
+		if err := rows.Scan(&c.Index, &c.Start, &c.End, &c.Content, &c.Embedding); err != nil {
+			return nil, fmt.Errorf("scan chunk: %w", err)
+		}
+		chunks = append(chunks, c)
+	}
+
+	return chunks, rows.Err()
+}
+
+// GetExtractedText returns the text extracted from the current content of a
+// file, empty if there is none.
+func (r *FileRepository) GetExtractedText(ctx context.Context, id int64) (string, error) {
+	query := `SELECT COALESCE(extracted_text, '')
+	           FROM files WHERE id = $1 AND status = 'active' AND deleted_at IS NULL`
+
+	var text string
+	err := r.pool.QueryRow(ctx, query, id).Scan(&text)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", fmt.Errorf("file with id %d %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return "", fmt.Errorf("get extracted text: %w", err)
+	}
+
+	return text, nil
+}
+
+// NearestChunks returns up to limit chunks embedded with model that are the
+// most similar to query, among the files matching filter. The similarity is
+// computed by pgvector when it is installed, and in Go otherwise.
+func (r *FileRepository) NearestChunks(ctx context.Context, model string, query []float32, filter ListFilter, limit int) ([]ChunkMatch, error) {
+	r.pgvectorOnce.Do(func() {
+		err := r.pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'vector')`).Scan(&r.pgvector)
+		if err != nil {
+			log.Printf("check for pgvector: %v", err)
+		}
+	})
+
+	if r.pgvector {
+		return r.nearestChunksPgvector(ctx, model, query, filter, limit)
+	}
+	return r.nearestChunksScan(ctx, model, query, filter, limit)
+}
+
+func (r *FileRepository) nearestChunksPgvector(ctx context.Context, model string, query []float32, filter ListFilter, limit int) ([]ChunkMatch, error) {
+	q := `SELECT c.file_id, c.chunk_index, c.start_offset, c.end_offset, c.content,
+	                  1 - (c.embedding::vector <=> $5::vector) AS score
+	           FROM file_chunks c JOIN files ON files.id = c.file_id AND files.version = c.version
+	           WHERE ` + listWhere + ` AND c.model = $6 AND cardinality(c.embedding) = $7
+	           ORDER BY c.embedding::vector <=> $5::vector
+	           LIMIT $8`
+
+	rows, err := r.pool.Query(ctx, q, append(listArgs(filter), vectorLiteral(query), model, len(query), limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("query nearest chunks: %w", err)
+	}
+	defer rows.Close()
+
+	var matches []ChunkMatch
+	for rows.Next() {
+		var m ChunkMatch
+		if err := rows.Scan(&m.FileID, &m.Index, &m.Start, &m.End, &m.Content, &m.Score); err != nil {
+			return nil, fmt.Errorf("scan chunk: %w", err)
+		}
+		matches = append(matches, m)
+	}
+
+	return matches, rows.Err()
+}
+
+// nearestChunksScan compares the query with every candidate chunk, keeping
+// the best limit, then loads the content of those.
+func (r *FileRepository) nearestChunksScan(ctx context.Context, model string, query []float32, filter ListFilter, limit int) ([]ChunkMatch, error) {
+	q := `SELECT c.id, c.file_id, c.chunk_index, c.start_offset, c.end_offset, c.embedding
+	           FROM file_chunks c JOIN files ON files.id = c.file_id AND files.version = c.version
+	           WHERE ` + listWhere + ` AND c.model = $5`
+
+	rows, err := r.pool.Query(ctx, q, append(listArgs(filter), model)...)
+	if err != nil {
+		return nil, fmt.Errorf("query chunks: %w", err)
+	}
+	defer rows.Close()
+
+	best := make(chunkHeap, 0, limit)
+	var embedding []float32
+	for rows.Next() {
+		var c scoredChunk
+		if err := rows.Scan(&c.id, &c.match.FileID, &c.match.Index, &c.match.Start, &c.match.End, &embedding); err != nil {
+			return nil, fmt.Errorf("scan chunk: %w", err)
+		}
+		if len(embedding) != len(query) {
+			continue
+		}
+		c.match.Score = cosineSimilarity(query, embedding)
+
+		if len(best) < limit {
+			heap.Push(&best, c)
+		} else if limit > 0 && c.match.Score > best[0].match.Score {
+			best[0] = c
+			heap.Fix(&best, 0)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	matches := make([]ChunkMatch, len(best))
+	ids := make([]int64, len(best))
+	index := make(map[int64]int, len(best))
+	for i := len(best) - 1; i >= 0; i-- {
+		c := heap.Pop(&best).(scoredChunk)
+		matches[i], ids[i], index[c.id] = c.match, c.id, i
+	}
+
+	contents, err := r.pool.Query(ctx, `SELECT id, content FROM file_chunks WHERE id = ANY($1)`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("query chunk contents: %w", err)
+	}
+	defer contents.Close()
+
+	for contents.Next() {
+		var id int64
+		var content string
+		if err := contents.Scan(&id, &content); err != nil {
+			return nil, fmt.Errorf("scan chunk content: %w", err)
+		}
+		matches[index[id]].Content = content
+	}
+
+	return matches, contents.Err()
+}
+
+// scoredChunk is a chunk candidate of nearestChunksScan.
+type scoredChunk struct {
+	id    int64
+	match ChunkMatch
+}
+
+// chunkHeap is a min-heap of chunks by score, holding the best ones seen.
+type chunkHeap []scoredChunk
+
+func (h chunkHeap) Len() int           { return len(h) }
+func (h chunkHeap) Less(i, j int) bool { return h[i].match.Score < h[j].match.Score }
+func (h chunkHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *chunkHeap) Push(x any)        { *h = append(*h, x.(scoredChunk)) }
+func (h *chunkHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// vectorLiteral formats a vector as pgvector text input, e.g. "[0.1,0.2]".
+func vectorLiteral(v []float32) string {
+	var sb strings.Builder
+	sb.WriteByte('[')
+	for i, x := range v {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(strconv.FormatFloat(float64(x), 'g', -1, 32))
+	}
+	sb.WriteByte(']')
+	return sb.String()
+}
@@ -34,11 +34,33 @@ func ConsumeAnalysisResults(ctx context.Context, consumer messaging.Consumer, re
 				log.Printf("analysis error for file %d: %s", reply.FileID, reply.Error)
 				continue
 			}
-			if err := repo.UpdateTranslationSummary(ctx, reply.FileID, reply.TranslationSummary); err != nil {
-				log.Printf("update translation summary for file %d: %v", reply.FileID, err)
-			} else {
-				log.Printf("translation summary updated for file %d", reply.FileID)
+			if reply.TranslationSummary != "" {
+				if err := repo.UpdateTranslationSummary(ctx, reply.FileID, reply.Version, reply.TranslationSummary); err != nil {
+					log.Printf("update translation summary for file %d version %d: %v", reply.FileID, reply.Version, err)
+				} else {
+					log.Printf("translation summary updated for file %d version %d", reply.FileID, reply.Version)
+				}
 			}
+			saveTranslations(ctx, repo, reply)
+		}
+	}
+}
+
+// saveTranslations stores the per-language translations of a reply, skipping
+// languages that are not valid tags.
+func saveTranslations(ctx context.Context, repo repository, reply AnalysisReply) {
+	for language, content := range reply.Translations {
+		lang, err := normalizeLanguage(language)
+		if err != nil {
+			log.Printf("translation for file %d version %d: %v", reply.FileID, reply.Version, err)
+			continue
+		}
+
+		t := &Translation{FileID: reply.FileID, Version: reply.Version, Language: lang, Content: content}
+		if err := repo.SaveTranslation(ctx, t); err != nil {
+			log.Printf("save %s translation for file %d version %d: %v", lang, reply.FileID, reply.Version, err)
+		} else {
+			log.Printf("%s translation saved for file %d version %d", lang, reply.FileID, t.Version)
 		}
 	}
 }
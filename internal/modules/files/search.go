@@ -0,0 +1,131 @@
+package files
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// defaultSearchLimit is the page size of searches that do not set a limit.
+const defaultSearchLimit = 20
+
+// SearchFiles runs a full-text search over file names, analysis summaries
+// and extracted text, narrowed by filter. See parseSearchQuery for the
+// query syntax.
+func (s *FileService) SearchFiles(ctx context.Context, q string, filter ListFilter) (*SearchResults, error) {
+	tsQuery, err := parseSearchQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	if filter.Tags, err = normalizeTags(filter.Tags); err != nil {
+		return nil, err
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultSearchLimit
+	}
+
+	hits, err := s.repo.Search(ctx, tsQuery, filter)
+	if err != nil {
+		return nil, fmt.Errorf("search files: %w", err)
+	}
+	if hits == nil {
+		hits = []SearchHit{}
+	}
+
+	total, err := s.repo.CountSearch(ctx, tsQuery, filter)
+	if err != nil {
+		return nil, fmt.Errorf("count search hits: %w", err)
+	}
+
+	return &SearchResults{Hits: hits, Total: total, Limit: filter.Limit, Offset: filter.Offset}, nil
+}
+
+// parseSearchQuery converts a search string into a to_tsquery expression.
+// Terms must all match; OR between two terms matches either. A "quoted
+// phrase" matches its words in order, a trailing * matches words starting
+// with the term and a leading - excludes the term. Punctuation inside a
+// word, as in e-mail, joins its parts into a phrase.
+func parseSearchQuery(q string) (string, error) {
+	var parts []string
+	positive := false
+	op := ""
+
+	for rest := strings.TrimSpace(q); rest != ""; rest = strings.TrimLeftFunc(rest, unicode.IsSpace) {
+		negate := false
+		if rest[0] == '-' {
+			negate, rest = true, rest[1:]
+		}
+
+		var term string
+		var phrase bool
+		if strings.HasPrefix(rest, `"`) {
+			var ok bool
+			term, rest, ok = strings.Cut(rest[1:], `"`)
+			if !ok {
+				rest = ""
+			}
+			phrase = true
+		} else {
+			end := strings.IndexFunc(rest, func(r rune) bool { return unicode.IsSpace(r) || r == '"' })
+			if end < 0 {
+				end = len(rest)
+			}
+			term, rest = rest[:end], rest[end:]
+		}
+
+		if !phrase && !negate && term == "OR" {
+			if len(parts) > 0 {
+				op = " | "
+			}
+			continue
+		}
+
+		prefix := !phrase && strings.HasSuffix(term, "*")
+		expr := tsPhrase(strings.TrimRight(term, "*"), prefix)
+		if expr == "" {
+			continue
+		}
+
+		if negate {
+			expr = "!(" + expr + ")"
+		} else {
+			positive = true
+		}
+		if len(parts) > 0 {
+			if op == "" {
+				op = " & "
+			}
+			parts = append(parts, op)
+		}
+		parts = append(parts, expr)
+		op = ""
+	}
+
+	if !positive {
+		return "", fmt.Errorf("search query %q has no terms: %w", q, ErrInvalid)
+	}
+
+	return strings.Join(parts, ""), nil
+}
+
+// tsPhrase quotes the words of text as lexemes that must follow each other,
+// marking the last one as a prefix when prefix is set.
+func tsPhrase(text string, prefix bool) string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return ""
+	}
+
+	lexemes := make([]string, len(words))
+	for i, w := range words {
+		lexemes[i] = "'" + strings.ToLower(w) + "'"
+	}
+	if prefix {
+		lexemes[len(lexemes)-1] += ":*"
+	}
+
+	return strings.Join(lexemes, " <-> ")
+}
@@ -1,49 +1,278 @@
 package files
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"golang.org/x/time/rate"
 
+	"github.com/mamed-gasimov/file-service/internal/cache"
 	"github.com/mamed-gasimov/file-service/internal/messaging"
+	"github.com/mamed-gasimov/file-service/internal/metadata"
 	"github.com/mamed-gasimov/file-service/internal/modules/analysis"
+	"github.com/mamed-gasimov/file-service/internal/modules/jobs"
 	"github.com/mamed-gasimov/file-service/internal/storage"
 )
 
 const maxAnalysisContentLen = 100_000
 
+// maxProcessingSize caps how much of a file is read into memory for metadata
+// extraction, metadata stripping and thumbnail rendering.
+const maxProcessingSize = 50 << 20
+
 type service interface {
-	ListFiles(ctx context.Context) ([]File, error)
-	UploadFile(ctx context.Context, filename string, reader io.Reader, size int64, contentType string) (*File, error)
+	ListFiles(ctx context.Context, filter ListFilter) ([]File, error)
+	CountFiles(ctx context.Context, filter ListFilter) (int, error)
+	SearchFiles(ctx context.Context, q string, filter ListFilter) (*SearchResults, error)
+	SemanticSearch(ctx context.Context, q string, filter ListFilter) (*SemanticResults, error)
+	AskFile(ctx context.Context, id int64, question string, stream func(delta string) error) (*Answer, error)
+	MoveFile(ctx context.Context, id int64, folderID *int64, name string) (*File, error)
+	GetFile(ctx context.Context, id int64) (*File, error)
+	UpdateFile(ctx context.Context, id int64, ifMatch string, patch FilePatch) (*File, error)
+	TrashFolders(ctx context.Context, folderIDs []int64) (int, error)
+	UploadFile(ctx context.Context, filename string, reader io.Reader, size int64, contentType string, opts UploadOptions) (*File, error)
 	DeleteFile(ctx context.Context, id int64) error
-	AnalyzeFile(ctx context.Context, id int64) (*File, error)
+	ListTrash(ctx context.Context) ([]File, error)
+	RestoreFile(ctx context.Context, id int64) (*File, error)
+	PurgeFile(ctx context.Context, id int64) error
+	AnalyzeFile(ctx context.Context, id int64, opts AnalysisOptions) (*Analysis, error)
+	SubmitAnalysis(ctx context.Context, id int64, opts AnalysisOptions) (*jobs.Job, error)
+	SubmitAnalysisBatch(ctx context.Context, opts BatchOptions) (*jobs.Job, error)
+	ListAnalyses(ctx context.Context, id int64, filter AnalysisFilter) ([]Analysis, error)
+	AnalysisCacheStats(ctx context.Context, since *time.Time) (*AnalysisCacheStats, error)
+	GetThumbnail(ctx context.Context, id int64, size int) (*Rendition, io.ReadCloser, error)
+	DownloadFile(ctx context.Context, id int64, version int, rng *ByteRange, acceptEncodings []string) (*Download, error)
+	UpdateContent(ctx context.Context, id int64, reader io.Reader, size int64, contentType string, opts UploadOptions) (*File, error)
+	ListVersions(ctx context.Context, id int64) ([]Version, error)
+	RestoreVersion(ctx context.Context, id int64, version int) (*File, error)
+	ListTranslations(ctx context.Context, id int64) ([]Translation, error)
+	GetTranslation(ctx context.Context, id int64, language string) (*Translation, error)
+	GetPIIReport(ctx context.Context, id int64) (*PIIReport, error)
+	GetRedacted(ctx context.Context, id int64) (*Rendition, io.ReadCloser, error)
+	GetTranscript(ctx context.Context, id int64) (*analysis.Transcript, error)
 }
 
 var _ service = (*FileService)(nil)
 
 type FileService struct {
-	repo      repository
-	storage   storage.Storage
-	analyzer  analysis.Provider
-	publisher messaging.Publisher
+	repo        repository
+	storage     storage.Storage
+	analyzer    analysis.Provider
+	publisher   messaging.Publisher
+	embedder    analysis.Embedder
+	answerer    analysis.Answerer
+	transcriber analysis.Transcriber
+	vision      analysis.ImageAnalyzer
+	prompts     promptStore
+	usage       usageMeter
+	jobs        jobQueue
+
+	analysisCache   *cache.LRU[AnalysisCacheKey, *CachedAnalysis]
+	analysisLimiter *rate.Limiter
+
+	batchConcurrency int
+	visionMaxSize    int
+
+	detectPII bool
+	piiModel  analysis.PIIDetector
+	redactPII bool
+
+	thumbnailSizes       []int
+	trashRetention       time.Duration
+	maxVersions          int
+	privateMetadata      bool
+	translationLanguages []string
+}
+
+// Option configures optional FileService features.
+type Option func(*FileService)
+
+// WithThumbnailSizes enables thumbnail generation for uploaded images. Each
+// size is the maximum length in pixels of the thumbnail's longest side;
+// sizes that are not positive are ignored.
+func WithThumbnailSizes(sizes ...int) Option {
+	return func(s *FileService) {
+		s.thumbnailSizes = nil
+		for _, size := range sizes {
+			if size > 0 {
+				s.thumbnailSizes = append(s.thumbnailSizes, size)
+			}
+		}
+	}
+}
+
+// WithTrashRetention makes the reaper permanently delete files that have
+// been in the trash for longer than d. Without it, trashed files are kept
+// until purged.
+func WithTrashRetention(d time.Duration) Option {
+	return func(s *FileService) {
+		s.trashRetention = d
+	}
+}
+
+// WithMaxVersions keeps at most n versions of each file, deleting the oldest
+// when a new one is added. Without it, every version is kept.
+func WithMaxVersions(n int) Option {
+	return func(s *FileService) {
+		s.maxVersions = n
+	}
+}
+
+// WithPrivateMetadata keeps the GPS position and camera serial number of
+// photos in file properties. Without it they are left out, as the
+// properties are returned to every caller.
+func WithPrivateMetadata() Option {
+	return func(s *FileService) {
+		s.privateMetadata = true
+	}
+}
+
+// WithPIIDetection scans the text of every new file version for personal
+// data and stores a redacted rendition of it. When model is non-nil it also
+// finds what patterns cannot, such as the names of people.
+func WithPIIDetection(model analysis.PIIDetector) Option {
+	return func(s *FileService) {
+		s.detectPII = true
+		s.piiModel = model
+	}
+}
+
+// WithPIIRedaction replaces the personal data in file text before it leaves
+// the service: in the input of analyses, the passages questions are
+// answered from, the chunks embedded for semantic search and the analysis
+// requests of ai-service, which get the redacted text instead of the file.
+// Files without text are not sent to ai-service.
+func WithPIIRedaction() Option {
+	return func(s *FileService) {
+		s.redactPII = true
+	}
+}
+
+// WithEmbedder enables semantic search, embedding the text of files with e
+// when they are uploaded or analyzed.
+func WithEmbedder(e analysis.Embedder) Option {
+	return func(s *FileService) {
+		s.embedder = e
+	}
+}
+
+// WithAnswerer lets clients ask questions about a file's content. The
+// answerer a answers each question from the passages most relevant to it.
+func WithAnswerer(a analysis.Answerer) Option {
+	return func(s *FileService) {
+		s.answerer = a
+	}
+}
+
+// WithTranscriber lets analyses read audio and video files, through a
+// transcript t makes of them.
+func WithTranscriber(t analysis.Transcriber) Option {
+	return func(s *FileService) {
+		s.transcriber = t
+	}
+}
+
+// WithImageAnalyzer lets analyses look at JPEG, PNG, GIF and WebP images
+// with the vision model of a, instead of reading their bytes as text.
+// Images are scaled down to at most maxSize pixels on their longest side
+// first, 1024 when maxSize is not positive.
+func WithImageAnalyzer(a analysis.ImageAnalyzer, maxSize int) Option {
+	return func(s *FileService) {
+		if maxSize <= 0 {
+			maxSize = defaultVisionMaxSize
+		}
+		s.vision, s.visionMaxSize = a, maxSize
+	}
+}
+
+// WithPromptTemplates lets analyses use the prompt templates of store.
+func WithPromptTemplates(store promptStore) Option {
+	return func(s *FileService) {
+		s.prompts = store
+	}
+}
+
+// WithUsageMeter accounts the tokens and cost of AI calls with m, and stops
+// analyses and questions once its daily budget is spent.
+func WithUsageMeter(m usageMeter) Option {
+	return func(s *FileService) {
+		s.usage = m
+	}
+}
+
+// WithJobs runs the analyses submitted with SubmitAnalysis and the
+// thumbnails of uploaded images as jobs of q.
+func WithJobs(q jobQueue) Option {
+	return func(s *FileService) {
+		s.jobs = q
+	}
+}
+
+// WithTranslationLanguages requests translations into languages, which
+// must be normalized with NormalizeLanguages, for uploads that do not name
+// their own target languages.
+func WithTranslationLanguages(languages ...string) Option {
+	return func(s *FileService) {
+		s.translationLanguages = languages
+	}
+}
+
+// WithAnalysisRateLimit lets at most perMinute analyses call the model per
+// minute, in bursts of up to a tenth of that. Analyses answered from the
+// cache do not count.
+func WithAnalysisRateLimit(perMinute int) Option {
+	return func(s *FileService) {
+		s.analysisLimiter = rate.NewLimiter(rate.Limit(float64(perMinute)/60), max(perMinute/10, 1))
+	}
+}
+
+// WithBatchConcurrency runs up to n analyses of a batch at a time (4 by
+// default).
+func WithBatchConcurrency(n int) Option {
+	return func(s *FileService) {
+		s.batchConcurrency = max(n, 1)
+	}
+}
+
+// WithAnalysisCache keeps up to size cached analysis results in memory in
+// front of the analysis_cache table.
+func WithAnalysisCache(size int) Option {
+	return func(s *FileService) {
+		s.analysisCache = cache.NewLRU[AnalysisCacheKey, *CachedAnalysis](size)
+	}
 }
 
-func NewFileService(repo repository, storage storage.Storage, analyzer analysis.Provider, publisher messaging.Publisher) *FileService {
-	return &FileService{
+func NewFileService(repo repository, storage storage.Storage, analyzer analysis.Provider, publisher messaging.Publisher, opts ...Option) *FileService {
+	s := &FileService{
 		repo:      repo,
 		storage:   storage,
 		analyzer:  analyzer,
 		publisher: publisher,
+
+		batchConcurrency: defaultBatchConcurrency,
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
 
-func (s *FileService) ListFiles(ctx context.Context) ([]File, error) {
-	files, err := s.repo.List(ctx)
+func (s *FileService) ListFiles(ctx context.Context, filter ListFilter) ([]File, error) {
+	var err error
+	if filter.Tags, err = normalizeTags(filter.Tags); err != nil {
+		return nil, err
+	}
+
+	files, err := s.repo.List(ctx, filter)
 	if err != nil {
 		return nil, fmt.Errorf("list files: %w", err)
 	}
@@ -55,31 +284,179 @@ func (s *FileService) ListFiles(ctx context.Context) ([]File, error) {
 	return files, nil
 }
 
-func (s *FileService) UploadFile(ctx context.Context, filename string, reader io.Reader, size int64, contentType string) (*File, error) {
-	objectKey := generateObjectKey(filename)
+func (s *FileService) UploadFile(ctx context.Context, filename string, reader io.Reader, size int64, contentType string, opts UploadOptions) (*File, error) {
+	tags, err := normalizeTags(opts.Tags)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateMetadata(opts.Metadata); err != nil {
+		return nil, err
+	}
+	languages, err := s.targetLanguages(opts)
+	if err != nil {
+		return nil, err
+	}
 
-	if err := s.storage.Upload(ctx, objectKey, reader, size, contentType); err != nil {
-		return nil, fmt.Errorf("upload to storage: %w", err)
+	v, content, err := s.storeContent(ctx, filename, reader, size, contentType, opts)
+	if err != nil {
+		return nil, err
 	}
 
 	f := &File{
-		Name:      filename,
-		Size:      size,
-		MimeType:  contentType,
-		ObjectKey: objectKey,
+		Name:            filename,
+		Size:            v.Size,
+		MimeType:        v.MimeType,
+		ObjectKey:       v.ObjectKey,
+		ContentHash:     v.ContentHash,
+		FolderID:        opts.FolderID,
+		Tags:            tags,
+		Metadata:        opts.Metadata,
+		Properties:      v.Properties,
+		ContentEncoding: v.ContentEncoding,
+		StoredSize:      v.StoredSize,
+		StorageInfo:     v.StorageInfo,
+		ExtractedText:   v.ExtractedText,
 	}
 
 	if err := s.repo.Create(ctx, f); err != nil {
-		_ = s.storage.Delete(ctx, objectKey)
+		s.discardObject(ctx, v.ObjectKey)
 		return nil, fmt.Errorf("save file record: %w", err)
 	}
 
-	// Publish async translation request — non-fatal if broker is unavailable.
+	s.requestThumbnails(ctx, f, content)
+	if f.ExtractedText != nil {
+		s.requestPIIScan(ctx, f, *f.ExtractedText)
+		s.requestEmbeddings(ctx, f, *f.ExtractedText)
+	}
+
+	s.requestAnalysis(ctx, f, languages)
+
+	return f, nil
+}
+
+func (s *FileService) CountFiles(ctx context.Context, filter ListFilter) (int, error) {
+	n, err := s.repo.Count(ctx, filter)
+	if err != nil {
+		return 0, fmt.Errorf("count files: %w", err)
+	}
+
+	return n, nil
+}
+
+// MoveFile puts a live file into a folder, nil meaning the root, and renames
+// it when name is not empty.
+func (s *FileService) MoveFile(ctx context.Context, id int64, folderID *int64, name string) (*File, error) {
+	if name == "" {
+		file, err := s.repo.GetByID(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("file not found: %w", err)
+		}
+		name = file.Name
+	}
+
+	f, err := s.repo.Move(ctx, id, folderID, name)
+	if err != nil {
+		return nil, fmt.Errorf("move file: %w", err)
+	}
+
+	return f, nil
+}
+
+// TrashFolders moves the live files of the given folders to the trash. It is
+// used when folders are deleted, so their files stay restorable.
+func (s *FileService) TrashFolders(ctx context.Context, folderIDs []int64) (int, error) {
+	n, err := s.repo.TrashInFolders(ctx, folderIDs)
+	if err != nil {
+		return 0, fmt.Errorf("trash folder contents: %w", err)
+	}
+
+	return n, nil
+}
+
+// storeContent uploads new content under a fresh object key and describes it
+// as a version, not yet numbered or saved. It also returns the content when
+// it was read for processing, so renditions can be derived from it.
+func (s *FileService) storeContent(ctx context.Context, filename string, reader io.Reader, size int64, contentType string, opts UploadOptions) (*Version, []byte, error) {
+	if opts.StripMetadata && metadata.CanStrip(contentType) {
+		stripped, err := stripMetadata(reader, size)
+		if err != nil {
+			return nil, nil, err
+		}
+		reader, size = bytes.NewReader(stripped), int64(len(stripped))
+	}
+
+	objectKey := generateObjectKey(filename)
+
+	// objCtx collects what storage decorators did to the object (e.g. the
+	// wrapped encryption key) so it can be persisted with the record.
+	info := &storage.ObjectInfo{}
+	objCtx := storage.WithObjectInfo(ctx, info)
+
+	hash := sha256.New()
+	if err := s.storage.Upload(objCtx, objectKey, io.TeeReader(reader, hash), size, contentType); err != nil {
+		return nil, nil, fmt.Errorf("upload to storage: %w", err)
+	}
+	contentHash := hex.EncodeToString(hash.Sum(nil))
+
+	v := &Version{
+		Size:        size,
+		MimeType:    contentType,
+		ObjectKey:   objectKey,
+		ContentHash: &contentHash,
+		StoredSize:  size,
+		StorageInfo: *info,
+	}
+	if info.ContentEncoding != "" {
+		v.ContentEncoding = &info.ContentEncoding
+		v.StoredSize = info.StoredSize
+	}
+
+	// Derived data is best-effort: the upload succeeds without it.
+	var content []byte
+	if needsProcessing(v.MimeType) {
+		data, err := s.readObject(objCtx, objectKey, maxProcessingSize)
+		if err != nil {
+			log.Printf("read %q for processing: %v", objectKey, err)
+		} else {
+			content = data
+			v.Properties = metadata.Extract(content, v.Size, v.MimeType, s.privateMetadata)
+			if text := metadata.ExtractText(content, v.MimeType); text != "" {
+				v.ExtractedText = &text
+			}
+		}
+	}
+
+	return v, content, nil
+}
+
+// discardObject removes an object whose record could not be saved. An
+// object left behind here is removed by the reconciler.
+func (s *FileService) discardObject(ctx context.Context, objectKey string) {
+	if err := s.storage.Delete(ctx, objectKey); err != nil {
+		log.Printf("remove object %q of failed upload: %v", objectKey, err)
+	}
+}
+
+// requestAnalysis publishes an async translation request for the current
+// version of f into languages — non-fatal if the broker is unavailable.
+func (s *FileService) requestAnalysis(ctx context.Context, f *File, languages []string) {
 	req := AnalyzeRequest{
-		FileID:        f.ID,
-		ObjectKey:     f.ObjectKey,
-		ContentType:   f.MimeType,
-		CorrelationID: uuid.NewString(),
+		FileID:          f.ID,
+		Version:         f.Version,
+		ObjectKey:       f.ObjectKey,
+		ContentType:     f.MimeType,
+		TargetLanguages: languages,
+		CorrelationID:   uuid.NewString(),
+	}
+	if s.redactPII {
+		// ai-service reads the object it is given: with redaction on, that
+		// is the redacted text, and files without one are not sent at all.
+		rd, err := s.redactedRendition(ctx, f)
+		if err != nil {
+			log.Printf("not publishing analyze request for file %d: %v", f.ID, err)
+			return
+		}
+		req.ObjectKey, req.ContentType = rd.ObjectKey, rd.MimeType
 	}
 	body, err := json.Marshal(req)
 	if err != nil {
@@ -87,62 +464,159 @@ func (s *FileService) UploadFile(ctx context.Context, filename string, reader io
 	} else if err := s.publisher.Publish(ctx, "", "file.analyze", body); err != nil {
 		log.Printf("publish analyze request for file %d: %v", f.ID, err)
 	} else {
-		log.Printf("published analyze request for file %d", f.ID)
+		log.Printf("published analyze request for file %d version %d", f.ID, f.Version)
 	}
-
-	return f, nil
 }
 
+// DeleteFile moves the file to the trash. It stays restorable until it is
+// purged or the trash retention expires.
 func (s *FileService) DeleteFile(ctx context.Context, id int64) error {
-	file, err := s.repo.GetByID(ctx, id)
-	if err != nil {
+	if _, err := s.repo.Trash(ctx, id); err != nil {
 		return fmt.Errorf("file not found: %w", err)
 	}
 
-	if err := s.storage.Delete(ctx, file.ObjectKey); err != nil {
-		return fmt.Errorf("delete from storage: %w", err)
+	return nil
+}
+
+func (s *FileService) ListTrash(ctx context.Context) ([]File, error) {
+	files, err := s.repo.ListTrash(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list trash: %w", err)
+	}
+
+	if files == nil {
+		files = []File{}
+	}
+
+	return files, nil
+}
+
+// RestoreFile takes a file out of the trash.
+func (s *FileService) RestoreFile(ctx context.Context, id int64) (*File, error) {
+	f, err := s.repo.Restore(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("file not in trash: %w", err)
+	}
+
+	return f, nil
+}
+
+// PurgeFile permanently deletes a file that is in the trash.
+func (s *FileService) PurgeFile(ctx context.Context, id int64) error {
+	if err := s.hardDelete(ctx, id, true); err != nil {
+		return fmt.Errorf("file not in trash: %w", err)
 	}
 
-	if err := s.repo.Delete(ctx, id); err != nil {
-		return fmt.Errorf("delete file record: %w", err)
+	return nil
+}
+
+// hardDelete tombstones the file and then removes its objects and row. Once
+// the tombstone is written the delete is reported as done: if removing the
+// objects fails, the reaper finishes the job later.
+func (s *FileService) hardDelete(ctx context.Context, id int64, trashedOnly bool) error {
+	file, err := s.repo.MarkDeleting(ctx, id, trashedOnly)
+	if err != nil {
+		return err
+	}
+
+	if err := s.purge(ctx, file); err != nil {
+		log.Printf("delete file %d (left for the reaper): %v", id, err)
 	}
 
 	return nil
 }
 
-func (s *FileService) AnalyzeFile(ctx context.Context, id int64) (*File, error) {
+// DownloadFile opens the content of a file, or of one of its versions when
+// version is not 0, limited to rng when it is not nil. Full downloads of
+// compressed files are served in their stored encoding when it, or an
+// encoding the storage can transcode to, is listed in acceptEncodings. If
+// rng cannot be satisfied the file record is still returned along with
+// ErrRangeNotSatisfiable.
+func (s *FileService) DownloadFile(ctx context.Context, id int64, version int, rng *ByteRange, acceptEncodings []string) (*Download, error) {
 	file, err := s.repo.GetByID(ctx, id)
 	if err != nil {
 		return nil, fmt.Errorf("file not found: %w", err)
 	}
 
-	rc, err := s.storage.Download(ctx, file.ObjectKey)
+	if version != 0 && version != file.Version {
+		v, err := s.repo.GetVersion(ctx, id, version)
+		if err != nil {
+			return nil, fmt.Errorf("version not found: %w", err)
+		}
+		file = v.apply(file)
+	}
+
+	d := &Download{File: file, Length: file.Size}
+
+	if rng != nil {
+		d.Offset, d.Length, err = rng.Resolve(file.Size)
+		if err != nil {
+			return d, err
+		}
+		d.Partial = true
+	} else if ed, ok := s.storage.(storage.EncodedDownloader); ok && file.ContentEncoding != nil {
+		for _, enc := range preferEncoding(acceptEncodings, *file.ContentEncoding) {
+			rc, err := ed.DownloadEncoded(ctx, file.ObjectKey, enc)
+			if err != nil {
+				log.Printf("download file %d as %s: %v", id, enc, err)
+				continue
+			}
+			d.Content, d.Encoding, d.Length = rc, enc, -1
+			if enc == *file.ContentEncoding {
+				d.Length = file.StoredSize
+			}
+			return d, nil
+		}
+	}
+
+	d.Content, err = s.storage.DownloadRange(ctx, file.ObjectKey, d.Offset, d.Length)
 	if err != nil {
 		return nil, fmt.Errorf("download from storage: %w", err)
 	}
-	defer rc.Close()
 
-	content, err := io.ReadAll(rc)
-	if err != nil {
-		return nil, fmt.Errorf("read file content: %w", err)
+	return d, nil
+}
+
+// preferEncoding orders the accepted encodings so the stored one, which
+// needs no transcoding, comes first.
+func preferEncoding(accepted []string, stored string) []string {
+	ordered := make([]string, 0, len(accepted))
+	for _, enc := range accepted {
+		if enc == stored {
+			ordered = append([]string{enc}, ordered...)
+		} else {
+			ordered = append(ordered, enc)
+		}
 	}
+	return ordered
+}
 
-	textContent := string(content)
-	if len(textContent) > maxAnalysisContentLen {
-		textContent = textContent[:maxAnalysisContentLen]
+// needsProcessing reports whether metadata, searchable text or renditions
+// can be derived from files of the MIME type.
+func needsProcessing(mimeType string) bool {
+	return isImage(mimeType) || strings.HasPrefix(mimeType, "audio/") || mimeType == "application/pdf" ||
+		metadata.IsText(mimeType)
+}
+
+// stripMetadata buffers an image and removes its EXIF and XMP metadata.
+func stripMetadata(reader io.Reader, size int64) ([]byte, error) {
+	if size > maxProcessingSize {
+		return nil, fmt.Errorf("strip metadata: %w", ErrTooLarge)
 	}
 
-	resume, err := s.analyzer.FileResume(ctx, textContent)
+	data, err := io.ReadAll(io.LimitReader(reader, maxProcessingSize+1))
 	if err != nil {
-		return nil, fmt.Errorf("analyze file: %w", err)
+		return nil, fmt.Errorf("read upload: %w", err)
+	}
+	if len(data) > maxProcessingSize {
+		return nil, fmt.Errorf("strip metadata: %w", ErrTooLarge)
 	}
 
-	updated, err := s.repo.UpdateResume(ctx, id, resume)
+	stripped, err := metadata.Strip(data)
 	if err != nil {
-		return nil, fmt.Errorf("save analysis result: %w", err)
+		return nil, fmt.Errorf("strip metadata: %w", err)
 	}
-
-	return updated, nil
+	return stripped, nil
 }
 
 func generateObjectKey(filename string) string {
@@ -0,0 +1,62 @@
+package files
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// eventStream writes server-sent events with JSON data. The response
+// headers are only sent with the first event, so a handler can still return
+// a regular HTTP error until then.
+type eventStream struct {
+	res     *echo.Response
+	started bool
+}
+
+func (s *eventStream) send(event string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("marshal %s event: %w", event, err)
+	}
+
+	if !s.started {
+		h := s.res.Header()
+		h.Set(echo.HeaderContentType, "text/event-stream")
+		h.Set(echo.HeaderCacheControl, "no-cache")
+		// Keep reverse proxies such as nginx from buffering the stream.
+		h.Set("X-Accel-Buffering", "no")
+		s.res.WriteHeader(http.StatusOK)
+		s.started = true
+	}
+
+	if _, err := fmt.Fprintf(s.res, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		return err
+	}
+	s.res.Flush()
+
+	return nil
+}
+
+// fail reports err as a regular HTTP error when no event has been sent yet,
+// and as an "error" event otherwise.
+func (s *eventStream) fail(err error) error {
+	if !s.started {
+		return httpError(err)
+	}
+
+	var he *echo.HTTPError
+	errors.As(httpError(err), &he)
+	return s.send("error", map[string]any{"message": he.Message})
+}
+
+// acceptsEventStream reports whether a request only accepts server-sent
+// events.
+func acceptsEventStream(c echo.Context) bool {
+	accept, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderAccept))
+	return accept == "text/event-stream"
+}
@@ -0,0 +1,178 @@
+package files
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/mamed-gasimov/file-service/internal/imaging"
+	"github.com/mamed-gasimov/file-service/internal/modules/jobs"
+)
+
+func isImage(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "image/")
+}
+
+// requestThumbnails queues a thumbnails job for the current version of an
+// image. Without background jobs, the thumbnails are rendered from content
+// right away.
+func (s *FileService) requestThumbnails(ctx context.Context, f *File, content []byte) {
+	if len(s.thumbnailSizes) == 0 || !isImage(f.MimeType) || f.Size > maxProcessingSize {
+		return
+	}
+
+	if s.jobs == nil {
+		if content != nil {
+			s.generateThumbnails(ctx, f, content)
+		}
+		return
+	}
+
+	_, err := s.jobs.Submit(ctx, jobs.TypeThumbnails, &f.ID, thumbnailJobParams{Version: f.Version},
+		jobs.UniqueKey(fmt.Sprintf("thumbnails:%d:%d", f.ID, f.Version)))
+	if err != nil {
+		log.Printf("queue thumbnails for file %d: %v", f.ID, err)
+	}
+}
+
+// generateThumbnails renders and stores a thumbnail of the image data for
+// every configured size. Failures are logged and never fail the upload.
+func (s *FileService) generateThumbnails(ctx context.Context, f *File, data []byte) {
+	img, _, err := imaging.Decode(data)
+	if err != nil {
+		log.Printf("decode file %d for thumbnails: %v", f.ID, err)
+		return
+	}
+
+	for _, size := range s.thumbnailSizes {
+		if err := s.saveThumbnail(ctx, f.ID, img, size); err != nil {
+			log.Printf("thumbnail %d for file %d: %v", size, f.ID, err)
+		}
+	}
+}
+
+// thumbnailJobParams are the parameters of a thumbnails job.
+type thumbnailJobParams struct {
+	Version int `json:"version"`
+}
+
+// RunThumbnailJob is the jobs.Handler of thumbnails jobs. It renders the
+// thumbnails of the version the job was queued for, unless the file has
+// changed since, and returns the sizes stored. Sizes that failed are
+// rendered again on the next attempt.
+func (s *FileService) RunThumbnailJob(ctx context.Context, job *jobs.Job, p thumbnailJobParams, progress func(percent int)) (json.RawMessage, error) {
+	if job.FileID == nil {
+		return nil, jobs.Permanent(fmt.Errorf("thumbnails job %d has no file", job.ID))
+	}
+
+	f, err := s.repo.GetByID(ctx, *job.FileID)
+	if errors.Is(err, ErrNotFound) {
+		return nil, jobs.Permanent(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if f.Version != p.Version {
+		return nil, nil
+	}
+
+	data, err := s.readObject(ctx, f.ObjectKey, maxProcessingSize)
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := imaging.Decode(data)
+	if err != nil {
+		return nil, jobs.Permanent(fmt.Errorf("decode file %d: %w", f.ID, err))
+	}
+
+	sizes := []int{}
+	var errs []error
+	for i, size := range s.thumbnailSizes {
+		if err := s.saveThumbnail(ctx, f.ID, img, size); err != nil {
+			errs = append(errs, fmt.Errorf("thumbnail %d: %w", size, err))
+		} else {
+			sizes = append(sizes, size)
+		}
+		progress(100 * (i + 1) / len(s.thumbnailSizes))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(map[string][]int{"sizes": sizes})
+}
+
+func (s *FileService) saveThumbnail(ctx context.Context, fileID int64, img image.Image, size int) error {
+	thumb := imaging.Fit(img, size)
+
+	var buf bytes.Buffer
+	mimeType, ext, err := imaging.Encode(&buf, thumb)
+	if err != nil {
+		return err
+	}
+
+	rd := &Rendition{
+		FileID:    fileID,
+		Kind:      RenditionThumbnail,
+		Size:      size,
+		Width:     thumb.Bounds().Dx(),
+		Height:    thumb.Bounds().Dy(),
+		MimeType:  mimeType,
+		ByteSize:  int64(buf.Len()),
+		ObjectKey: renditionObjectKey(fileID, fmt.Sprintf("%s_%d.%s", RenditionThumbnail, size, ext)),
+	}
+
+	return s.saveRendition(ctx, rd, &buf)
+}
+
+// GetThumbnail returns the smallest thumbnail that is at least size pixels,
+// falling back to the largest one available. A size of 0 selects the smallest.
+func (s *FileService) GetThumbnail(ctx context.Context, id int64, size int) (*Rendition, io.ReadCloser, error) {
+	if _, err := s.repo.GetByID(ctx, id); err != nil {
+		return nil, nil, fmt.Errorf("file not found: %w", err)
+	}
+
+	renditions, err := s.repo.ListRenditions(ctx, id, RenditionThumbnail)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list thumbnails: %w", err)
+	}
+	if len(renditions) == 0 {
+		return nil, nil, fmt.Errorf("thumbnail for file %d %w", id, ErrNotFound)
+	}
+
+	rd := &renditions[len(renditions)-1]
+	for i := range renditions {
+		if renditions[i].Size >= size {
+			rd = &renditions[i]
+			break
+		}
+	}
+
+	rc, err := s.storage.Download(ctx, rd.ObjectKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("download from storage: %w", err)
+	}
+
+	return rd, rc, nil
+}
+
+// readObject reads at most limit bytes of an object into memory.
+func (s *FileService) readObject(ctx context.Context, objectKey string, limit int64) ([]byte, error) {
+	rc, err := s.storage.Download(ctx, objectKey)
+	if err != nil {
+		return nil, fmt.Errorf("download from storage: %w", err)
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, limit))
+	if err != nil {
+		return nil, fmt.Errorf("read object: %w", err)
+	}
+	return data, nil
+}
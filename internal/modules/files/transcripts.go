@@ -0,0 +1,167 @@
+package files
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"path"
+	"strings"
+
+	"github.com/mamed-gasimov/file-service/internal/modules/analysis"
+	"github.com/mamed-gasimov/file-service/internal/modules/usage"
+)
+
+// maxTranscriptionSize is the largest recording the transcription endpoint
+// accepts; analyses of larger ones are refused up front.
+const maxTranscriptionSize = 25 << 20
+
+// maxTranscriptSize caps how much of a stored transcript is read back.
+const maxTranscriptSize = 10 << 20
+
+// isMedia reports whether files of the MIME type are audio or video
+// recordings, which are analyzed through their transcript.
+func isMedia(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "audio/") || strings.HasPrefix(mimeType, "video/")
+}
+
+// transcript returns the transcript of the current version of a recording.
+// A recording is transcribed once; the transcript is stored as a rendition
+// and reused by later analyses until the content changes.
+func (s *FileService) transcript(ctx context.Context, file *File) (*analysis.Transcript, error) {
+	if s.transcriber == nil {
+		return nil, fmt.Errorf("transcription is not configured: %w", ErrUnavailable)
+	}
+
+	if t, err := s.storedTranscript(ctx, file.ID); err != nil || t != nil {
+		return t, err
+	}
+
+	if err := s.checkBudget(ctx); err != nil {
+		return nil, err
+	}
+
+	rc, err := s.storage.Download(ctx, file.ObjectKey)
+	if err != nil {
+		return nil, fmt.Errorf("download from storage: %w", err)
+	}
+	defer rc.Close()
+
+	t, u, err := s.transcriber.Transcribe(ctx, rc, transcriptionFilename(file.Name, file.MimeType), file.MimeType)
+	s.recordUsage(ctx, usage.OperationTranscribe, file.ID, u)
+	if err != nil {
+		return nil, fmt.Errorf("transcribe file: %w", err)
+	}
+
+	// The transcript was paid for: keep it even if the client goes away now.
+	if err := s.saveTranscript(context.WithoutCancel(ctx), file, t); err != nil {
+		log.Printf("save transcript of file %d: %v", file.ID, err)
+	}
+
+	return t, nil
+}
+
+// storedTranscript returns the stored transcript of a file, or nil if it
+// has none.
+func (s *FileService) storedTranscript(ctx context.Context, fileID int64) (*analysis.Transcript, error) {
+	renditions, err := s.repo.ListRenditions(ctx, fileID, RenditionTranscript)
+	if err != nil {
+		return nil, fmt.Errorf("list renditions: %w", err)
+	}
+	if len(renditions) == 0 {
+		return nil, nil
+	}
+
+	data, err := s.readObject(ctx, renditions[0].ObjectKey, maxTranscriptSize)
+	if err != nil {
+		return nil, err
+	}
+
+	var t analysis.Transcript
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("decode transcript: %w", err)
+	}
+	return &t, nil
+}
+
+// saveTranscript stores t as the transcript rendition of file, unless the
+// file has got new content while it was transcribed.
+func (s *FileService) saveTranscript(ctx context.Context, file *File, t *analysis.Transcript) error {
+	current, err := s.repo.GetByID(ctx, file.ID)
+	if err != nil {
+		return err
+	}
+	if current.Version != file.Version {
+		return nil
+	}
+
+	data, err := json.Marshal(t)
+	if err != nil {
+		return fmt.Errorf("encode transcript: %w", err)
+	}
+
+	rd := &Rendition{
+		FileID:    file.ID,
+		Kind:      RenditionTranscript,
+		MimeType:  "application/json",
+		ByteSize:  int64(len(data)),
+		ObjectKey: renditionObjectKey(file.ID, RenditionTranscript+".json"),
+	}
+
+	return s.saveRendition(ctx, rd, bytes.NewReader(data))
+}
+
+// transcriptionFilename returns the name a recording is sent under. The
+// endpoint tells formats apart by extension, so names without one get the
+// extension of the MIME type.
+func transcriptionFilename(name, mimeType string) string {
+	if path.Ext(name) != "" {
+		return name
+	}
+	if exts, _ := mime.ExtensionsByType(mimeType); len(exts) > 0 {
+		return name + exts[0]
+	}
+	if _, sub, ok := strings.Cut(mimeType, "/"); ok {
+		return name + "." + strings.TrimPrefix(sub, "x-")
+	}
+	return name
+}
+
+// transcriptInput renders a transcript for the model, a line per segment
+// starting with its timestamp, such as "[01:02:03] ...".
+func transcriptInput(t *analysis.Transcript) string {
+	if len(t.Segments) == 0 {
+		return t.Text
+	}
+
+	var b strings.Builder
+	for _, seg := range t.Segments {
+		secs := int(seg.Start)
+		fmt.Fprintf(&b, "[%02d:%02d:%02d] %s\n", secs/3600, secs/60%60, secs%60, seg.Text)
+	}
+	return b.String()
+}
+
+// GetTranscript returns the stored transcript of the current version of a
+// live recording, made when it was first analyzed.
+func (s *FileService) GetTranscript(ctx context.Context, id int64) (*analysis.Transcript, error) {
+	f, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("file not found: %w", err)
+	}
+	if !isMedia(f.MimeType) {
+		return nil, fmt.Errorf("file %d is not an audio or video recording: %w", id, ErrInvalid)
+	}
+
+	t, err := s.storedTranscript(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, fmt.Errorf("transcript of file %d %w", id, ErrNotFound)
+	}
+
+	return t, nil
+}
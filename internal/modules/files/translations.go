@@ -0,0 +1,118 @@
+package files
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// maxTargetLanguages caps how many translations one upload can request.
+const maxTargetLanguages = 10
+
+// normalizeLanguage checks a BCP 47 language tag, such as "de", "pt-BR" or
+// "zh-Hant", and returns it in canonical case: the language lower-case, a
+// script title-case and a region upper-case.
+func normalizeLanguage(tag string) (string, error) {
+	parts := strings.FieldsFunc(strings.TrimSpace(tag), func(r rune) bool { return r == '-' || r == '_' })
+	if len(parts) == 0 || len(parts) > 4 || !isAlpha(parts[0]) || len(parts[0]) < 2 || len(parts[0]) > 3 {
+		return "", fmt.Errorf("language %q is not a BCP 47 tag such as de or pt-BR: %w", tag, ErrInvalid)
+	}
+
+	parts[0] = strings.ToLower(parts[0])
+	for i, p := range parts[1:] {
+		switch {
+		case len(p) == 4 && isAlpha(p):
+			p = strings.ToUpper(p[:1]) + strings.ToLower(p[1:])
+		case len(p) == 2 && isAlpha(p), len(p) == 3 && isDigits(p):
+			p = strings.ToUpper(p)
+		case len(p) >= 5 && len(p) <= 8 && isAlnum(p):
+			p = strings.ToLower(p)
+		default:
+			return "", fmt.Errorf("language %q is not a BCP 47 tag such as de or pt-BR: %w", tag, ErrInvalid)
+		}
+		parts[i+1] = p
+	}
+
+	return strings.Join(parts, "-"), nil
+}
+
+// NormalizeLanguages checks and normalizes BCP 47 language tags, dropping
+// duplicates.
+func NormalizeLanguages(tags []string) ([]string, error) {
+	out := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		lang, err := normalizeLanguage(tag)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(out, lang) {
+			out = append(out, lang)
+		}
+	}
+
+	if len(out) > maxTargetLanguages {
+		return nil, fmt.Errorf("more than %d target languages: %w", maxTargetLanguages, ErrInvalid)
+	}
+
+	return out, nil
+}
+
+func isAlpha(s string) bool {
+	return !strings.ContainsFunc(s, func(r rune) bool { return (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') })
+}
+
+func isDigits(s string) bool {
+	return !strings.ContainsFunc(s, func(r rune) bool { return r < '0' || r > '9' })
+}
+
+func isAlnum(s string) bool {
+	return !strings.ContainsFunc(s, func(r rune) bool {
+		return (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (r < '0' || r > '9')
+	})
+}
+
+// targetLanguages returns the languages to request translations in: the
+// languages of an upload, or else the configured default ones.
+func (s *FileService) targetLanguages(opts UploadOptions) ([]string, error) {
+	if len(opts.TargetLanguages) == 0 {
+		return s.translationLanguages, nil
+	}
+	return NormalizeLanguages(opts.TargetLanguages)
+}
+
+// ListTranslations returns the translations of the current version of a
+// live file, by language.
+func (s *FileService) ListTranslations(ctx context.Context, id int64) ([]Translation, error) {
+	f, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("file not found: %w", err)
+	}
+
+	translations, err := s.repo.ListTranslations(ctx, id, f.Version)
+	if err != nil {
+		return nil, fmt.Errorf("list translations: %w", err)
+	}
+
+	if translations == nil {
+		translations = []Translation{}
+	}
+
+	return translations, nil
+}
+
+// GetTranslation returns the translation of the current version of a live
+// file into a language.
+func (s *FileService) GetTranslation(ctx context.Context, id int64, language string) (*Translation, error) {
+	lang, err := normalizeLanguage(language)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("file not found: %w", err)
+	}
+
+	return s.repo.GetTranslation(ctx, id, f.Version, lang)
+}
@@ -0,0 +1,48 @@
+package files
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/mamed-gasimov/file-service/internal/modules/analysis"
+	"github.com/mamed-gasimov/file-service/internal/modules/usage"
+)
+
+// usageMeter is the part of the usage module AI calls are accounted with.
+type usageMeter interface {
+	Record(ctx context.Context, operation string, fileID *int64, u analysis.Usage)
+	CheckBudget(ctx context.Context) error
+}
+
+// recordUsage accounts a provider call about the file with id fileID, or
+// about no file when it is 0.
+func (s *FileService) recordUsage(ctx context.Context, operation string, fileID int64, u analysis.Usage) {
+	if s.usage == nil || u.Model == "" {
+		return
+	}
+
+	var id *int64
+	if fileID != 0 {
+		id = &fileID
+	}
+	s.usage.Record(ctx, operation, id, u)
+}
+
+// checkBudget returns ErrBudgetExceeded once the daily budget of AI calls
+// has been spent.
+func (s *FileService) checkBudget(ctx context.Context) error {
+	if s.usage == nil {
+		return nil
+	}
+
+	err := s.usage.CheckBudget(ctx)
+	if errors.Is(err, usage.ErrBudgetExceeded) {
+		return fmt.Errorf("%v: %w", err, ErrBudgetExceeded)
+	}
+	if err != nil {
+		return fmt.Errorf("check budget: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,184 @@
+package files
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/google/uuid"
+
+	"github.com/mamed-gasimov/file-service/internal/storage"
+)
+
+// UpdateContent stores new content for a live file as its next version. The
+// file keeps its ID and name; the previous content stays available as an
+// older version until the version limit prunes it.
+func (s *FileService) UpdateContent(ctx context.Context, id int64, reader io.Reader, size int64, contentType string, opts UploadOptions) (*File, error) {
+	file, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("file not found: %w", err)
+	}
+	languages, err := s.targetLanguages(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	v, content, err := s.storeContent(ctx, file.Name, reader, size, contentType, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := s.addVersion(ctx, id, v, content)
+	if err != nil {
+		return nil, err
+	}
+
+	s.requestAnalysis(ctx, f, languages)
+
+	return f, nil
+}
+
+// ListVersions returns the versions of a live file, newest first.
+func (s *FileService) ListVersions(ctx context.Context, id int64) ([]Version, error) {
+	if _, err := s.repo.GetByID(ctx, id); err != nil {
+		return nil, fmt.Errorf("file not found: %w", err)
+	}
+
+	versions, err := s.repo.ListVersions(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("list versions: %w", err)
+	}
+
+	if versions == nil {
+		versions = []Version{}
+	}
+
+	return versions, nil
+}
+
+// RestoreVersion makes the content of an older version current again by
+// copying it into a new version, so history stays linear. Analysis results
+// and translations of the restored version are carried over.
+func (s *FileService) RestoreVersion(ctx context.Context, id int64, version int) (*File, error) {
+	file, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("file not found: %w", err)
+	}
+
+	old, err := s.repo.GetVersion(ctx, id, version)
+	if err != nil {
+		return nil, fmt.Errorf("version not found: %w", err)
+	}
+	if old.Version == file.Version {
+		return file, nil
+	}
+
+	rc, err := s.storage.Download(ctx, old.ObjectKey)
+	if err != nil {
+		return nil, fmt.Errorf("download from storage: %w", err)
+	}
+	defer rc.Close()
+
+	v, content, err := s.storeContent(ctx, file.Name, rc, old.Size, old.MimeType, UploadOptions{})
+	if err != nil {
+		return nil, err
+	}
+	v.Resume = old.Resume
+	v.TranslationSummary = old.TranslationSummary
+
+	f, err := s.addVersion(ctx, id, v, content)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.CopyTranslations(ctx, id, old.Version, f.Version); err != nil {
+		log.Printf("copy translations of file %d version %d: %v", id, old.Version, err)
+	}
+	if f.TranslationSummary == nil {
+		s.requestAnalysis(ctx, f, s.translationLanguages)
+	}
+
+	return f, nil
+}
+
+// addVersion saves stored content as the file's next version, deletes the
+// objects of versions pruned by the version limit and rebuilds renditions,
+// personal data findings and embeddings for the new content.
+func (s *FileService) addVersion(ctx context.Context, id int64, v *Version, content []byte) (*File, error) {
+	f, pruned, err := s.repo.AddVersion(ctx, id, v, s.maxVersions)
+	if err != nil {
+		s.discardObject(ctx, v.ObjectKey)
+		return nil, fmt.Errorf("save version: %w", err)
+	}
+
+	for _, p := range pruned {
+		if err := s.storage.Delete(ctx, p.ObjectKey); err != nil {
+			log.Printf("delete pruned version %d of file %d: %v", p.Version, id, err)
+		}
+	}
+
+	if err := s.deleteRenditions(ctx, id); err != nil {
+		log.Printf("delete renditions of file %d: %v", id, err)
+	}
+	s.requestThumbnails(ctx, f, content)
+
+	var text string
+	if v.ExtractedText != nil {
+		text = *v.ExtractedText
+	}
+	s.requestPIIScan(ctx, f, text)
+	s.requestEmbeddings(ctx, f, text)
+
+	return f, nil
+}
+
+// deleteRenditions removes every rendition of a file, objects first.
+func (s *FileService) deleteRenditions(ctx context.Context, fileID int64) error {
+	renditions, err := s.repo.ListRenditions(ctx, fileID, "")
+	if err != nil {
+		return fmt.Errorf("list renditions: %w", err)
+	}
+
+	for _, rd := range renditions {
+		if err := s.storage.Delete(ctx, rd.ObjectKey); err != nil {
+			return fmt.Errorf("delete rendition from storage: %w", err)
+		}
+		if err := s.repo.DeleteRendition(ctx, rd.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// renditionObjectKey returns a new object key for a rendition of a file.
+// Every write gets its own key, so the object a rendition row points to is
+// never overwritten under a reader.
+func renditionObjectKey(fileID int64, name string) string {
+	return fmt.Sprintf("renditions/%d/%s_%s", fileID, uuid.NewString(), name)
+}
+
+// saveRendition uploads the content of rd from body and saves rd, then
+// deletes the object of the rendition it replaced. If rd cannot be saved,
+// its new object is removed and the old rendition stays as it was.
+func (s *FileService) saveRendition(ctx context.Context, rd *Rendition, body io.Reader) error {
+	info := &storage.ObjectInfo{}
+	if err := s.storage.Upload(storage.WithObjectInfo(ctx, info), rd.ObjectKey, body, rd.ByteSize, rd.MimeType); err != nil {
+		return fmt.Errorf("upload to storage: %w", err)
+	}
+	rd.StorageInfo = *info
+
+	replaced, err := s.repo.SaveRendition(ctx, rd)
+	if err != nil {
+		s.discardObject(ctx, rd.ObjectKey)
+		return err
+	}
+	if replaced != "" {
+		if err := s.storage.Delete(ctx, replaced); err != nil {
+			log.Printf("delete replaced rendition %q: %v", replaced, err)
+		}
+	}
+
+	return nil
+}
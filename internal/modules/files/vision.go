@@ -0,0 +1,41 @@
+package files
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/mamed-gasimov/file-service/internal/imaging"
+	"github.com/mamed-gasimov/file-service/internal/modules/analysis"
+)
+
+// defaultVisionMaxSize is the longest side in pixels images are scaled down
+// to before a vision analysis, unless WithImageAnalyzer sets another.
+const defaultVisionMaxSize = 1024
+
+// isVisionImage reports whether files of the MIME type are images the
+// vision model reads. Other images, such as SVG, are analyzed as text.
+func isVisionImage(mimeType string) bool {
+	switch mimeType {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+		return true
+	}
+	return false
+}
+
+// visionInput decodes an image and scales it down so that its longest side
+// is at most maxSize pixels: the model is billed by the tiles an image
+// covers, and larger images cost more without being understood better.
+func visionInput(content []byte, maxSize int) (*analysis.Image, error) {
+	img, _, err := imaging.Decode(content)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", err, ErrInvalid)
+	}
+
+	var buf bytes.Buffer
+	mimeType, _, err := imaging.Encode(&buf, imaging.Fit(img, maxSize))
+	if err != nil {
+		return nil, err
+	}
+
+	return &analysis.Image{MimeType: mimeType, Data: buf.Bytes()}, nil
+}
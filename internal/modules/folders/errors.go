@@ -0,0 +1,13 @@
+package folders
+
+import "errors"
+
+// ErrNotFound is returned when a folder does not exist.
+var ErrNotFound = errors.New("not found")
+
+// ErrConflict is returned when a folder with the same path already exists.
+var ErrConflict = errors.New("already exists")
+
+// ErrInvalid is returned for invalid folder names and for moves of a folder
+// into its own subtree.
+var ErrInvalid = errors.New("invalid")
@@ -0,0 +1,180 @@
+package folders
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/mamed-gasimov/file-service/internal/modules/files"
+)
+
+// maxPageSize caps the limit query parameter of folder listings.
+const maxPageSize = 1000
+
+type FolderHandler struct {
+	svc service
+}
+
+func NewFolderHandler(svc service) *FolderHandler {
+	return &FolderHandler{svc: svc}
+}
+
+func (h *FolderHandler) CreateFolder(c echo.Context) error {
+	var req CreateRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+
+	f, err := h.svc.CreateFolder(c.Request().Context(), req)
+	if err != nil {
+		return httpError(err)
+	}
+
+	return c.JSON(http.StatusCreated, f)
+}
+
+// FindFolder looks a folder up by the path query parameter.
+func (h *FolderHandler) FindFolder(c echo.Context) error {
+	path := c.QueryParam("path")
+	if path == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "query parameter 'path' is required")
+	}
+
+	f, err := h.svc.FindFolder(c.Request().Context(), path)
+	if err != nil {
+		return httpError(err)
+	}
+
+	return c.JSON(http.StatusOK, f)
+}
+
+func (h *FolderHandler) GetFolder(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid folder id")
+	}
+
+	f, err := h.svc.GetFolder(c.Request().Context(), id)
+	if err != nil {
+		return httpError(err)
+	}
+
+	return c.JSON(http.StatusOK, f)
+}
+
+func (h *FolderHandler) ListContents(c echo.Context) error {
+	id, err := folderParam(c)
+	if err != nil {
+		return err
+	}
+
+	limit, offset, err := parsePage(c)
+	if err != nil {
+		return err
+	}
+
+	contents, err := h.svc.ListContents(c.Request().Context(), id, limit, offset)
+	if err != nil {
+		return httpError(err)
+	}
+
+	return c.JSON(http.StatusOK, contents)
+}
+
+func (h *FolderHandler) UpdateFolder(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid folder id")
+	}
+
+	var req UpdateRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+
+	f, err := h.svc.UpdateFolder(c.Request().Context(), id, req)
+	if err != nil {
+		return httpError(err)
+	}
+
+	return c.JSON(http.StatusOK, f)
+}
+
+func (h *FolderHandler) DeleteFolder(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid folder id")
+	}
+
+	if err := h.svc.DeleteFolder(c.Request().Context(), id); err != nil {
+		return httpError(err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *FolderHandler) MoveFile(c echo.Context) error {
+	id, err := folderParam(c)
+	if err != nil {
+		return err
+	}
+
+	var req MoveFileRequest
+	if err := c.Bind(&req); err != nil || req.FileID <= 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "field 'file_id' is required")
+	}
+
+	f, err := h.svc.MoveFile(c.Request().Context(), id, req)
+	if err != nil {
+		return httpError(err)
+	}
+
+	return c.JSON(http.StatusOK, f)
+}
+
+// folderParam parses the :id path parameter, accepting "root" for the root
+// folder, which is reported as 0.
+func folderParam(c echo.Context) (int64, error) {
+	if c.Param("id") == "root" {
+		return 0, nil
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id < 0 {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, "invalid folder id")
+	}
+	return id, nil
+}
+
+// parsePage reads the limit and offset query parameters.
+func parsePage(c echo.Context) (limit, offset int, err error) {
+	if v := c.QueryParam("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return 0, 0, echo.NewHTTPError(http.StatusBadRequest, "invalid limit")
+		}
+	}
+	if v := c.QueryParam("offset"); v != "" {
+		offset, err = strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return 0, 0, echo.NewHTTPError(http.StatusBadRequest, "invalid offset")
+		}
+	}
+	return limit, offset, nil
+}
+
+// httpError maps folder and file errors to HTTP errors.
+func httpError(err error) error {
+	switch {
+	case errors.Is(err, ErrNotFound), errors.Is(err, files.ErrNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrConflict):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	case errors.Is(err, ErrInvalid):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+}
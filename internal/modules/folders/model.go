@@ -0,0 +1,51 @@
+package folders
+
+import (
+	"time"
+
+	"github.com/mamed-gasimov/file-service/internal/modules/files"
+)
+
+// Folder groups files. Path is the materialized path of folder names from
+// the root, such as "/reports/2026".
+type Folder struct {
+	ID        int64     `json:"id"`
+	ParentID  *int64    `json:"parent_id"`
+	Name      string    `json:"name"`
+	Path      string    `json:"path"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Contents is one page of a folder listing. Subfolders come first, ordered
+// by name, followed by files, newest first; Limit and Offset apply to that
+// combined sequence and Total counts all of it.
+type Contents struct {
+	// Folder is the listed folder, nil for the root.
+	Folder  *Folder      `json:"folder"`
+	Folders []Folder     `json:"folders"`
+	Files   []files.File `json:"files"`
+	Total   int          `json:"total"`
+	Limit   int          `json:"limit"`
+	Offset  int          `json:"offset"`
+}
+
+// CreateRequest is the body of a folder creation. A nil ParentID creates a
+// top-level folder.
+type CreateRequest struct {
+	Name     string `json:"name"`
+	ParentID *int64 `json:"parent_id"`
+}
+
+// UpdateRequest renames and/or moves a folder. Nil fields are left
+// unchanged; a ParentID of 0 moves the folder to the root.
+type UpdateRequest struct {
+	Name     *string `json:"name"`
+	ParentID *int64  `json:"parent_id"`
+}
+
+// MoveFileRequest moves a file into a folder, renaming it when Name is set.
+type MoveFileRequest struct {
+	FileID int64  `json:"file_id"`
+	Name   string `json:"name"`
+}
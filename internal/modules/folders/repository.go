@@ -0,0 +1,242 @@
+package folders
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type repository interface {
+	Create(ctx context.Context, f *Folder) error
+	GetByID(ctx context.Context, id int64) (*Folder, error)
+	GetByPath(ctx context.Context, path string) (*Folder, error)
+	ListChildren(ctx context.Context, parentID *int64, limit, offset int) ([]Folder, error)
+	CountChildren(ctx context.Context, parentID *int64) (int, error)
+	SubtreeIDs(ctx context.Context, id int64) ([]int64, error)
+	Update(ctx context.Context, id int64, name string, parentID *int64) (*Folder, error)
+	Delete(ctx context.Context, id int64) error
+}
+
+var _ repository = (*FolderRepository)(nil)
+
+// PostgreSQL SQLSTATEs mapped to folder errors.
+const (
+	uniqueViolation = "23505"
+	checkViolation  = "23514"
+)
+
+const folderColumns = `id, parent_id, name, path, created_at, updated_at`
+
+func scanFolder(row pgx.Row, f *Folder) error {
+	return row.Scan(&f.ID, &f.ParentID, &f.Name, &f.Path, &f.CreatedAt, &f.UpdatedAt)
+}
+
+type FolderRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewFolderRepository(pool *pgxpool.Pool) *FolderRepository {
+	return &FolderRepository{pool: pool}
+}
+
+// Create inserts a folder under f.ParentID (nil for the root), deriving its
+// path from the parent's.
+func (r *FolderRepository) Create(ctx context.Context, f *Folder) error {
+	query := `INSERT INTO folders (parent_id, name, path)
+	           SELECT $1, $2, COALESCE((SELECT path FROM folders WHERE id = $1), '') || '/' || $2
+	           WHERE $1::bigint IS NULL OR EXISTS (SELECT 1 FROM folders WHERE id = $1)
+	           RETURNING ` + folderColumns
+
+	err := scanFolder(r.pool.QueryRow(ctx, query, f.ParentID, f.Name), f)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("parent folder %d %w", *f.ParentID, ErrNotFound)
+	}
+	if err != nil {
+		return folderError("create folder", f.Name, err)
+	}
+
+	return nil
+}
+
+func (r *FolderRepository) GetByID(ctx context.Context, id int64) (*Folder, error) {
+	query := `SELECT ` + folderColumns + ` FROM folders WHERE id = $1`
+
+	var f Folder
+	err := scanFolder(r.pool.QueryRow(ctx, query, id), &f)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("folder with id %d %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get folder by id: %w", err)
+	}
+
+	return &f, nil
+}
+
+func (r *FolderRepository) GetByPath(ctx context.Context, path string) (*Folder, error) {
+	query := `SELECT ` + folderColumns + ` FROM folders WHERE path = $1`
+
+	var f Folder
+	err := scanFolder(r.pool.QueryRow(ctx, query, path), &f)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("folder %q %w", path, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get folder by path: %w", err)
+	}
+
+	return &f, nil
+}
+
+// ListChildren returns the subfolders of parentID (nil for the root) ordered
+// by name. A limit of 0 means no limit.
+func (r *FolderRepository) ListChildren(ctx context.Context, parentID *int64, limit, offset int) ([]Folder, error) {
+	query := `SELECT ` + folderColumns + `
+	           FROM folders WHERE parent_id IS NOT DISTINCT FROM $1
+	           ORDER BY name
+	           LIMIT NULLIF($2, 0) OFFSET $3`
+
+	rows, err := r.pool.Query(ctx, query, parentID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("query folders: %w", err)
+	}
+	defer rows.Close()
+
+	var folders []Folder
+	for rows.Next() {
+		var f Folder
+		if err := scanFolder(rows, &f); err != nil {
+			return nil, fmt.Errorf("scan folder: %w", err)
+		}
+		folders = append(folders, f)
+	}
+
+	return folders, rows.Err()
+}
+
+func (r *FolderRepository) CountChildren(ctx context.Context, parentID *int64) (int, error) {
+	query := `SELECT count(*) FROM folders WHERE parent_id IS NOT DISTINCT FROM $1`
+
+	var n int
+	if err := r.pool.QueryRow(ctx, query, parentID).Scan(&n); err != nil {
+		return 0, fmt.Errorf("count folders: %w", err)
+	}
+
+	return n, nil
+}
+
+// SubtreeIDs returns the IDs of a folder and all of its descendants.
+func (r *FolderRepository) SubtreeIDs(ctx context.Context, id int64) ([]int64, error) {
+	query := `SELECT d.id FROM folders root
+	           JOIN folders d ON d.id = root.id OR left(d.path, length(root.path) + 1) = root.path || '/'
+	           WHERE root.id = $1`
+
+	rows, err := r.pool.Query(ctx, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("query subtree: %w", err)
+	}
+
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		return nil, fmt.Errorf("scan subtree: %w", err)
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("folder with id %d %w", id, ErrNotFound)
+	}
+
+	return ids, nil
+}
+
+// Update renames a folder and moves it under parentID (nil for the root),
+// rewriting the paths of all its descendants in the same transaction.
+func (r *FolderRepository) Update(ctx context.Context, id int64, name string, parentID *int64) (*Folder, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var oldPath string
+	err = tx.QueryRow(ctx, `SELECT path FROM folders WHERE id = $1 FOR UPDATE`, id).Scan(&oldPath)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("folder with id %d %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lock folder: %w", err)
+	}
+
+	parentPath := ""
+	if parentID != nil {
+		err = tx.QueryRow(ctx, `SELECT path FROM folders WHERE id = $1 FOR SHARE`, *parentID).Scan(&parentPath)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("parent folder %d %w", *parentID, ErrNotFound)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("lock parent folder: %w", err)
+		}
+		if parentPath == oldPath || isUnder(parentPath, oldPath) {
+			return nil, fmt.Errorf("move folder %q into its own subtree: %w", oldPath, ErrInvalid)
+		}
+	}
+	newPath := parentPath + "/" + name
+
+	var f Folder
+	err = scanFolder(tx.QueryRow(ctx, `UPDATE folders SET name = $2, parent_id = $3, path = $4, updated_at = NOW()
+	           WHERE id = $1
+	           RETURNING `+folderColumns, id, name, parentID, newPath), &f)
+	if err != nil {
+		return nil, folderError("update folder", newPath, err)
+	}
+
+	if newPath != oldPath {
+		_, err = tx.Exec(ctx, `UPDATE folders SET path = $2 || substr(path, length($1) + 1), updated_at = NOW()
+		           WHERE left(path, length($1) + 1) = $1 || '/'`, oldPath, newPath)
+		if err != nil {
+			return nil, folderError("move subfolders", newPath, err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit tx: %w", err)
+	}
+
+	return &f, nil
+}
+
+// Delete removes a folder; its subfolders are removed by cascade and the
+// files they held lose their folder.
+func (r *FolderRepository) Delete(ctx context.Context, id int64) error {
+	ct, err := r.pool.Exec(ctx, `DELETE FROM folders WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("delete folder: %w", err)
+	}
+
+	if ct.RowsAffected() == 0 {
+		return fmt.Errorf("folder with id %d %w", id, ErrNotFound)
+	}
+
+	return nil
+}
+
+// isUnder reports whether path lies inside the folder at ancestor.
+func isUnder(path, ancestor string) bool {
+	return len(path) > len(ancestor) && path[:len(ancestor)+1] == ancestor+"/"
+}
+
+// folderError maps constraint violations on folders to ErrConflict and ErrInvalid.
+func folderError(op, path string, err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case uniqueViolation:
+			return fmt.Errorf("folder %q %w", path, ErrConflict)
+		case checkViolation:
+			return fmt.Errorf("folder name %q: %w", path, ErrInvalid)
+		}
+	}
+	return fmt.Errorf("%s: %w", op, err)
+}
@@ -0,0 +1,191 @@
+package folders
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mamed-gasimov/file-service/internal/modules/files"
+)
+
+const (
+	defaultPageSize = 50
+	maxNameLen      = 255
+)
+
+type service interface {
+	CreateFolder(ctx context.Context, req CreateRequest) (*Folder, error)
+	GetFolder(ctx context.Context, id int64) (*Folder, error)
+	FindFolder(ctx context.Context, path string) (*Folder, error)
+	ListContents(ctx context.Context, id int64, limit, offset int) (*Contents, error)
+	UpdateFolder(ctx context.Context, id int64, req UpdateRequest) (*Folder, error)
+	DeleteFolder(ctx context.Context, id int64) error
+	MoveFile(ctx context.Context, folderID int64, req MoveFileRequest) (*files.File, error)
+}
+
+var _ service = (*FolderService)(nil)
+
+// fileService is the part of the files module folders rely on.
+type fileService interface {
+	ListFiles(ctx context.Context, filter files.ListFilter) ([]files.File, error)
+	CountFiles(ctx context.Context, filter files.ListFilter) (int, error)
+	MoveFile(ctx context.Context, id int64, folderID *int64, name string) (*files.File, error)
+	TrashFolders(ctx context.Context, folderIDs []int64) (int, error)
+}
+
+type FolderService struct {
+	repo  repository
+	files fileService
+}
+
+func NewFolderService(repo repository, files fileService) *FolderService {
+	return &FolderService{repo: repo, files: files}
+}
+
+func (s *FolderService) CreateFolder(ctx context.Context, req CreateRequest) (*Folder, error) {
+	name, err := cleanName(req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Folder{Name: name, ParentID: rootAsNil(req.ParentID)}
+	if err := s.repo.Create(ctx, f); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (s *FolderService) GetFolder(ctx context.Context, id int64) (*Folder, error) {
+	return s.repo.GetByID(ctx, id)
+}
+
+// FindFolder looks a folder up by its path, such as "/reports/2026".
+func (s *FolderService) FindFolder(ctx context.Context, path string) (*Folder, error) {
+	path = "/" + strings.Trim(path, "/")
+	return s.repo.GetByPath(ctx, path)
+}
+
+// ListContents returns one page of the subfolders and files of a folder, 0
+// being the root. Subfolders are listed before files.
+func (s *FolderService) ListContents(ctx context.Context, id int64, limit, offset int) (*Contents, error) {
+	if limit == 0 {
+		limit = defaultPageSize
+	}
+
+	c := &Contents{Folders: []Folder{}, Files: []files.File{}, Limit: limit, Offset: offset}
+
+	var parentID *int64
+	if id != 0 {
+		folder, err := s.repo.GetByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		c.Folder, parentID = folder, &folder.ID
+	}
+
+	folderCount, err := s.repo.CountChildren(ctx, parentID)
+	if err != nil {
+		return nil, err
+	}
+	fileFilter := files.ListFilter{FolderID: &id}
+	fileCount, err := s.files.CountFiles(ctx, fileFilter)
+	if err != nil {
+		return nil, err
+	}
+	c.Total = folderCount + fileCount
+
+	if offset < folderCount {
+		folders, err := s.repo.ListChildren(ctx, parentID, limit, offset)
+		if err != nil {
+			return nil, err
+		}
+		if folders != nil {
+			c.Folders = folders
+		}
+	}
+
+	if remaining := limit - len(c.Folders); remaining > 0 && fileCount > 0 {
+		fileFilter.Limit = remaining
+		fileFilter.Offset = max(0, offset-folderCount)
+		c.Files, err = s.files.ListFiles(ctx, fileFilter)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// UpdateFolder renames and/or moves a folder together with its subtree.
+func (s *FolderService) UpdateFolder(ctx context.Context, id int64, req UpdateRequest) (*Folder, error) {
+	folder, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	name := folder.Name
+	if req.Name != nil {
+		if name, err = cleanName(*req.Name); err != nil {
+			return nil, err
+		}
+	}
+
+	parentID := folder.ParentID
+	if req.ParentID != nil {
+		parentID = rootAsNil(req.ParentID)
+	}
+
+	return s.repo.Update(ctx, id, name, parentID)
+}
+
+// DeleteFolder deletes a folder and its subfolders. The files they hold are
+// moved to the trash first, so they can still be restored (into the root).
+func (s *FolderService) DeleteFolder(ctx context.Context, id int64) error {
+	ids, err := s.repo.SubtreeIDs(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.files.TrashFolders(ctx, ids); err != nil {
+		return err
+	}
+
+	return s.repo.Delete(ctx, id)
+}
+
+// MoveFile moves a file into a folder, 0 being the root.
+func (s *FolderService) MoveFile(ctx context.Context, folderID int64, req MoveFileRequest) (*files.File, error) {
+	name := ""
+	if req.Name != "" {
+		var err error
+		if name, err = cleanName(req.Name); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.files.MoveFile(ctx, req.FileID, rootAsNil(&folderID), name)
+}
+
+// cleanName trims a folder or file name and rejects names that cannot be a
+// path segment.
+func cleanName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	switch {
+	case name == "", name == ".", name == "..":
+		return "", fmt.Errorf("name %q: %w", name, ErrInvalid)
+	case strings.Contains(name, "/"):
+		return "", fmt.Errorf("name %q must not contain '/': %w", name, ErrInvalid)
+	case len(name) > maxNameLen:
+		return "", fmt.Errorf("name longer than %d bytes: %w", maxNameLen, ErrInvalid)
+	}
+	return name, nil
+}
+
+// rootAsNil maps the API's folder ID 0 (the root) to a nil parent.
+func rootAsNil(id *int64) *int64 {
+	if id == nil || *id == 0 {
+		return nil
+	}
+	return id
+}
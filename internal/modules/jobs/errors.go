@@ -0,0 +1,35 @@
+package jobs
+
+import "errors"
+
+// ErrNotFound is returned when a job does not exist.
+var ErrNotFound = errors.New("not found")
+
+// ErrConflict is returned when canceling a job that has already finished.
+var ErrConflict = errors.New("already finished")
+
+// ErrUnknownType is returned when a job is submitted for a type without a
+// registered definition.
+var ErrUnknownType = errors.New("unknown job type")
+
+// permanentError marks a handler error that retrying cannot fix.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as permanent, so the job fails right away instead of
+// being retried.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+func isPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
@@ -0,0 +1,59 @@
+package jobs
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+type JobHandler struct {
+	svc service
+}
+
+func NewJobHandler(svc service) *JobHandler {
+	return &JobHandler{svc: svc}
+}
+
+// GetJob reports the status, progress and outcome of a job.
+func (h *JobHandler) GetJob(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid job id")
+	}
+
+	j, err := h.svc.GetJob(c.Request().Context(), id)
+	if err != nil {
+		return httpError(err)
+	}
+
+	return c.JSON(http.StatusOK, j)
+}
+
+// CancelJob cancels a queued or running job and returns it.
+func (h *JobHandler) CancelJob(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid job id")
+	}
+
+	j, err := h.svc.CancelJob(c.Request().Context(), id)
+	if err != nil {
+		return httpError(err)
+	}
+
+	return c.JSON(http.StatusOK, j)
+}
+
+// httpError maps job errors to HTTP errors.
+func httpError(err error) error {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrConflict):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,113 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Job types.
+const (
+	TypeAnalyze      = "analyze"
+	TypeAnalyzeBatch = "analyze_batch"
+	TypeThumbnails   = "thumbnails"
+	TypeDetectPII    = "detect_pii"
+	TypeEmbed        = "embed"
+	TypeReap         = "reap"
+	TypeReconcile    = "reconcile"
+)
+
+// Queues. Each queue has its own workers, so slow jobs on one cannot hold
+// up the others.
+const (
+	QueueDefault     = "default"
+	QueueAnalysis    = "analysis"
+	QueueMaintenance = "maintenance"
+	QueueBatch       = "batch"
+)
+
+// Job statuses. Queued and running jobs are active; the others are final.
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusCanceled  = "canceled"
+)
+
+// Job is a unit of background work, such as an analysis of a file. Params
+// are the parameters of its type, Progress a percentage, and Result or
+// Error its outcome once it has succeeded or failed. A queued job runs on
+// its queue once RunAt has passed; Error then holds why the last attempt
+// failed, if any. At most one active job exists per UniqueKey.
+type Job struct {
+	ID          int64           `json:"id"`
+	Type        string          `json:"type"`
+	Queue       string          `json:"queue"`
+	Status      string          `json:"status"`
+	FileID      *int64          `json:"file_id"`
+	Tenant      *string         `json:"tenant"`
+	Params      json.RawMessage `json:"params"`
+	UniqueKey   *string         `json:"unique_key"`
+	Progress    int             `json:"progress"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	Result      json.RawMessage `json:"result"`
+	Error       *string         `json:"error"`
+	RunAt       time.Time       `json:"run_at"`
+	CreatedAt   time.Time       `json:"created_at"`
+	StartedAt   *time.Time      `json:"started_at"`
+	FinishedAt  *time.Time      `json:"finished_at"`
+}
+
+// Handler runs a job of one type and returns its result. It reports its
+// progress as a percentage and must return when ctx is canceled. Errors
+// are retried unless they are marked with Permanent.
+type Handler func(ctx context.Context, job *Job, progress func(percent int)) (json.RawMessage, error)
+
+// Typed adapts a handler that takes the decoded params of its job. Params
+// that do not decode into P fail the job without a retry.
+func Typed[P any](fn func(ctx context.Context, job *Job, params P, progress func(percent int)) (json.RawMessage, error)) Handler {
+	return func(ctx context.Context, job *Job, progress func(percent int)) (json.RawMessage, error) {
+		var params P
+		if len(job.Params) > 0 {
+			if err := json.Unmarshal(job.Params, &params); err != nil {
+				return nil, Permanent(fmt.Errorf("decode %s job params: %w", job.Type, err))
+			}
+		}
+		return fn(ctx, job, params, progress)
+	}
+}
+
+// Definition describes how jobs of one type run: on which queue, how often
+// a failed job is attempted and how long to wait before the next attempt,
+// which doubles after every failure. A definition with Every set is
+// periodic: one job of its type is always scheduled, Every after the
+// previous one finished.
+type Definition struct {
+	Type        string
+	Queue       string        // QueueDefault when empty
+	MaxAttempts int           // 3 when 0
+	Backoff     time.Duration // 10s when 0
+	Every       time.Duration
+	Handler     Handler
+}
+
+// SubmitOption sets optional fields of a submitted job.
+type SubmitOption func(*Job)
+
+// RunAt schedules a job to run no earlier than t.
+func RunAt(t time.Time) SubmitOption {
+	return func(j *Job) {
+		j.RunAt = t
+	}
+}
+
+// UniqueKey makes Submit return the active job with key, if there is one,
+// instead of creating another.
+func UniqueKey(key string) SubmitOption {
+	return func(j *Job) {
+		j.UniqueKey = &key
+	}
+}
@@ -0,0 +1,248 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type repository interface {
+	Create(ctx context.Context, j *Job) (bool, error)
+	Get(ctx context.Context, id int64) (*Job, error)
+	GetActiveByKey(ctx context.Context, key string) (*Job, error)
+	Claim(ctx context.Context, queue, worker string, lease time.Duration) (*Job, error)
+	Heartbeat(ctx context.Context, id int64, worker string, lease time.Duration) (bool, error)
+	SetProgress(ctx context.Context, id int64, worker string, progress int) error
+	Finish(ctx context.Context, id int64, worker, status string, result json.RawMessage, errMsg *string) error
+	Retry(ctx context.Context, id int64, worker string, runAt time.Time, errMsg string) error
+	Release(ctx context.Context, id int64, worker string) error
+	Cancel(ctx context.Context, id int64) (bool, error)
+	FailExpired(ctx context.Context) (int64, error)
+	Prune(ctx context.Context, before time.Time) (int64, error)
+}
+
+var _ repository = (*JobRepository)(nil)
+
+const jobColumns = `id, type, queue, status, file_id, tenant, params, unique_key, progress, attempts, max_attempts,
+	result, error, run_at, created_at, started_at, finished_at`
+
+func scanJob(row pgx.Row, j *Job) error {
+	return row.Scan(&j.ID, &j.Type, &j.Queue, &j.Status, &j.FileID, &j.Tenant, &j.Params, &j.UniqueKey,
+		&j.Progress, &j.Attempts, &j.MaxAttempts, &j.Result, &j.Error,
+		&j.RunAt, &j.CreatedAt, &j.StartedAt, &j.FinishedAt)
+}
+
+type JobRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewJobRepository(pool *pgxpool.Pool) *JobRepository {
+	return &JobRepository{pool: pool}
+}
+
+// Create inserts a queued job, running now unless RunAt is set. It reports
+// false, leaving j as it was, when an active job with the same unique key
+// already exists.
+func (r *JobRepository) Create(ctx context.Context, j *Job) (bool, error) {
+	query := `INSERT INTO jobs (type, queue, file_id, tenant, params, unique_key, max_attempts, run_at)
+	           VALUES ($1, $2, $3, $4, $5, $6, $7, COALESCE($8, now()))
+	           ON CONFLICT (unique_key) WHERE status IN ('queued', 'running') DO NOTHING
+	           RETURNING ` + jobColumns
+
+	var runAt *time.Time
+	if !j.RunAt.IsZero() {
+		runAt = &j.RunAt
+	}
+
+	err := scanJob(r.pool.QueryRow(ctx, query,
+		j.Type, j.Queue, j.FileID, j.Tenant, j.Params, j.UniqueKey, j.MaxAttempts, runAt), j)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("insert job: %w", err)
+	}
+
+	return true, nil
+}
+
+func (r *JobRepository) Get(ctx context.Context, id int64) (*Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE id = $1`
+
+	var j Job
+	err := scanJob(r.pool.QueryRow(ctx, query, id), &j)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("job with id %d %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get job: %w", err)
+	}
+
+	return &j, nil
+}
+
+// GetActiveByKey returns the queued or running job with a unique key.
+func (r *JobRepository) GetActiveByKey(ctx context.Context, key string) (*Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs
+	           WHERE unique_key = $1 AND status IN ('queued', 'running')`
+
+	var j Job
+	err := scanJob(r.pool.QueryRow(ctx, query, key), &j)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("active job with key %q %w", key, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get job by key: %w", err)
+	}
+
+	return &j, nil
+}
+
+// Claim locks the next due job of a queue for worker until the lease runs
+// out and counts the attempt. Running jobs whose lease has expired, because
+// the worker holding them died, are claimed again while they have attempts
+// left. Rows locked by other workers are skipped, so any number of workers
+// and replicas can claim concurrently. It returns nil when no job is due.
+func (r *JobRepository) Claim(ctx context.Context, queue, worker string, lease time.Duration) (*Job, error) {
+	query := `UPDATE jobs
+	           SET status = 'running', attempts = attempts + 1, locked_by = $2,
+	               locked_until = now() + make_interval(secs => $3),
+	               started_at = COALESCE(started_at, now())
+	           WHERE id = (
+	               SELECT id FROM jobs
+	               WHERE queue = $1 AND (
+	                   (status = 'queued' AND run_at <= now())
+	                   OR (status = 'running' AND locked_until < now() AND attempts < max_attempts))
+	               ORDER BY run_at, id
+	               FOR UPDATE SKIP LOCKED
+	               LIMIT 1)
+	           RETURNING ` + jobColumns
+
+	var j Job
+	err := scanJob(r.pool.QueryRow(ctx, query, queue, worker, lease.Seconds()), &j)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("claim job: %w", err)
+	}
+
+	return &j, nil
+}
+
+// Heartbeat extends the lease worker holds on a running job. It reports
+// false when the worker lost the job, because it was canceled or claimed
+// by another worker after the lease expired.
+func (r *JobRepository) Heartbeat(ctx context.Context, id int64, worker string, lease time.Duration) (bool, error) {
+	query := `UPDATE jobs SET locked_until = now() + make_interval(secs => $3)
+	           WHERE id = $1 AND locked_by = $2 AND status = 'running'`
+
+	tag, err := r.pool.Exec(ctx, query, id, worker, lease.Seconds())
+	if err != nil {
+		return false, fmt.Errorf("extend job lease: %w", err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+func (r *JobRepository) SetProgress(ctx context.Context, id int64, worker string, progress int) error {
+	query := `UPDATE jobs SET progress = $3 WHERE id = $1 AND locked_by = $2 AND status = 'running'`
+
+	if _, err := r.pool.Exec(ctx, query, id, worker, progress); err != nil {
+		return fmt.Errorf("set job progress: %w", err)
+	}
+
+	return nil
+}
+
+// Finish records the final outcome of a job worker is running. A job
+// canceled while it ran keeps its canceled status.
+func (r *JobRepository) Finish(ctx context.Context, id int64, worker, status string, result json.RawMessage, errMsg *string) error {
+	query := `UPDATE jobs
+	           SET status = $3, result = $4, error = $5, finished_at = now(),
+	               progress = CASE WHEN $3 = 'succeeded' THEN 100 ELSE progress END,
+	               locked_by = NULL, locked_until = NULL
+	           WHERE id = $1 AND locked_by = $2 AND status = 'running'`
+
+	if _, err := r.pool.Exec(ctx, query, id, worker, status, result, errMsg); err != nil {
+		return fmt.Errorf("finish job: %w", err)
+	}
+
+	return nil
+}
+
+// Retry queues a failed job worker was running for another attempt at
+// runAt.
+func (r *JobRepository) Retry(ctx context.Context, id int64, worker string, runAt time.Time, errMsg string) error {
+	query := `UPDATE jobs
+	           SET status = 'queued', run_at = $3, error = $4, progress = 0,
+	               locked_by = NULL, locked_until = NULL
+	           WHERE id = $1 AND locked_by = $2 AND status = 'running'`
+
+	if _, err := r.pool.Exec(ctx, query, id, worker, runAt, errMsg); err != nil {
+		return fmt.Errorf("retry job: %w", err)
+	}
+
+	return nil
+}
+
+// Release queues a job worker was interrupted in again without counting
+// the attempt, so that another worker picks it up.
+func (r *JobRepository) Release(ctx context.Context, id int64, worker string) error {
+	query := `UPDATE jobs
+	           SET status = 'queued', attempts = attempts - 1, progress = 0,
+	               locked_by = NULL, locked_until = NULL
+	           WHERE id = $1 AND locked_by = $2 AND status = 'running'`
+
+	if _, err := r.pool.Exec(ctx, query, id, worker); err != nil {
+		return fmt.Errorf("release job: %w", err)
+	}
+
+	return nil
+}
+
+// Cancel cancels a job that is queued or running, reporting whether
+// it was still active.
+func (r *JobRepository) Cancel(ctx context.Context, id int64) (bool, error) {
+	query := `UPDATE jobs SET status = 'canceled', finished_at = now(), locked_by = NULL, locked_until = NULL
+	           WHERE id = $1 AND status IN ('queued', 'running')`
+
+	tag, err := r.pool.Exec(ctx, query, id)
+	if err != nil {
+		return false, fmt.Errorf("cancel job: %w", err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// FailExpired fails the running jobs whose lease expired after their last
+// attempt, returning how many there were.
+func (r *JobRepository) FailExpired(ctx context.Context) (int64, error) {
+	query := `UPDATE jobs
+	           SET status = 'failed', error = 'worker stopped responding', finished_at = now(),
+	               locked_by = NULL, locked_until = NULL
+	           WHERE status = 'running' AND locked_until < now() AND attempts >= max_attempts`
+
+	tag, err := r.pool.Exec(ctx, query)
+	if err != nil {
+		return 0, fmt.Errorf("fail expired jobs: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// Prune deletes the jobs that finished before a time, returning how many
+// there were.
+func (r *JobRepository) Prune(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := r.pool.Exec(ctx, `DELETE FROM jobs WHERE finished_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("prune jobs: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,544 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mamed-gasimov/file-service/internal/modules/usage"
+)
+
+const (
+	defaultWorkers         = 4
+	defaultMaxAttempts     = 3
+	defaultBackoff         = 10 * time.Second
+	maxBackoff             = time.Hour
+	defaultPollInterval    = time.Second
+	defaultShutdownTimeout = 30 * time.Second
+
+	// lease is how long a claimed job stays locked to its worker without a
+	// heartbeat. Workers extend it every third of that.
+	lease = time.Minute
+)
+
+var (
+	errCanceled = errors.New("job canceled")
+	errLost     = errors.New("job lease lost")
+)
+
+type service interface {
+	Submit(ctx context.Context, typ string, fileID *int64, params any, opts ...SubmitOption) (*Job, error)
+	GetJob(ctx context.Context, id int64) (*Job, error)
+	CancelJob(ctx context.Context, id int64) (*Job, error)
+}
+
+var _ service = (*JobService)(nil)
+
+// JobService stores jobs in Postgres and runs them on workers that claim
+// them with FOR UPDATE SKIP LOCKED, so several replicas can share the
+// queues. Failed jobs are retried with exponential backoff.
+type JobService struct {
+	repo        repository
+	definitions map[string]Definition
+	wake        map[string]chan struct{}
+	worker      string
+
+	workers         int
+	queueWorkers    map[string]int
+	pollInterval    time.Duration
+	timeout         time.Duration
+	shutdownTimeout time.Duration
+	retention       time.Duration
+
+	mu      sync.Mutex
+	running map[int64]context.CancelCauseFunc
+}
+
+// Option configures optional JobService features.
+type Option func(*JobService)
+
+// WithWorkers runs up to n jobs at a time on each queue that has no worker
+// count of its own (4 by default).
+func WithWorkers(n int) Option {
+	return func(s *JobService) {
+		s.workers = n
+	}
+}
+
+// WithQueueWorkers sets how many jobs run at a time per queue, overriding
+// WithWorkers for the queues listed.
+func WithQueueWorkers(workers map[string]int) Option {
+	return func(s *JobService) {
+		for queue, n := range workers {
+			s.queueWorkers[queue] = n
+		}
+	}
+}
+
+// WithPollInterval sets how often idle workers look for due jobs (every
+// second by default). Jobs submitted by this process wake them right away.
+func WithPollInterval(d time.Duration) Option {
+	return func(s *JobService) {
+		s.pollInterval = d
+	}
+}
+
+// WithTimeout fails attempts that run for longer than d. Without it, jobs
+// run until they finish or are canceled.
+func WithTimeout(d time.Duration) Option {
+	return func(s *JobService) {
+		s.timeout = d
+	}
+}
+
+// WithShutdownTimeout sets how long Run waits for running jobs once its
+// context is canceled (30s by default). Jobs still running after that are
+// interrupted and queued again for another worker.
+func WithShutdownTimeout(d time.Duration) Option {
+	return func(s *JobService) {
+		s.shutdownTimeout = d
+	}
+}
+
+// WithRetention deletes finished jobs d after they finished. Without it,
+// they are kept.
+func WithRetention(d time.Duration) Option {
+	return func(s *JobService) {
+		s.retention = d
+	}
+}
+
+func NewJobService(repo repository, opts ...Option) *JobService {
+	s := &JobService{
+		repo:            repo,
+		definitions:     make(map[string]Definition),
+		wake:            make(map[string]chan struct{}),
+		worker:          workerID(),
+		workers:         defaultWorkers,
+		queueWorkers:    make(map[string]int),
+		pollInterval:    defaultPollInterval,
+		shutdownTimeout: defaultShutdownTimeout,
+		running:         make(map[int64]context.CancelCauseFunc),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// workerID identifies this process in the locks it holds on jobs.
+func workerID() string {
+	host, _ := os.Hostname()
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return host + "-" + strconv.Itoa(os.Getpid()) + "-" + hex.EncodeToString(b)
+}
+
+// ParseQueueWorkers parses worker counts per queue given as
+// "queue=n,...".
+func ParseQueueWorkers(s string) (map[string]int, error) {
+	workers := make(map[string]int)
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		queue, count, ok := strings.Cut(field, "=")
+		if !ok {
+			return nil, fmt.Errorf("queue %q: want queue=workers", field)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(count))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("queue %q: invalid worker count %q", queue, count)
+		}
+		workers[strings.TrimSpace(queue)] = n
+	}
+	return workers, nil
+}
+
+// Register adds the definition of a job type. Definitions must be
+// registered before Run.
+func (s *JobService) Register(def Definition) {
+	if def.Queue == "" {
+		def.Queue = QueueDefault
+	}
+	if def.MaxAttempts <= 0 {
+		def.MaxAttempts = defaultMaxAttempts
+	}
+	if def.Backoff <= 0 {
+		def.Backoff = defaultBackoff
+	}
+	s.definitions[def.Type] = def
+	if _, ok := s.wake[def.Queue]; !ok {
+		s.wake[def.Queue] = make(chan struct{}, 1)
+	}
+}
+
+// Submit queues a job of type typ with params, accounted to the tenant of
+// ctx. With a UniqueKey option, the active job with that key is returned
+// instead when there is one.
+func (s *JobService) Submit(ctx context.Context, typ string, fileID *int64, params any, opts ...SubmitOption) (*Job, error) {
+	def, ok := s.definitions[typ]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", typ, ErrUnknownType)
+	}
+
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return nil, fmt.Errorf("marshal %s job params: %w", typ, err)
+	}
+
+	j := &Job{Type: typ, Queue: def.Queue, FileID: fileID, Params: raw, MaxAttempts: def.MaxAttempts}
+	if tenant, ok := usage.TenantFrom(ctx); ok {
+		j.Tenant = &tenant
+	}
+	for _, opt := range opts {
+		opt(j)
+	}
+
+	// The active job with the key can finish between the insert and the
+	// lookup; the insert then succeeds on the second try.
+	for range 2 {
+		created, err := s.repo.Create(ctx, j)
+		if err != nil {
+			return nil, err
+		}
+		if created {
+			if !j.RunAt.After(time.Now()) {
+				s.signal(def.Queue)
+			}
+			return j, nil
+		}
+
+		existing, err := s.repo.GetActiveByKey(ctx, *j.UniqueKey)
+		if err == nil {
+			return existing, nil
+		}
+		if !errors.Is(err, ErrNotFound) {
+			return nil, err
+		}
+	}
+
+	return nil, fmt.Errorf("submit %s job with key %q: conflicting jobs", typ, *j.UniqueKey)
+}
+
+// signal wakes an idle worker of a queue.
+func (s *JobService) signal(queue string) {
+	select {
+	case s.wake[queue] <- struct{}{}:
+	default:
+	}
+}
+
+func (s *JobService) GetJob(ctx context.Context, id int64) (*Job, error) {
+	return s.repo.Get(ctx, id)
+}
+
+// CancelJob cancels a queued or running job. A running job is interrupted,
+// though work it has already completed, such as a recorded analysis, is
+// kept. Jobs running on other replicas stop at their next heartbeat.
+func (s *JobService) CancelJob(ctx context.Context, id int64) (*Job, error) {
+	canceled, err := s.repo.Cancel(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if canceled {
+		s.mu.Lock()
+		if cancel, ok := s.running[id]; ok {
+			cancel(errCanceled)
+		}
+		s.mu.Unlock()
+	}
+
+	j, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !canceled {
+		return nil, fmt.Errorf("job %d %s, %w", id, j.Status, ErrConflict)
+	}
+
+	return j, nil
+}
+
+// Run schedules the periodic jobs, starts the workers of every queue with
+// registered definitions and blocks until ctx is canceled. Workers then
+// stop claiming jobs and Run waits for the running ones up to the shutdown
+// timeout before interrupting them.
+func (s *JobService) Run(ctx context.Context) {
+	s.schedulePeriodic(ctx)
+
+	// Running jobs outlive ctx until the shutdown timeout.
+	jobCtx, stopJobs := context.WithCancel(context.WithoutCancel(ctx))
+	defer stopJobs()
+
+	var wg sync.WaitGroup
+	for queue := range s.wake {
+		n, ok := s.queueWorkers[queue]
+		if !ok {
+			n = s.workers
+		}
+		for range n {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.work(ctx, jobCtx, queue)
+			}()
+		}
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.sweep(ctx)
+	}()
+
+	<-ctx.Done()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(s.shutdownTimeout):
+		log.Printf("jobs still running after %s, interrupting them", s.shutdownTimeout)
+		stopJobs()
+		<-done
+	}
+}
+
+// work claims and runs the due jobs of a queue until ctx is canceled.
+func (s *JobService) work(ctx, jobCtx context.Context, queue string) {
+	for ctx.Err() == nil {
+		j, err := s.repo.Claim(ctx, queue, s.worker, lease)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("claim %s job: %v", queue, err)
+		}
+		if j != nil {
+			s.run(jobCtx, j)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-s.wake[queue]:
+		case <-time.After(s.pollInterval):
+		}
+	}
+}
+
+// run runs a claimed job and records its outcome: success, another attempt
+// after a backoff, or failure once the attempts are used up or the error
+// is permanent. A job interrupted by the shutdown is queued again.
+func (s *JobService) run(ctx context.Context, j *Job) {
+	def := s.definitions[j.Type]
+
+	jobCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	runCtx := jobCtx
+	if s.timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		runCtx, cancelTimeout = context.WithTimeout(jobCtx, s.timeout)
+		defer cancelTimeout()
+	}
+	if j.Tenant != nil {
+		runCtx = usage.WithTenant(runCtx, *j.Tenant)
+	}
+
+	s.mu.Lock()
+	s.running[j.ID] = cancel
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.running, j.ID)
+		s.mu.Unlock()
+	}()
+
+	stopHeartbeat := s.heartbeat(jobCtx, j.ID, cancel)
+
+	progress := func(percent int) {
+		if err := s.repo.SetProgress(runCtx, j.ID, s.worker, min(max(percent, 0), 99)); err != nil && runCtx.Err() == nil {
+			log.Printf("set progress of job %d: %v", j.ID, err)
+		}
+	}
+
+	result, err := s.handle(runCtx, j, progress)
+	stopHeartbeat()
+
+	recordCtx := context.WithoutCancel(ctx)
+	switch cause := context.Cause(jobCtx); {
+	case errors.Is(cause, errCanceled), errors.Is(cause, errLost):
+		// Canceled jobs are already final and lost ones belong to another
+		// worker, so their outcome is not recorded.
+		return
+	case err == nil:
+		if err := s.repo.Finish(recordCtx, j.ID, s.worker, StatusSucceeded, result, nil); err != nil {
+			log.Printf("finish job %d: %v", j.ID, err)
+		}
+		s.reschedule(recordCtx, def)
+		return
+	case ctx.Err() != nil:
+		if err := s.repo.Release(recordCtx, j.ID, s.worker); err != nil {
+			log.Printf("release job %d: %v", j.ID, err)
+		}
+		return
+	}
+
+	if errors.Is(runCtx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("timed out after %s", s.timeout)
+	}
+
+	if j.Attempts < j.MaxAttempts && !isPermanent(err) {
+		delay := backoff(def.Backoff, j.Attempts)
+		log.Printf("%s job %d failed (attempt %d of %d), retrying in %s: %v",
+			j.Type, j.ID, j.Attempts, j.MaxAttempts, delay, err)
+		if err := s.repo.Retry(recordCtx, j.ID, s.worker, time.Now().Add(delay), err.Error()); err != nil {
+			log.Printf("retry job %d: %v", j.ID, err)
+		}
+		return
+	}
+
+	msg := err.Error()
+	if err := s.repo.Finish(recordCtx, j.ID, s.worker, StatusFailed, nil, &msg); err != nil {
+		log.Printf("finish job %d: %v", j.ID, err)
+	}
+	s.reschedule(recordCtx, def)
+}
+
+// heartbeat extends the lease on a running job until the returned function
+// is called, and cancels the job with errLost once the lease is gone.
+func (s *JobService) heartbeat(ctx context.Context, id int64, cancel context.CancelCauseFunc) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(lease / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			ok, err := s.repo.Heartbeat(ctx, id, s.worker, lease)
+			if err != nil {
+				log.Printf("extend lease of job %d: %v", id, err)
+				continue
+			}
+			if !ok {
+				cancel(errLost)
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// handle runs the handler of j, turning a panic into an error so that one
+// job cannot take the worker down.
+func (s *JobService) handle(ctx context.Context, j *Job, progress func(int)) (result json.RawMessage, err error) {
+	def, ok := s.definitions[j.Type]
+	if !ok {
+		return nil, Permanent(fmt.Errorf("%s: %w", j.Type, ErrUnknownType))
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%s job panicked: %v", j.Type, r)
+		}
+	}()
+
+	return def.Handler(ctx, j, progress)
+}
+
+// backoff returns the delay before the attempt after the given one: base,
+// doubled for every attempt before, at most maxBackoff.
+func backoff(base time.Duration, attempt int) time.Duration {
+	d := base
+	for range attempt - 1 {
+		d *= 2
+		if d >= maxBackoff {
+			return maxBackoff
+		}
+	}
+	return d
+}
+
+// periodicKey is the unique key of the scheduled job of a periodic type.
+func periodicKey(typ string) string {
+	return "periodic:" + typ
+}
+
+// schedulePeriodic makes sure a job of every periodic type is scheduled.
+// Jobs already scheduled, such as by an earlier run, are kept.
+func (s *JobService) schedulePeriodic(ctx context.Context) {
+	for _, def := range s.definitions {
+		s.reschedule(ctx, def)
+	}
+}
+
+// reschedule schedules the next job of a periodic type.
+func (s *JobService) reschedule(ctx context.Context, def Definition) {
+	if def.Every <= 0 {
+		return
+	}
+	_, err := s.Submit(ctx, def.Type, nil, struct{}{},
+		RunAt(time.Now().Add(def.Every)), UniqueKey(periodicKey(def.Type)))
+	if err != nil {
+		log.Printf("schedule %s job: %v", def.Type, err)
+	}
+}
+
+// sweep fails the jobs whose worker died after their last attempt and
+// deletes finished jobs past the retention until ctx is canceled.
+func (s *JobService) sweep(ctx context.Context) {
+	ticker := time.NewTicker(lease)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if n, err := s.repo.FailExpired(ctx); err != nil {
+			log.Printf("fail expired jobs: %v", err)
+		} else if n > 0 {
+			log.Printf("failed %d jobs whose worker stopped responding", n)
+		}
+
+		if s.retention > 0 {
+			if n, err := s.repo.Prune(ctx, time.Now().Add(-s.retention)); err != nil {
+				log.Printf("prune jobs: %v", err)
+			} else if n > 0 {
+				log.Printf("deleted %d finished jobs", n)
+			}
+		}
+
+		// A canceled periodic job leaves its type unscheduled.
+		s.schedulePeriodic(ctx)
+	}
+}
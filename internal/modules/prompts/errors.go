@@ -0,0 +1,12 @@
+package prompts
+
+import "errors"
+
+// ErrNotFound is returned when a prompt template or one of its versions does not exist.
+var ErrNotFound = errors.New("not found")
+
+// ErrConflict is returned when a prompt template with the same name already exists.
+var ErrConflict = errors.New("already exists")
+
+// ErrInvalid is returned for invalid names, analysis types and templates.
+var ErrInvalid = errors.New("invalid")
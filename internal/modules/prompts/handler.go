@@ -0,0 +1,131 @@
+package prompts
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// maxPageSize caps the limit query parameter of template listings.
+const maxPageSize = 1000
+
+type PromptHandler struct {
+	svc service
+}
+
+func NewPromptHandler(svc service) *PromptHandler {
+	return &PromptHandler{svc: svc}
+}
+
+func (h *PromptHandler) CreateTemplate(c echo.Context) error {
+	var req CreateRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+
+	t, err := h.svc.CreateTemplate(c.Request().Context(), req)
+	if err != nil {
+		return httpError(err)
+	}
+
+	return c.JSON(http.StatusCreated, t)
+}
+
+func (h *PromptHandler) ListTemplates(c echo.Context) error {
+	limit, offset, err := parsePage(c)
+	if err != nil {
+		return err
+	}
+
+	templates, err := h.svc.ListTemplates(c.Request().Context(), limit, offset)
+	if err != nil {
+		return httpError(err)
+	}
+
+	return c.JSON(http.StatusOK, templates)
+}
+
+// GetTemplate returns the latest version of a template, or the one given by
+// the version query parameter.
+func (h *PromptHandler) GetTemplate(c echo.Context) error {
+	version := 0
+	if v := c.QueryParam("version"); v != "" {
+		var err error
+		version, err = strconv.Atoi(v)
+		if err != nil || version < 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid version")
+		}
+	}
+
+	t, err := h.svc.GetTemplate(c.Request().Context(), c.Param("name"), version)
+	if err != nil {
+		return httpError(err)
+	}
+
+	return c.JSON(http.StatusOK, t)
+}
+
+func (h *PromptHandler) ListVersions(c echo.Context) error {
+	templates, err := h.svc.ListVersions(c.Request().Context(), c.Param("name"))
+	if err != nil {
+		return httpError(err)
+	}
+
+	return c.JSON(http.StatusOK, templates)
+}
+
+// UpdateTemplate adds a new version of a template.
+func (h *PromptHandler) UpdateTemplate(c echo.Context) error {
+	var req UpdateRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body")
+	}
+
+	t, err := h.svc.UpdateTemplate(c.Request().Context(), c.Param("name"), req)
+	if err != nil {
+		return httpError(err)
+	}
+
+	return c.JSON(http.StatusOK, t)
+}
+
+func (h *PromptHandler) DeleteTemplate(c echo.Context) error {
+	if err := h.svc.DeleteTemplate(c.Request().Context(), c.Param("name")); err != nil {
+		return httpError(err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// parsePage reads the limit and offset query parameters.
+func parsePage(c echo.Context) (limit, offset int, err error) {
+	if v := c.QueryParam("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return 0, 0, echo.NewHTTPError(http.StatusBadRequest, "invalid limit")
+		}
+	}
+	if v := c.QueryParam("offset"); v != "" {
+		offset, err = strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return 0, 0, echo.NewHTTPError(http.StatusBadRequest, "invalid offset")
+		}
+	}
+	return limit, offset, nil
+}
+
+// httpError maps prompt errors to HTTP errors.
+func httpError(err error) error {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrConflict):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	case errors.Is(err, ErrInvalid):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+}
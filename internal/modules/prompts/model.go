@@ -0,0 +1,33 @@
+package prompts
+
+import "time"
+
+// Template is a version of a named prompt template. Versions are immutable:
+// updating a template adds the next version. Template is a Go text/template
+// executed with analysis.PromptData to produce the instructions of an
+// analysis of type Type.
+type Template struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	Version     int       `json:"version"`
+	Type        string    `json:"type"`
+	Template    string    `json:"template"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// CreateRequest is the body of a prompt template creation.
+type CreateRequest struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Template    string `json:"template"`
+	Description string `json:"description"`
+}
+
+// UpdateRequest is the body of a prompt template update, which adds a new
+// version. An empty Type keeps the type of the latest version.
+type UpdateRequest struct {
+	Type        string `json:"type"`
+	Template    string `json:"template"`
+	Description string `json:"description"`
+}
@@ -0,0 +1,172 @@
+package prompts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type repository interface {
+	Create(ctx context.Context, t *Template) error
+	AddVersion(ctx context.Context, t *Template) error
+	Get(ctx context.Context, name string, version int) (*Template, error)
+	ListLatest(ctx context.Context, limit, offset int) ([]Template, error)
+	ListVersions(ctx context.Context, name string) ([]Template, error)
+	Delete(ctx context.Context, name string) error
+}
+
+var _ repository = (*PromptRepository)(nil)
+
+// uniqueViolation is the PostgreSQL SQLSTATE of a duplicate name and version.
+const uniqueViolation = "23505"
+
+const templateColumns = `id, name, version, type, template, description, created_at`
+
+func scanTemplate(row pgx.Row, t *Template) error {
+	return row.Scan(&t.ID, &t.Name, &t.Version, &t.Type, &t.Template, &t.Description, &t.CreatedAt)
+}
+
+type PromptRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewPromptRepository(pool *pgxpool.Pool) *PromptRepository {
+	return &PromptRepository{pool: pool}
+}
+
+// Create inserts the first version of a new template.
+func (r *PromptRepository) Create(ctx context.Context, t *Template) error {
+	query := `INSERT INTO prompt_templates (name, version, type, template, description)
+	           SELECT $1, 1, $2, $3, $4
+	           WHERE NOT EXISTS (SELECT 1 FROM prompt_templates WHERE name = $1)
+	           RETURNING ` + templateColumns
+
+	err := scanTemplate(r.pool.QueryRow(ctx, query, t.Name, t.Type, t.Template, t.Description), t)
+	if errors.Is(err, pgx.ErrNoRows) || isUniqueViolation(err) {
+		return fmt.Errorf("prompt template %q %w", t.Name, ErrConflict)
+	}
+	if err != nil {
+		return fmt.Errorf("create prompt template: %w", err)
+	}
+
+	return nil
+}
+
+// AddVersion inserts the next version of an existing template.
+func (r *PromptRepository) AddVersion(ctx context.Context, t *Template) error {
+	query := `INSERT INTO prompt_templates (name, version, type, template, description)
+	           SELECT $1, MAX(version) + 1, $2, $3, $4
+	           FROM prompt_templates WHERE name = $1
+	           HAVING COUNT(*) > 0
+	           RETURNING ` + templateColumns
+
+	err := scanTemplate(r.pool.QueryRow(ctx, query, t.Name, t.Type, t.Template, t.Description), t)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("prompt template %q %w", t.Name, ErrNotFound)
+	}
+	if isUniqueViolation(err) {
+		return fmt.Errorf("prompt template %q was updated concurrently: %w", t.Name, ErrConflict)
+	}
+	if err != nil {
+		return fmt.Errorf("add prompt template version: %w", err)
+	}
+
+	return nil
+}
+
+// Get returns a version of a template, the latest when version is 0.
+func (r *PromptRepository) Get(ctx context.Context, name string, version int) (*Template, error) {
+	query := `SELECT ` + templateColumns + `
+	           FROM prompt_templates
+	           WHERE name = $1 AND ($2 = 0 OR version = $2)
+	           ORDER BY version DESC
+	           LIMIT 1`
+
+	var t Template
+	err := scanTemplate(r.pool.QueryRow(ctx, query, name, version), &t)
+	if errors.Is(err, pgx.ErrNoRows) {
+		if version != 0 {
+			return nil, fmt.Errorf("version %d of prompt template %q %w", version, name, ErrNotFound)
+		}
+		return nil, fmt.Errorf("prompt template %q %w", name, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get prompt template: %w", err)
+	}
+
+	return &t, nil
+}
+
+// ListLatest returns the latest version of every template, ordered by name.
+func (r *PromptRepository) ListLatest(ctx context.Context, limit, offset int) ([]Template, error) {
+	query := `SELECT DISTINCT ON (name) ` + templateColumns + `
+	           FROM prompt_templates
+	           ORDER BY name, version DESC
+	           LIMIT NULLIF($1, 0) OFFSET $2`
+
+	rows, err := r.pool.Query(ctx, query, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("query prompt templates: %w", err)
+	}
+
+	return collectTemplates(rows)
+}
+
+// ListVersions returns every version of a template, newest first.
+func (r *PromptRepository) ListVersions(ctx context.Context, name string) ([]Template, error) {
+	query := `SELECT ` + templateColumns + `
+	           FROM prompt_templates WHERE name = $1
+	           ORDER BY version DESC`
+
+	rows, err := r.pool.Query(ctx, query, name)
+	if err != nil {
+		return nil, fmt.Errorf("query prompt template versions: %w", err)
+	}
+
+	templates, err := collectTemplates(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(templates) == 0 {
+		return nil, fmt.Errorf("prompt template %q %w", name, ErrNotFound)
+	}
+
+	return templates, nil
+}
+
+// Delete removes every version of a template.
+func (r *PromptRepository) Delete(ctx context.Context, name string) error {
+	tag, err := r.pool.Exec(ctx, `DELETE FROM prompt_templates WHERE name = $1`, name)
+	if err != nil {
+		return fmt.Errorf("delete prompt template: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("prompt template %q %w", name, ErrNotFound)
+	}
+
+	return nil
+}
+
+func collectTemplates(rows pgx.Rows) ([]Template, error) {
+	defer rows.Close()
+
+	var templates []Template
+	for rows.Next() {
+		var t Template
+		if err := scanTemplate(rows, &t); err != nil {
+			return nil, fmt.Errorf("scan prompt template: %w", err)
+		}
+		templates = append(templates, t)
+	}
+
+	return templates, rows.Err()
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation
+}
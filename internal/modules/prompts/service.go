@@ -0,0 +1,129 @@
+package prompts
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/mamed-gasimov/file-service/internal/modules/analysis"
+)
+
+const (
+	defaultPageSize = 50
+	// maxTemplateLen caps the size of a template, in bytes.
+	maxTemplateLen    = 16 << 10
+	maxDescriptionLen = 1024
+)
+
+// namePattern restricts template names to slugs such as "contract-summary".
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+type service interface {
+	CreateTemplate(ctx context.Context, req CreateRequest) (*Template, error)
+	UpdateTemplate(ctx context.Context, name string, req UpdateRequest) (*Template, error)
+	GetTemplate(ctx context.Context, name string, version int) (*Template, error)
+	ListTemplates(ctx context.Context, limit, offset int) ([]Template, error)
+	ListVersions(ctx context.Context, name string) ([]Template, error)
+	DeleteTemplate(ctx context.Context, name string) error
+}
+
+var _ service = (*PromptService)(nil)
+
+type PromptService struct {
+	repo repository
+}
+
+func NewPromptService(repo repository) *PromptService {
+	return &PromptService{repo: repo}
+}
+
+func (s *PromptService) CreateTemplate(ctx context.Context, req CreateRequest) (*Template, error) {
+	if !namePattern.MatchString(req.Name) {
+		return nil, fmt.Errorf("prompt template name %q must be 1 to 64 lower-case letters, digits, '-' or '_': %w", req.Name, ErrInvalid)
+	}
+
+	t := &Template{Name: req.Name, Type: req.Type, Template: req.Template, Description: req.Description}
+	if err := validate(t); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.Create(ctx, t); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// UpdateTemplate adds the next version of a template.
+func (s *PromptService) UpdateTemplate(ctx context.Context, name string, req UpdateRequest) (*Template, error) {
+	t := &Template{Name: name, Type: req.Type, Template: req.Template, Description: req.Description}
+	if t.Type == "" {
+		latest, err := s.repo.Get(ctx, name, 0)
+		if err != nil {
+			return nil, err
+		}
+		t.Type = latest.Type
+	}
+	if err := validate(t); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.AddVersion(ctx, t); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// GetTemplate returns a version of a template, the latest when version is 0.
+func (s *PromptService) GetTemplate(ctx context.Context, name string, version int) (*Template, error) {
+	return s.repo.Get(ctx, name, version)
+}
+
+// ListTemplates returns the latest version of every template, by name.
+func (s *PromptService) ListTemplates(ctx context.Context, limit, offset int) ([]Template, error) {
+	if limit == 0 {
+		limit = defaultPageSize
+	}
+
+	templates, err := s.repo.ListLatest(ctx, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	if templates == nil {
+		templates = []Template{}
+	}
+
+	return templates, nil
+}
+
+func (s *PromptService) ListVersions(ctx context.Context, name string) ([]Template, error) {
+	return s.repo.ListVersions(ctx, name)
+}
+
+// DeleteTemplate removes every version of a template. Analyses that used it
+// keep its name and version.
+func (s *PromptService) DeleteTemplate(ctx context.Context, name string) error {
+	return s.repo.Delete(ctx, name)
+}
+
+// validate checks the analysis type, template and description of t.
+func validate(t *Template) error {
+	if _, err := analysis.ParseType(t.Type); err != nil {
+		return fmt.Errorf("%v: %w", err, ErrInvalid)
+	}
+	if t.Template == "" {
+		return fmt.Errorf("empty template: %w", ErrInvalid)
+	}
+	if len(t.Template) > maxTemplateLen {
+		return fmt.Errorf("template longer than %d bytes: %w", maxTemplateLen, ErrInvalid)
+	}
+	if _, err := analysis.ParsePrompt(t.Name, t.Template); err != nil {
+		return fmt.Errorf("%v: %w", err, ErrInvalid)
+	}
+	if len(t.Description) > maxDescriptionLen {
+		return fmt.Errorf("description longer than %d bytes: %w", maxDescriptionLen, ErrInvalid)
+	}
+	return nil
+}
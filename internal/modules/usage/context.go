@@ -0,0 +1,48 @@
+package usage
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TenantHeader names the tenant a request is made for, such as a customer
+// or the owner of the API key a gateway authenticated.
+const TenantHeader = "X-Tenant-ID"
+
+// maxTenantLen caps the length of a tenant.
+const maxTenantLen = 128
+
+type tenantKey struct{}
+
+// WithTenant returns a copy of ctx whose AI calls are accounted to tenant.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFrom returns the tenant set by WithTenant, if any.
+func TenantFrom(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(tenantKey{}).(string)
+	return tenant, ok
+}
+
+// TenantMiddleware accounts the AI calls of each request to the tenant of
+// its X-Tenant-ID header, when set.
+func TenantMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		tenant := strings.TrimSpace(c.Request().Header.Get(TenantHeader))
+		if tenant == "" {
+			return next(c)
+		}
+		if len(tenant) > maxTenantLen || strings.ContainsFunc(tenant, unicode.IsControl) {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid "+TenantHeader)
+		}
+
+		req := c.Request()
+		c.SetRequest(req.WithContext(WithTenant(req.Context(), tenant)))
+		return next(c)
+	}
+}
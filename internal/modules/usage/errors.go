@@ -0,0 +1,9 @@
+package usage
+
+import "errors"
+
+// ErrInvalid is returned for invalid report filters, tenants and prices.
+var ErrInvalid = errors.New("invalid")
+
+// ErrBudgetExceeded is returned when a daily budget has been spent.
+var ErrBudgetExceeded = errors.New("exceeded")
@@ -0,0 +1,75 @@
+package usage
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type UsageHandler struct {
+	svc service
+}
+
+func NewUsageHandler(svc service) *UsageHandler {
+	return &UsageHandler{svc: svc}
+}
+
+// GetUsage reports AI usage and cost between the from and to dates
+// (YYYY-MM-DD), optionally of one tenant or file, grouped by the
+// comma-separated group_by dimensions.
+func (h *UsageHandler) GetUsage(c echo.Context) error {
+	var filter Filter
+	var err error
+
+	if v := c.QueryParam("from"); v != "" {
+		if filter.From, err = time.Parse(time.DateOnly, v); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid from, expected YYYY-MM-DD")
+		}
+	}
+	if v := c.QueryParam("to"); v != "" {
+		if filter.To, err = time.Parse(time.DateOnly, v); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid to, expected YYYY-MM-DD")
+		}
+	}
+	if v := c.QueryParam("tenant"); v != "" {
+		filter.Tenant = &v
+	}
+	if v := c.QueryParam("file_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id < 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid file_id")
+		}
+		filter.FileID = &id
+	}
+	if c.QueryParams().Has("group_by") {
+		filter.GroupBy = []string{}
+		for _, g := range strings.Split(c.QueryParam("group_by"), ",") {
+			if g = strings.TrimSpace(g); g != "" {
+				filter.GroupBy = append(filter.GroupBy, g)
+			}
+		}
+	}
+
+	report, err := h.svc.Report(c.Request().Context(), filter)
+	if err != nil {
+		return httpError(err)
+	}
+
+	return c.JSON(http.StatusOK, report)
+}
+
+// httpError maps usage errors to HTTP errors.
+func httpError(err error) error {
+	switch {
+	case errors.Is(err, ErrInvalid):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	case errors.Is(err, ErrBudgetExceeded):
+		return echo.NewHTTPError(http.StatusTooManyRequests, err.Error())
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,86 @@
+package usage
+
+import "time"
+
+// Operations billed by AI providers.
+const (
+	OperationAnalyze    = "analyze"
+	OperationEmbed      = "embed"
+	OperationAnswer     = "answer"
+	OperationDetectPII  = "detect_pii"
+	OperationTranscribe = "transcribe"
+)
+
+// Record is one billed provider call. Tenant is nil for requests without a
+// tenant and FileID for calls not about one file, such as embedding a
+// search query. CostUSD is estimated from the model's price.
+type Record struct {
+	ID           int64     `json:"id"`
+	Tenant       *string   `json:"tenant"`
+	Operation    string    `json:"operation"`
+	Model        string    `json:"model"`
+	FileID       *int64    `json:"file_id"`
+	InputTokens  int       `json:"input_tokens"`
+	OutputTokens int       `json:"output_tokens"`
+	CostUSD      float64   `json:"cost_usd"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Dimensions a usage report can be grouped by.
+const (
+	GroupDay       = "day"
+	GroupModel     = "model"
+	GroupTenant    = "tenant"
+	GroupOperation = "operation"
+	GroupFile      = "file"
+)
+
+// Filter selects the calls of a usage report: those made on the UTC days
+// from From to To, both included, optionally of one tenant or file, grouped
+// by GroupBy.
+type Filter struct {
+	From    time.Time
+	To      time.Time
+	Tenant  *string
+	FileID  *int64
+	GroupBy []string
+}
+
+// Totals sums the usage of a set of calls.
+type Totals struct {
+	Calls        int     `json:"calls"`
+	InputTokens  int64   `json:"input_tokens"`
+	OutputTokens int64   `json:"output_tokens"`
+	CostUSD      float64 `json:"cost_usd"`
+}
+
+// Row is the usage of one group of a report. Only the fields the report is
+// grouped by are set; Tenant is empty for calls without a tenant.
+type Row struct {
+	Day       string `json:"day,omitempty"`
+	Model     string `json:"model,omitempty"`
+	Tenant    string `json:"tenant,omitempty"`
+	Operation string `json:"operation,omitempty"`
+	FileID    *int64 `json:"file_id,omitempty"`
+	Totals
+}
+
+// Budget is the state of a daily budget: the global one, or the one of
+// Tenant.
+type Budget struct {
+	Tenant       *string `json:"tenant"`
+	LimitUSD     float64 `json:"limit_usd"`
+	SpentUSD     float64 `json:"spent_usd"`
+	RemainingUSD float64 `json:"remaining_usd"`
+}
+
+// Report is the usage of the calls selected by a Filter, with the state of
+// today's budgets.
+type Report struct {
+	From    string   `json:"from"`
+	To      string   `json:"to"`
+	GroupBy []string `json:"group_by"`
+	Total   Totals   `json:"total"`
+	Rows    []Row    `json:"rows"`
+	Budgets []Budget `json:"budgets"`
+}
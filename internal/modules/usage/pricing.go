@@ -0,0 +1,98 @@
+package usage
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mamed-gasimov/file-service/internal/modules/analysis"
+)
+
+// Price is the cost of a model in US dollars per million tokens, or per
+// minute of audio for transcription models.
+type Price struct {
+	Input  float64
+	Output float64
+	Minute float64
+}
+
+// DefaultPrices are the list prices of the OpenAI models the service uses.
+func DefaultPrices() map[string]Price {
+	return map[string]Price{
+		"gpt-4o-mini":            {Input: 0.15, Output: 0.60},
+		"gpt-4o":                 {Input: 2.50, Output: 10.00},
+		"text-embedding-3-small": {Input: 0.02},
+		"text-embedding-3-large": {Input: 0.13},
+		"text-embedding-ada-002": {Input: 0.10},
+		"whisper-1":              {Minute: 0.006},
+	}
+}
+
+// ParsePrices parses prices written as "model=input:output,...", in US
+// dollars per million tokens, such as "gpt-4o-mini=0.15:0.6". A third rate
+// is the price per minute of audio, such as "whisper-1=0:0:0.006".
+func ParsePrices(s string) (map[string]Price, error) {
+	prices := make(map[string]Price)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		model, rates, ok := strings.Cut(entry, "=")
+		in, out, _ := strings.Cut(rates, ":")
+		out, minute, _ := strings.Cut(out, ":")
+		model = strings.TrimSpace(model)
+		if !ok || model == "" {
+			return nil, fmt.Errorf("price %q: want model=input:output: %w", entry, ErrInvalid)
+		}
+
+		var p Price
+		var err error
+		if p.Input, err = parseRate(in); err != nil {
+			return nil, fmt.Errorf("price %q: %v: %w", entry, err, ErrInvalid)
+		}
+		if out != "" {
+			if p.Output, err = parseRate(out); err != nil {
+				return nil, fmt.Errorf("price %q: %v: %w", entry, err, ErrInvalid)
+			}
+		}
+		if minute != "" {
+			if p.Minute, err = parseRate(minute); err != nil {
+				return nil, fmt.Errorf("price %q: %v: %w", entry, err, ErrInvalid)
+			}
+		}
+		prices[model] = p
+	}
+	return prices, nil
+}
+
+func parseRate(s string) (float64, error) {
+	rate, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || rate < 0 {
+		return 0, fmt.Errorf("rate %q is not a non-negative number", s)
+	}
+	return rate, nil
+}
+
+// priceOf returns the price of model. Dated snapshots such as
+// "gpt-4o-mini-2024-07-18" are priced as the longest model name they
+// extend.
+func priceOf(prices map[string]Price, model string) (Price, bool) {
+	if p, ok := prices[model]; ok {
+		return p, true
+	}
+
+	best, found := "", false
+	for name := range prices {
+		if len(name) > len(best) && strings.HasPrefix(model, name+"-") {
+			best, found = name, true
+		}
+	}
+	return prices[best], found
+}
+
+// cost returns the estimated cost in US dollars of a call.
+func cost(p Price, u analysis.Usage) float64 {
+	return (float64(u.InputTokens)*p.Input+float64(u.OutputTokens)*p.Output)/1e6 + u.AudioSeconds/60*p.Minute
+}
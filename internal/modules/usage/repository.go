@@ -0,0 +1,135 @@
+package usage
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type repository interface {
+	Create(ctx context.Context, r *Record) error
+	Spent(ctx context.Context, tenant *string, since time.Time) (float64, error)
+	Summarize(ctx context.Context, filter Filter) ([]Row, error)
+}
+
+var _ repository = (*UsageRepository)(nil)
+
+// groupColumns are the SQL expressions of the report dimensions.
+var groupColumns = map[string]string{
+	GroupDay:       `to_char(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD')`,
+	GroupModel:     `model`,
+	GroupTenant:    `COALESCE(tenant, '')`,
+	GroupOperation: `operation`,
+	GroupFile:      `file_id`,
+}
+
+type UsageRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewUsageRepository(pool *pgxpool.Pool) *UsageRepository {
+	return &UsageRepository{pool: pool}
+}
+
+func (r *UsageRepository) Create(ctx context.Context, rec *Record) error {
+	query := `INSERT INTO ai_usage (tenant, operation, model, file_id, input_tokens, output_tokens, cost_usd)
+	           VALUES ($1, $2, $3, $4, $5, $6, $7)
+	           RETURNING id, created_at`
+
+	err := r.pool.QueryRow(ctx, query,
+		rec.Tenant, rec.Operation, rec.Model, rec.FileID, rec.InputTokens, rec.OutputTokens, rec.CostUSD,
+	).Scan(&rec.ID, &rec.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("insert usage record: %w", err)
+	}
+
+	return nil
+}
+
+// Spent returns the estimated cost of the calls made since since, of tenant
+// or of all tenants when nil.
+func (r *UsageRepository) Spent(ctx context.Context, tenant *string, since time.Time) (float64, error) {
+	query := `SELECT COALESCE(SUM(cost_usd), 0)
+	           FROM ai_usage
+	           WHERE created_at >= $1 AND ($2::text IS NULL OR tenant = $2)`
+
+	var spent float64
+	if err := r.pool.QueryRow(ctx, query, since, tenant).Scan(&spent); err != nil {
+		return 0, fmt.Errorf("sum usage cost: %w", err)
+	}
+
+	return spent, nil
+}
+
+// Summarize sums the calls selected by filter per group, by day first when
+// grouped by day and then by decreasing cost.
+func (r *UsageRepository) Summarize(ctx context.Context, filter Filter) ([]Row, error) {
+	conds := []string{"created_at >= $1", "created_at < $2"}
+	args := []any{filter.From, filter.To.AddDate(0, 0, 1)}
+	if filter.Tenant != nil {
+		args = append(args, *filter.Tenant)
+		conds = append(conds, "tenant = $"+strconv.Itoa(len(args)))
+	}
+	if filter.FileID != nil {
+		args = append(args, *filter.FileID)
+		conds = append(conds, "file_id = $"+strconv.Itoa(len(args)))
+	}
+
+	columns := make([]string, len(filter.GroupBy))
+	for i, g := range filter.GroupBy {
+		columns[i] = groupColumns[g]
+	}
+
+	query := `SELECT ` + strings.Join(append(columns,
+		`COUNT(*)`, `COALESCE(SUM(input_tokens), 0)`, `COALESCE(SUM(output_tokens), 0)`, `COALESCE(SUM(cost_usd), 0)`,
+	), ", ") + `
+	           FROM ai_usage
+	           WHERE ` + strings.Join(conds, " AND ")
+	if len(columns) > 0 {
+		order := append([]string{"SUM(cost_usd) DESC"}, columns...)
+		if filter.GroupBy[0] == GroupDay {
+			order = append([]string{columns[0]}, order...)
+		}
+		query += `
+	           GROUP BY ` + strings.Join(columns, ", ") + `
+	           ORDER BY ` + strings.Join(order, ", ")
+	}
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query usage: %w", err)
+	}
+	defer rows.Close()
+
+	var result []Row
+	for rows.Next() {
+		var row Row
+		dest := make([]any, 0, len(filter.GroupBy)+4)
+		for _, g := range filter.GroupBy {
+			switch g {
+			case GroupDay:
+				dest = append(dest, &row.Day)
+			case GroupModel:
+				dest = append(dest, &row.Model)
+			case GroupTenant:
+				dest = append(dest, &row.Tenant)
+			case GroupOperation:
+				dest = append(dest, &row.Operation)
+			case GroupFile:
+				dest = append(dest, &row.FileID)
+			}
+		}
+		dest = append(dest, &row.Calls, &row.InputTokens, &row.OutputTokens, &row.CostUSD)
+
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("scan usage: %w", err)
+		}
+		result = append(result, row)
+	}
+
+	return result, rows.Err()
+}
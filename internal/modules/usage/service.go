@@ -0,0 +1,227 @@
+package usage
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/mamed-gasimov/file-service/internal/modules/analysis"
+)
+
+const (
+	// defaultReportDays is the period of reports that do not set one.
+	defaultReportDays = 30
+	// maxReportDays caps the period of a report.
+	maxReportDays = 366
+)
+
+// groupOrder is the order of the dimensions of a report's rows.
+var groupOrder = []string{GroupDay, GroupTenant, GroupModel, GroupOperation, GroupFile}
+
+// defaultGroupBy groups reports that do not choose their dimensions.
+var defaultGroupBy = []string{GroupDay, GroupTenant, GroupModel}
+
+type service interface {
+	Record(ctx context.Context, operation string, fileID *int64, u analysis.Usage)
+	CheckBudget(ctx context.Context) error
+	Report(ctx context.Context, filter Filter) (*Report, error)
+}
+
+var _ service = (*UsageService)(nil)
+
+type UsageService struct {
+	repo   repository
+	prices map[string]Price
+
+	dailyBudget       float64
+	tenantDailyBudget float64
+}
+
+// Option configures optional UsageService features.
+type Option func(*UsageService)
+
+// WithPrices prices models, overriding DefaultPrices.
+func WithPrices(prices map[string]Price) Option {
+	return func(s *UsageService) {
+		for model, p := range prices {
+			s.prices[model] = p
+		}
+	}
+}
+
+// WithDailyBudget caps the estimated cost of the AI calls of each UTC day,
+// in US dollars.
+func WithDailyBudget(usd float64) Option {
+	return func(s *UsageService) {
+		s.dailyBudget = usd
+	}
+}
+
+// WithTenantDailyBudget caps the estimated cost of the AI calls each tenant
+// makes on a UTC day, in US dollars.
+func WithTenantDailyBudget(usd float64) Option {
+	return func(s *UsageService) {
+		s.tenantDailyBudget = usd
+	}
+}
+
+func NewUsageService(repo repository, opts ...Option) *UsageService {
+	s := &UsageService{repo: repo, prices: DefaultPrices()}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Record accounts a provider call to the tenant of ctx. Recording is
+// best-effort: the call has been made, so failures are only logged.
+func (s *UsageService) Record(ctx context.Context, operation string, fileID *int64, u analysis.Usage) {
+	rec := &Record{
+		Operation:    operation,
+		Model:        u.Model,
+		FileID:       fileID,
+		InputTokens:  u.InputTokens,
+		OutputTokens: u.OutputTokens,
+	}
+	if tenant, ok := TenantFrom(ctx); ok {
+		rec.Tenant = &tenant
+	}
+
+	if p, ok := priceOf(s.prices, u.Model); ok {
+		rec.CostUSD = cost(p, u)
+	} else {
+		log.Printf("no price for model %q, recording %s usage at no cost", u.Model, operation)
+	}
+
+	// The request may have been canceled after the provider billed it.
+	if err := s.repo.Create(context.WithoutCancel(ctx), rec); err != nil {
+		log.Printf("record %s usage: %v", operation, err)
+	}
+}
+
+// CheckBudget returns ErrBudgetExceeded once today's global budget, or the
+// budget of the tenant of ctx, has been spent.
+func (s *UsageService) CheckBudget(ctx context.Context) error {
+	today := startOfDay(time.Now())
+
+	if s.dailyBudget > 0 {
+		spent, err := s.repo.Spent(ctx, nil, today)
+		if err != nil {
+			return err
+		}
+		if spent >= s.dailyBudget {
+			return fmt.Errorf("daily AI budget of $%.2f %w", s.dailyBudget, ErrBudgetExceeded)
+		}
+	}
+
+	if tenant, ok := TenantFrom(ctx); ok && s.tenantDailyBudget > 0 {
+		spent, err := s.repo.Spent(ctx, &tenant, today)
+		if err != nil {
+			return err
+		}
+		if spent >= s.tenantDailyBudget {
+			return fmt.Errorf("daily AI budget of $%.2f of tenant %q %w", s.tenantDailyBudget, tenant, ErrBudgetExceeded)
+		}
+	}
+
+	return nil
+}
+
+// Report sums the usage selected by filter, the last 30 days grouped by
+// day, tenant and model by default, and reports today's budgets.
+func (s *UsageService) Report(ctx context.Context, filter Filter) (*Report, error) {
+	if filter.To.IsZero() {
+		filter.To = time.Now()
+	}
+	filter.To = startOfDay(filter.To)
+	if filter.From.IsZero() {
+		filter.From = filter.To.AddDate(0, 0, 1-defaultReportDays)
+	}
+	filter.From = startOfDay(filter.From)
+
+	if filter.From.After(filter.To) {
+		return nil, fmt.Errorf("from is after to: %w", ErrInvalid)
+	}
+	if filter.To.Sub(filter.From) >= maxReportDays*24*time.Hour {
+		return nil, fmt.Errorf("period longer than %d days: %w", maxReportDays, ErrInvalid)
+	}
+
+	if filter.GroupBy == nil {
+		filter.GroupBy = defaultGroupBy
+	}
+	for _, g := range filter.GroupBy {
+		if !slices.Contains(groupOrder, g) {
+			return nil, fmt.Errorf("unknown group %q, want one of %v: %w", g, groupOrder, ErrInvalid)
+		}
+	}
+	var groupBy []string
+	for _, g := range groupOrder {
+		if slices.Contains(filter.GroupBy, g) {
+			groupBy = append(groupBy, g)
+		}
+	}
+	filter.GroupBy = groupBy
+
+	rows, err := s.repo.Summarize(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{
+		From:    filter.From.Format(time.DateOnly),
+		To:      filter.To.Format(time.DateOnly),
+		GroupBy: append([]string{}, groupBy...),
+		Rows:    []Row{},
+		Budgets: []Budget{},
+	}
+	if len(groupBy) == 0 {
+		// A report without groups has one row, the total.
+		if len(rows) > 0 {
+			report.Total = rows[0].Totals
+		}
+	} else {
+		for _, row := range rows {
+			report.Rows = append(report.Rows, row)
+			report.Total.Calls += row.Calls
+			report.Total.InputTokens += row.InputTokens
+			report.Total.OutputTokens += row.OutputTokens
+			report.Total.CostUSD += row.CostUSD
+		}
+	}
+
+	today := startOfDay(time.Now())
+	if s.dailyBudget > 0 {
+		b, err := s.budget(ctx, nil, s.dailyBudget, today)
+		if err != nil {
+			return nil, err
+		}
+		report.Budgets = append(report.Budgets, *b)
+	}
+	if tenant, ok := TenantFrom(ctx); ok && s.tenantDailyBudget > 0 {
+		b, err := s.budget(ctx, &tenant, s.tenantDailyBudget, today)
+		if err != nil {
+			return nil, err
+		}
+		report.Budgets = append(report.Budgets, *b)
+	}
+
+	return report, nil
+}
+
+// budget returns the state of a daily budget of limit dollars.
+func (s *UsageService) budget(ctx context.Context, tenant *string, limit float64, today time.Time) (*Budget, error) {
+	spent, err := s.repo.Spent(ctx, tenant, today)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Budget{Tenant: tenant, LimitUSD: limit, SpentUSD: spent, RemainingUSD: max(0, limit-spent)}, nil
+}
+
+// startOfDay returns the start of the UTC day of t.
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
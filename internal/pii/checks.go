@@ -0,0 +1,137 @@
+package pii
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// dateRe matches numeric dates such as 01.02.2026, which look like phone
+// numbers with a leading 0.
+var dateRe = regexp.MustCompile(`^\d{1,4}[./-]\d{1,2}[./-]\d{1,4}$`)
+
+// digits returns the ASCII digits of s.
+func digits(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < '0' || r > '9' {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// matchIBAN accepts an IBAN whose check digits are valid (ISO 13616, mod
+// 97). A candidate that swallowed a following group, such as an upper-case
+// word, is shortened group by group until it is valid.
+func matchIBAN(candidate string) int {
+	for s := candidate; len(s) >= 15; {
+		if validIBAN(strings.ReplaceAll(s, " ", "")) {
+			return len(s)
+		}
+		i := strings.LastIndexByte(s, ' ')
+		if i < 0 {
+			break
+		}
+		s = s[:i]
+	}
+	return 0
+}
+
+func validIBAN(s string) bool {
+	if len(s) < 15 || len(s) > 34 {
+		return false
+	}
+
+	rem := 0
+	for _, r := range s[4:] + s[:4] {
+		switch {
+		case r >= '0' && r <= '9':
+			rem = (rem*10 + int(r-'0')) % 97
+		case r >= 'A' && r <= 'Z':
+			rem = (rem*100 + int(r-'A'+10)) % 97
+		default:
+			return false
+		}
+	}
+	return rem == 1
+}
+
+// matchCard accepts a payment card number of 13 to 19 digits from one of
+// the major networks that passes the Luhn check.
+func matchCard(candidate string) int {
+	d := digits(candidate)
+	if len(d) < 13 || len(d) > 19 || d[0] < '2' || d[0] > '6' {
+		return 0
+	}
+
+	sum := 0
+	for i := range len(d) {
+		n := int(d[len(d)-1-i] - '0')
+		if i%2 == 1 {
+			if n *= 2; n > 9 {
+				n -= 9
+			}
+		}
+		sum += n
+	}
+	if sum%10 != 0 {
+		return 0
+	}
+	return len(candidate)
+}
+
+// matchSSN accepts a US social security number in the ranges that are
+// issued: no area 000, 666 or 9xx, no group 00 and no serial 0000.
+func matchSSN(candidate string) int {
+	area, group, serial := candidate[0:3], candidate[4:6], candidate[7:11]
+	if area == "000" || area == "666" || area[0] == '9' || group == "00" || serial == "0000" {
+		return 0
+	}
+	return len(candidate)
+}
+
+// matchNINO accepts a UK national insurance number without one of the
+// prefixes that are never issued.
+func matchNINO(candidate string) int {
+	switch candidate[:2] {
+	case "BG", "GB", "KN", "NK", "NT", "TN", "ZZ":
+		return 0
+	}
+	return len(candidate)
+}
+
+// matchDNI accepts a Spanish DNI or NIE number whose check letter is valid.
+func matchDNI(candidate string) int {
+	number := candidate[:len(candidate)-1]
+	if prefix := strings.IndexByte("XYZ", number[0]); prefix >= 0 {
+		number = strconv.Itoa(prefix) + number[1:]
+	}
+	if len(number) != 8 {
+		return 0
+	}
+
+	n, err := strconv.Atoi(number)
+	if err != nil || "TRWAGMYFPDXBNJZSQVHLCKE"[n%23] != candidate[len(candidate)-1] {
+		return 0
+	}
+	return len(candidate)
+}
+
+// matchPhone accepts 8 to 15 digits written as a phone number: in
+// international format, with an area code in parentheses or a leading 0,
+// or as at least 10 digits split into groups. Dates and amounts, with
+// fewer digits or neither of these forms, are not matched.
+func matchPhone(candidate string) int {
+	d := digits(candidate)
+	if len(d) < 8 || len(d) > 15 || dateRe.MatchString(candidate) {
+		return 0
+	}
+
+	switch {
+	case candidate[0] == '+', candidate[0] == '(', candidate[0] == '0':
+	case len(d) >= 10 && len(d) < len(candidate):
+	default:
+		return 0
+	}
+	return len(candidate)
+}
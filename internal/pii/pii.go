@@ -0,0 +1,195 @@
+// Package pii finds personal data in text, such as email addresses, phone
+// numbers, bank accounts, card numbers and national identity numbers, and
+// redacts it.
+package pii
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Type is a kind of personal data.
+type Type string
+
+const (
+	TypeEmail      Type = "email"
+	TypePhone      Type = "phone"
+	TypeIBAN       Type = "iban"
+	TypeCreditCard Type = "credit_card"
+	TypeNationalID Type = "national_id"
+	TypePerson     Type = "person"
+	TypeAddress    Type = "address"
+)
+
+// Types lists the kinds of personal data. Names of people and postal
+// addresses are only found by models.
+var Types = []Type{TypeEmail, TypePhone, TypeIBAN, TypeCreditCard, TypeNationalID, TypePerson, TypeAddress}
+
+// ParseType returns the Type named s.
+func ParseType(s string) (Type, error) {
+	t := Type(strings.ToLower(strings.TrimSpace(s)))
+	if !slices.Contains(Types, t) {
+		return "", fmt.Errorf("unknown personal data type %q", s)
+	}
+	return t, nil
+}
+
+// Detectors that produce findings.
+const (
+	DetectorPattern = "pattern"
+	DetectorModel   = "model"
+)
+
+// Finding is personal data found in a text, at the character (rune)
+// offsets Start, inclusive, and End, exclusive.
+type Finding struct {
+	Type     Type   `json:"type"`
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
+	Detector string `json:"detector"`
+}
+
+// Text returns the text of f in text.
+func (f Finding) Text(text string) string {
+	runes := []rune(text)
+	return string(runes[min(f.Start, len(runes)):min(f.End, len(runes))])
+}
+
+// pattern matches one kind of personal data. match returns the length of
+// the longest valid prefix of a candidate, 0 if there is none, and is nil
+// when every candidate is valid.
+type pattern struct {
+	typ   Type
+	re    *regexp.Regexp
+	match func(candidate string) int
+}
+
+// patterns are tried in order; a match overlapping an earlier one is
+// dropped, so the checksummed numbers come before phone numbers.
+var patterns = []pattern{
+	{TypeEmail, regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`), nil},
+	{TypeIBAN, regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]{4}){2,7}(?: ?[A-Z0-9]{1,3})?\b`), matchIBAN},
+	{TypeCreditCard, regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`), matchCard},
+	{TypeNationalID, regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`), matchSSN},
+	{TypeNationalID, regexp.MustCompile(`\b[A-CEGHJ-PR-TW-Z][A-CEGHJ-NPR-TW-Z] ?\d{2} ?\d{2} ?\d{2} ?[A-D]\b`), matchNINO},
+	{TypeNationalID, regexp.MustCompile(`\b[XYZ]?\d{7,8}[A-Z]\b`), matchDNI},
+	{TypePhone, regexp.MustCompile(`(?:\+\d{1,3}[ .-]?)?(?:\(\d{1,5}\)[ .-]?)?\d{2,5}(?:[ .-]?\d{2,5}){1,4}`), matchPhone},
+}
+
+// span is a finding at byte offsets.
+type span struct {
+	typ        Type
+	start, end int
+}
+
+// Detect finds the personal data in text that patterns can match: email
+// addresses, phone numbers, IBANs and card numbers with valid checksums,
+// US social security numbers, UK national insurance numbers and Spanish
+// DNI/NIE numbers. Findings are ordered by offset and do not overlap.
+func Detect(text string) []Finding {
+	var spans []span
+	for _, p := range patterns {
+		for _, loc := range p.re.FindAllStringIndex(text, -1) {
+			start, end := loc[0], loc[1]
+			if p.match != nil {
+				end = start + p.match(text[start:end])
+			}
+			if end == start || !bounded(text, start, end) || overlaps(spans, start, end) {
+				continue
+			}
+			spans = append(spans, span{p.typ, start, end})
+		}
+	}
+	slices.SortFunc(spans, func(a, b span) int { return a.start - b.start })
+
+	// Convert byte offsets to rune offsets in one pass over the text.
+	findings := make([]Finding, len(spans))
+	pos, runes := 0, 0
+	for i, sp := range spans {
+		runes += utf8.RuneCountInString(text[pos:sp.start])
+		start := runes
+		runes += utf8.RuneCountInString(text[sp.start:sp.end])
+		pos = sp.end
+		findings[i] = Finding{Type: sp.typ, Start: start, End: runes, Detector: DetectorPattern}
+	}
+
+	return findings
+}
+
+// bounded reports whether text[start:end] is not part of a longer word or
+// number.
+func bounded(text string, start, end int) bool {
+	before, _ := utf8.DecodeLastRuneInString(text[:start])
+	after, _ := utf8.DecodeRuneInString(text[end:])
+	return !isWordRune(before) && !isWordRune(after)
+}
+
+func isWordRune(r rune) bool {
+	return r != utf8.RuneError && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+func overlaps(spans []span, start, end int) bool {
+	return slices.ContainsFunc(spans, func(sp span) bool { return start < sp.end && sp.start < end })
+}
+
+// Locate returns a finding of type t for every occurrence of value in
+// text, such as an entity reported by a model.
+func Locate(text string, t Type, value string) []Finding {
+	value = strings.TrimSpace(value)
+	if utf8.RuneCountInString(value) < 2 {
+		return nil
+	}
+	n := utf8.RuneCountInString(value)
+
+	var findings []Finding
+	pos, runes := 0, 0
+	for {
+		i := strings.Index(text[pos:], value)
+		if i < 0 {
+			return findings
+		}
+		runes += utf8.RuneCountInString(text[pos : pos+i])
+		findings = append(findings, Finding{Type: t, Start: runes, End: runes + n, Detector: DetectorModel})
+		runes += n
+		pos += i + len(value)
+	}
+}
+
+// Merge adds the findings of extra that do not overlap any of findings,
+// and returns them all ordered by offset.
+func Merge(findings, extra []Finding) []Finding {
+	out := slices.Clone(findings)
+	for _, e := range extra {
+		if !slices.ContainsFunc(out, func(f Finding) bool { return e.Start < f.End && f.Start < e.End }) {
+			out = append(out, e)
+		}
+	}
+	slices.SortFunc(out, func(a, b Finding) int { return a.Start - b.Start })
+	return out
+}
+
+// Redact replaces every finding in text with its type in brackets, such as
+// [EMAIL]. findings must be ordered by offset and must not overlap;
+// findings past the end of text are ignored.
+func Redact(text string, findings []Finding) string {
+	runes := []rune(text)
+
+	var b strings.Builder
+	b.Grow(len(text))
+	pos := 0
+	for _, f := range findings {
+		if f.Start < pos || f.Start >= len(runes) {
+			continue
+		}
+		b.WriteString(string(runes[pos:f.Start]))
+		b.WriteString("[" + strings.ToUpper(string(f.Type)) + "]")
+		pos = min(f.End, len(runes))
+	}
+	b.WriteString(string(runes[pos:]))
+
+	return b.String()
+}
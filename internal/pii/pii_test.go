@@ -0,0 +1,248 @@
+package pii
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestChecks(t *testing.T) {
+	tests := []struct {
+		name      string
+		match     func(string) int
+		candidate string
+		want      int
+	}{
+		{"iban valid", matchIBAN, "GB82 WEST 1234 5698 7654 32", 27},
+		{"iban valid compact", matchIBAN, "DE89370400440532013000", 22},
+		{"iban bad check digits", matchIBAN, "GB82 WEST 1234 5698 7654 33", 0},
+		{"iban trailing word trimmed", matchIBAN, "GB82 WEST 1234 5698 7654 32 ABCD", 27},
+		{"iban too short", matchIBAN, "GB82 WEST 12", 0},
+
+		{"card visa", matchCard, "4111 1111 1111 1111", 19},
+		{"card mastercard", matchCard, "5500-0000-0000-0004", 19},
+		{"card luhn fails", matchCard, "4111 1111 1111 1112", 0},
+		{"card unknown network", matchCard, "8111111111111113", 0},
+		{"card too short", matchCard, "411111111111", 0},
+
+		{"ssn valid", matchSSN, "123-45-6789", 11},
+		{"ssn area 000", matchSSN, "000-45-6789", 0},
+		{"ssn area 666", matchSSN, "666-45-6789", 0},
+		{"ssn area 9xx", matchSSN, "912-45-6789", 0},
+		{"ssn group 00", matchSSN, "123-00-6789", 0},
+		{"ssn serial 0000", matchSSN, "123-45-0000", 0},
+
+		{"nino valid", matchNINO, "AB 12 34 56 C", 13},
+		{"nino excluded prefix", matchNINO, "GB 12 34 56 A", 0},
+
+		{"dni valid", matchDNI, "12345678Z", 9},
+		{"dni bad letter", matchDNI, "12345678A", 0},
+		{"nie valid", matchDNI, "X1234567L", 9},
+		{"nie bad letter", matchDNI, "X1234567T", 0},
+		{"dni too short", matchDNI, "1234567L", 0},
+
+		{"phone international", matchPhone, "+49 30 1234567", 14},
+		{"phone area code", matchPhone, "(030) 1234567", 13},
+		{"phone leading zero", matchPhone, "030 1234567", 11},
+		{"phone grouped", matchPhone, "555 123 4567", 12},
+		{"phone date", matchPhone, "01.02.2026", 0},
+		{"phone plain number", matchPhone, "123456789", 0},
+		{"phone too short", matchPhone, "+1 234", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.match(tt.candidate); got != tt.want {
+				t.Errorf("match(%q) = %d, want %d", tt.candidate, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []Finding
+	}{
+		{
+			name: "empty",
+			text: "nothing to see here",
+			want: []Finding{},
+		},
+		{
+			name: "email",
+			text: "mail anna@example.com today",
+			want: []Finding{{TypeEmail, 5, 21, DetectorPattern}},
+		},
+		{
+			name: "multibyte text before findings",
+			text: "Grüße aus Köln — anna@example.com, Tel. +49 221 1234567",
+			want: []Finding{
+				{TypeEmail, 17, 33, DetectorPattern},
+				{TypePhone, 40, 55, DetectorPattern},
+			},
+		},
+		{
+			name: "card wins over phone",
+			text: "Karte: 4111 1111 1111 1111.",
+			want: []Finding{{TypeCreditCard, 7, 26, DetectorPattern}},
+		},
+		{
+			name: "iban and national ids",
+			text: "IBAN GB82 WEST 1234 5698 7654 32, SSN 123-45-6789, DNI 12345678Z",
+			want: []Finding{
+				{TypeIBAN, 5, 32, DetectorPattern},
+				{TypeNationalID, 38, 49, DetectorPattern},
+				{TypeNationalID, 55, 64, DetectorPattern},
+			},
+		},
+		{
+			name: "invalid numbers and dates",
+			text: "card 4111 1111 1111 1112, ssn 000-12-3456, on 01.02.2026",
+			want: []Finding{},
+		},
+		{
+			name: "part of a longer word",
+			text: "ref X12345678Zabc",
+			want: []Finding{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Detect(tt.text)
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("Detect(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+			for _, f := range got {
+				if f.Text(tt.text) == "" {
+					t.Errorf("finding %v has no text", f)
+				}
+			}
+		})
+	}
+}
+
+func TestFindingText(t *testing.T) {
+	text := "Zoë Müller, zoë@example.com"
+	f := Finding{Type: TypePerson, Start: 0, End: 10}
+	if got := f.Text(text); got != "Zoë Müller" {
+		t.Errorf("Text = %q, want %q", got, "Zoë Müller")
+	}
+
+	past := Finding{Type: TypePerson, Start: 16, End: 100}
+	if got := past.Text(text); got != "example.com" {
+		t.Errorf("Text past the end = %q, want %q", got, "example.com")
+	}
+}
+
+func TestLocate(t *testing.T) {
+	text := "Zoë Müller met Jan. Later, Zoë Müller left."
+	got := Locate(text, TypePerson, " Zoë Müller ")
+	want := []Finding{
+		{TypePerson, 0, 10, DetectorModel},
+		{TypePerson, 27, 37, DetectorModel},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Locate = %v, want %v", got, want)
+	}
+
+	if got := Locate(text, TypePerson, "Z"); got != nil {
+		t.Errorf("Locate of a single rune = %v, want nil", got)
+	}
+	if got := Locate(text, TypePerson, "Anna"); got != nil {
+		t.Errorf("Locate of a missing value = %v, want nil", got)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	findings := []Finding{
+		{TypeEmail, 10, 20, DetectorPattern},
+		{TypePhone, 30, 40, DetectorPattern},
+	}
+	extra := []Finding{
+		{TypePerson, 35, 45, DetectorModel}, // overlaps the phone number
+		{TypePerson, 0, 5, DetectorModel},
+		{TypeAddress, 20, 30, DetectorModel}, // touches both, overlaps neither
+		{TypePerson, 1, 3, DetectorModel},    // overlaps an earlier extra
+	}
+
+	got := Merge(findings, extra)
+	want := []Finding{
+		{TypePerson, 0, 5, DetectorModel},
+		{TypeEmail, 10, 20, DetectorPattern},
+		{TypeAddress, 20, 30, DetectorModel},
+		{TypePhone, 30, 40, DetectorPattern},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Merge = %v, want %v", got, want)
+	}
+	if len(findings) != 2 {
+		t.Errorf("Merge changed its input: %v", findings)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		findings []Finding
+		want     string
+	}{
+		{
+			name: "none",
+			text: "plain text",
+			want: "plain text",
+		},
+		{
+			name: "multibyte",
+			text: "Grüße an anna@example.com und Zoë Müller!",
+			findings: []Finding{
+				{TypeEmail, 9, 25, DetectorPattern},
+				{TypePerson, 30, 40, DetectorModel},
+			},
+			want: "Grüße an [EMAIL] und [PERSON]!",
+		},
+		{
+			name: "at both ends",
+			text: "4111111111111111 or 030 1234567",
+			findings: []Finding{
+				{TypeCreditCard, 0, 16, DetectorPattern},
+				{TypePhone, 20, 31, DetectorPattern},
+			},
+			want: "[CREDIT_CARD] or [PHONE]",
+		},
+		{
+			name: "past the end",
+			text: "short",
+			findings: []Finding{
+				{TypeEmail, 2, 50, DetectorPattern},
+				{TypePhone, 60, 70, DetectorPattern},
+			},
+			want: "sh[EMAIL]",
+		},
+		{
+			name: "overlapping finding skipped",
+			text: "abcdefghij",
+			findings: []Finding{
+				{TypePerson, 0, 5, DetectorModel},
+				{TypeAddress, 3, 8, DetectorModel},
+			},
+			want: "[PERSON]fghij",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Redact(tt.text, tt.findings); got != tt.want {
+				t.Errorf("Redact = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseType(t *testing.T) {
+	if got, err := ParseType(" IBAN "); err != nil || got != TypeIBAN {
+		t.Errorf("ParseType(\" IBAN \") = %q, %v, want %q", got, err, TypeIBAN)
+	}
+	if _, err := ParseType("passport"); err == nil {
+		t.Error("ParseType(\"passport\") succeeded, want an error")
+	}
+}
@@ -4,21 +4,73 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/mamed-gasimov/file-service/internal/modules/files"
+	"github.com/mamed-gasimov/file-service/internal/modules/folders"
+	"github.com/mamed-gasimov/file-service/internal/modules/jobs"
+	"github.com/mamed-gasimov/file-service/internal/modules/prompts"
+	"github.com/mamed-gasimov/file-service/internal/modules/usage"
 )
 
-func New(fileHandler *files.FileHandler) *echo.Echo {
+func New(fileHandler *files.FileHandler, folderHandler *folders.FolderHandler, promptHandler *prompts.PromptHandler, usageHandler *usage.UsageHandler, jobHandler *jobs.JobHandler) *echo.Echo {
 	e := echo.New()
 
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
-	e.Use(middleware.CORS())
+	// Browser clients read the ETag to send it back in If-Match, and the
+	// Location of jobs to poll them.
+	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{ExposeHeaders: []string{"ETag", "Location"}}))
+	// AI calls are accounted to the tenant of the X-Tenant-ID header.
+	e.Use(usage.TenantMiddleware)
 
 	api := e.Group("/api")
 	{
 		api.GET("/files", fileHandler.ListFiles)
 		api.POST("/files", fileHandler.UploadFile)
+		api.GET("/files/search", fileHandler.SearchFiles)
+		api.GET("/files/semantic-search", fileHandler.SemanticSearch)
+		api.POST("/files/analyze-batch", fileHandler.AnalyzeBatch)
 		api.POST("/files/:id/analyze", fileHandler.AnalyzeFile)
+		api.GET("/files/:id/analyses", fileHandler.ListAnalyses)
+		api.POST("/files/:id/ask", fileHandler.AskFile)
 		api.DELETE("/files/:id", fileHandler.DeleteFile)
+		api.GET("/files/:id", fileHandler.GetFile)
+		api.PATCH("/files/:id", fileHandler.PatchFile)
+		api.GET("/files/:id/download", fileHandler.DownloadFile)
+		api.GET("/files/:id/thumbnail", fileHandler.GetThumbnail)
+		api.GET("/files/:id/transcript", fileHandler.GetTranscript)
+		api.GET("/files/:id/pii", fileHandler.GetPIIReport)
+		api.GET("/files/:id/redacted", fileHandler.GetRedacted)
+		api.POST("/files/:id/restore", fileHandler.RestoreFile)
+		api.PUT("/files/:id/content", fileHandler.UpdateContent)
+		api.GET("/files/:id/versions", fileHandler.ListVersions)
+		api.GET("/files/:id/versions/:version/download", fileHandler.DownloadVersion)
+		api.POST("/files/:id/versions/:version/restore", fileHandler.RestoreVersion)
+		api.GET("/files/:id/translations", fileHandler.ListTranslations)
+		api.GET("/files/:id/translations/:lang", fileHandler.GetTranslation)
+
+		api.GET("/analysis-cache/stats", fileHandler.AnalysisCacheStats)
+
+		api.GET("/trash", fileHandler.ListTrash)
+		api.DELETE("/trash/:id", fileHandler.PurgeFile)
+
+		api.POST("/folders", folderHandler.CreateFolder)
+		api.GET("/folders", folderHandler.FindFolder)
+		api.GET("/folders/:id", folderHandler.GetFolder)
+		api.GET("/folders/:id/contents", folderHandler.ListContents)
+		api.PATCH("/folders/:id", folderHandler.UpdateFolder)
+		api.DELETE("/folders/:id", folderHandler.DeleteFolder)
+		api.POST("/folders/:id/files", folderHandler.MoveFile)
+
+		api.POST("/prompts", promptHandler.CreateTemplate)
+		api.GET("/prompts", promptHandler.ListTemplates)
+		api.GET("/prompts/:name", promptHandler.GetTemplate)
+		api.GET("/prompts/:name/versions", promptHandler.ListVersions)
+		api.PUT("/prompts/:name", promptHandler.UpdateTemplate)
+		api.DELETE("/prompts/:name", promptHandler.DeleteTemplate)
+
+		api.GET("/usage", usageHandler.GetUsage)
+
+		api.GET("/jobs/:id", jobHandler.GetJob)
+		api.DELETE("/jobs/:id", jobHandler.CancelJob)
 	}
 
 	return e
@@ -0,0 +1,244 @@
+package compressed
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/mamed-gasimov/file-service/internal/storage"
+)
+
+// EncodingZstd is the content encoding recorded for compressed objects.
+const EncodingZstd = "zstd"
+
+// sniffLen is how many bytes are inspected to detect the content type.
+const sniffLen = 512
+
+// ErrEncodingUnavailable is returned by DownloadEncoded when the object
+// cannot be served in the requested encoding.
+var ErrEncodingUnavailable = errors.New("encoding unavailable")
+
+// compile-time checks that Storage satisfies the storage interfaces.
+var (
+	_ storage.Storage           = (*Storage)(nil)
+	_ storage.EncodedDownloader = (*Storage)(nil)
+)
+
+// Storage is a storage.Storage decorator that zstd-compresses objects whose
+// declared or detected MIME type is compressible. The encoding and stored
+// size are recorded in the storage.ObjectInfo carried by the upload context;
+// downloads look the encoding up again and decompress transparently.
+type Storage struct {
+	inner storage.Storage
+	infos storage.InfoStore
+}
+
+// New wraps inner with transparent compression. infos is used to look up
+// the content encoding of an object on download.
+func New(inner storage.Storage, infos storage.InfoStore) *Storage {
+	return &Storage{inner: inner, infos: infos}
+}
+
+// Compressible reports whether content of the MIME type is worth compressing.
+func Compressible(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "+json"),
+		strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+
+	switch mediaType {
+	case "application/json", "application/x-ndjson", "application/xml",
+		"application/javascript", "application/x-yaml", "application/yaml",
+		"application/sql", "application/csv", "application/x-sh",
+		"image/svg+xml", "image/bmp", "application/x-tar":
+		return true
+	}
+	return false
+}
+
+// Upload compresses reader with zstd when the content is compressible and
+// otherwise stores it unchanged.
+func (s *Storage) Upload(ctx context.Context, objectKey string, reader io.Reader, size int64, contentType string) error {
+	br := bufio.NewReaderSize(reader, sniffLen)
+	head, _ := br.Peek(sniffLen)
+	if !Compressible(contentType) && !Compressible(http.DetectContentType(head)) {
+		return s.inner.Upload(ctx, objectKey, br, size, contentType)
+	}
+
+	pr, pw := io.Pipe()
+	counter := &countingWriter{w: pw}
+	go func() {
+		enc, err := zstd.NewWriter(counter, zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		if _, err := io.Copy(enc, br); err != nil {
+			enc.Close()
+			pw.CloseWithError(err)
+			return
+		}
+		pw.CloseWithError(enc.Close())
+	}()
+
+	err := s.inner.Upload(ctx, objectKey, pr, -1, contentType)
+	pr.CloseWithError(err)
+	if err != nil {
+		return err
+	}
+
+	if info := storage.ObjectInfoFrom(ctx); info != nil {
+		info.ContentEncoding = EncodingZstd
+		info.StoredSize = counter.n
+	}
+	return nil
+}
+
+// Download returns the decompressed object content.
+func (s *Storage) Download(ctx context.Context, objectKey string) (io.ReadCloser, error) {
+	return s.DownloadRange(ctx, objectKey, 0, -1)
+}
+
+// DownloadRange returns part of the decompressed content. zstd streams are
+// not seekable, so compressed objects are decoded from the start and the
+// bytes before offset are discarded.
+func (s *Storage) DownloadRange(ctx context.Context, objectKey string, offset, length int64) (io.ReadCloser, error) {
+	encoding, err := s.encoding(ctx, objectKey)
+	if err != nil {
+		return nil, err
+	}
+	if encoding != EncodingZstd {
+		return s.inner.DownloadRange(ctx, objectKey, offset, length)
+	}
+
+	rc, err := s.decoded(ctx, objectKey)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.CopyN(io.Discard, rc, offset); err != nil {
+		rc.Close()
+		return nil, fmt.Errorf("seek in %q: %w", objectKey, err)
+	}
+	if length < 0 {
+		return rc, nil
+	}
+	return readCloser{Reader: io.LimitReader(rc, length), Closer: rc}, nil
+}
+
+// DownloadEncoded returns a compressed object without decompressing it
+// ("zstd") or transcoded on the fly ("gzip"). It returns
+// ErrEncodingUnavailable for objects stored uncompressed.
+func (s *Storage) DownloadEncoded(ctx context.Context, objectKey, encoding string) (io.ReadCloser, error) {
+	stored, err := s.encoding(ctx, objectKey)
+	if err != nil {
+		return nil, err
+	}
+	if stored != EncodingZstd {
+		return nil, fmt.Errorf("object %q is not compressed: %w", objectKey, ErrEncodingUnavailable)
+	}
+
+	switch encoding {
+	case EncodingZstd:
+		return s.inner.Download(ctx, objectKey)
+	case "gzip":
+		rc, err := s.decoded(ctx, objectKey)
+		if err != nil {
+			return nil, err
+		}
+
+		pr, pw := io.Pipe()
+		go func() {
+			defer rc.Close()
+			gz := gzip.NewWriter(pw)
+			if _, err := io.Copy(gz, rc); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			pw.CloseWithError(gz.Close())
+		}()
+		return pr, nil
+	}
+	return nil, fmt.Errorf("encoding %q: %w", encoding, ErrEncodingUnavailable)
+}
+
+// Delete removes the object from the inner storage.
+func (s *Storage) Delete(ctx context.Context, objectKey string) error {
+	return s.inner.Delete(ctx, objectKey)
+}
+
+// Walk lists the objects of the inner storage.
+func (s *Storage) Walk(ctx context.Context, prefix string, fn func(storage.Object) error) error {
+	return s.inner.Walk(ctx, prefix, fn)
+}
+
+// EnsureBucket creates the bucket in the inner storage.
+func (s *Storage) EnsureBucket(ctx context.Context, bucket string) error {
+	return s.inner.EnsureBucket(ctx, bucket)
+}
+
+func (s *Storage) decoded(ctx context.Context, objectKey string) (io.ReadCloser, error) {
+	rc, err := s.inner.Download(ctx, objectKey)
+	if err != nil {
+		return nil, err
+	}
+
+	dec, err := zstd.NewReader(rc, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		rc.Close()
+		return nil, fmt.Errorf("init zstd decoder for %q: %w", objectKey, err)
+	}
+
+	return readCloser{Reader: dec, Closer: closerFunc(func() error {
+		dec.Close()
+		return rc.Close()
+	})}, nil
+}
+
+// encoding prefers the info carried by ctx, which is set while an object is
+// uploaded and processed but not yet persisted.
+func (s *Storage) encoding(ctx context.Context, objectKey string) (string, error) {
+	if info := storage.ObjectInfoFrom(ctx); info != nil && info.ContentEncoding != "" {
+		return info.ContentEncoding, nil
+	}
+
+	info, err := s.infos.ObjectInfo(ctx, objectKey)
+	if err != nil {
+		return "", fmt.Errorf("look up encoding for %q: %w", objectKey, err)
+	}
+	if info == nil {
+		return "", nil
+	}
+	return info.ContentEncoding, nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error { return f() }
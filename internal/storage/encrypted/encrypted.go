@@ -0,0 +1,155 @@
+package encrypted
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+
+	"github.com/mamed-gasimov/file-service/internal/storage"
+)
+
+// compile-time check that Storage satisfies the Storage interface.
+var _ storage.Storage = (*Storage)(nil)
+
+// Storage is a storage.Storage decorator that encrypts objects client-side
+// before they reach the inner storage. Every object gets its own random data
+// key, which is wrapped by the keyring's master key and handed back to the
+// caller through the storage.ObjectInfo in the upload context. Objects
+// without a recorded data key are read as plaintext, so existing objects stay
+// readable after encryption is enabled.
+type Storage struct {
+	inner   storage.Storage
+	keyring *Keyring
+	infos   storage.InfoStore
+}
+
+// New wraps inner with client-side encryption. infos is used to look up the
+// wrapped data key of an object on download.
+func New(inner storage.Storage, keyring *Keyring, infos storage.InfoStore) *Storage {
+	return &Storage{inner: inner, keyring: keyring, infos: infos}
+}
+
+// Upload encrypts reader with a fresh data key and records the wrapped key
+// in the storage.ObjectInfo carried by ctx, which is required.
+func (s *Storage) Upload(ctx context.Context, objectKey string, reader io.Reader, size int64, contentType string) error {
+	info := storage.ObjectInfoFrom(ctx)
+	if info == nil {
+		return fmt.Errorf("encrypt %q: upload context carries no object info to record the data key", objectKey)
+	}
+
+	dataKey := make([]byte, KeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return fmt.Errorf("generate data key: %w", err)
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return fmt.Errorf("init data key cipher: %w", err)
+	}
+
+	wrapped, keyID, err := s.keyring.Wrap(dataKey)
+	if err != nil {
+		return fmt.Errorf("wrap data key: %w", err)
+	}
+
+	if err := s.inner.Upload(ctx, objectKey, newEncryptReader(reader, aead), encryptedSize(size), contentType); err != nil {
+		return err
+	}
+
+	info.WrappedKey, info.KeyID = wrapped, keyID
+	return nil
+}
+
+// Download returns the decrypted object content.
+func (s *Storage) Download(ctx context.Context, objectKey string) (io.ReadCloser, error) {
+	return s.DownloadRange(ctx, objectKey, 0, -1)
+}
+
+// DownloadRange decrypts only the chunks covering the requested plaintext range.
+func (s *Storage) DownloadRange(ctx context.Context, objectKey string, offset, length int64) (io.ReadCloser, error) {
+	info, err := s.objectInfo(ctx, objectKey)
+	if err != nil {
+		return nil, err
+	}
+	if info == nil || info.WrappedKey == nil {
+		return s.inner.DownloadRange(ctx, objectKey, offset, length)
+	}
+
+	dataKey, err := s.keyring.Unwrap(info.WrappedKey, info.KeyID)
+	if err != nil {
+		return nil, fmt.Errorf("object %q: %w", objectKey, err)
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("init data key cipher: %w", err)
+	}
+
+	if offset == 0 && length < 0 {
+		rc, err := s.inner.Download(ctx, objectKey)
+		if err != nil {
+			return nil, err
+		}
+		if err := readHeader(rc); err != nil {
+			rc.Close()
+			return nil, fmt.Errorf("object %q: %w", objectKey, err)
+		}
+		return newDecryptReader(rc, aead, 0, true), nil
+	}
+
+	first := offset / chunkSize
+	start := int64(len(header)) + first*sealedChunk
+	sealedLen := int64(-1)
+	if length >= 0 {
+		last := (offset + max(length, 1) - 1) / chunkSize
+		sealedLen = (last - first + 1) * sealedChunk
+	}
+
+	rc, err := s.inner.DownloadRange(ctx, objectKey, start, sealedLen)
+	if err != nil {
+		return nil, err
+	}
+
+	dr := newDecryptReader(rc, aead, uint64(first), length < 0)
+	if _, err := io.CopyN(io.Discard, dr, offset-first*chunkSize); err != nil {
+		dr.Close()
+		return nil, fmt.Errorf("seek in %q: %w", objectKey, err)
+	}
+	if length < 0 {
+		return dr, nil
+	}
+	return limitedReadCloser{Reader: io.LimitReader(dr, length), Closer: dr}, nil
+}
+
+// Delete removes the object from the inner storage.
+func (s *Storage) Delete(ctx context.Context, objectKey string) error {
+	return s.inner.Delete(ctx, objectKey)
+}
+
+// Walk lists the objects of the inner storage.
+func (s *Storage) Walk(ctx context.Context, prefix string, fn func(storage.Object) error) error {
+	return s.inner.Walk(ctx, prefix, fn)
+}
+
+// EnsureBucket creates the bucket in the inner storage.
+func (s *Storage) EnsureBucket(ctx context.Context, bucket string) error {
+	return s.inner.EnsureBucket(ctx, bucket)
+}
+
+// objectInfo prefers the info carried by ctx, which is set while an object
+// is uploaded and processed but not yet persisted.
+func (s *Storage) objectInfo(ctx context.Context, objectKey string) (*storage.ObjectInfo, error) {
+	if info := storage.ObjectInfoFrom(ctx); info != nil && info.WrappedKey != nil {
+		return info, nil
+	}
+
+	info, err := s.infos.ObjectInfo(ctx, objectKey)
+	if err != nil {
+		return nil, fmt.Errorf("look up data key for %q: %w", objectKey, err)
+	}
+	return info, nil
+}
+
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,362 @@
+package encrypted
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/mamed-gasimov/file-service/internal/storage"
+)
+
+// memStorage is an in-memory storage.Storage.
+type memStorage struct {
+	objects map[string][]byte
+}
+
+func (m *memStorage) Upload(_ context.Context, objectKey string, reader io.Reader, size int64, _ string) error {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	if size >= 0 && int64(len(data)) != size {
+		return errors.New("size mismatch")
+	}
+	m.objects[objectKey] = data
+	return nil
+}
+
+func (m *memStorage) Download(ctx context.Context, objectKey string) (io.ReadCloser, error) {
+	return m.DownloadRange(ctx, objectKey, 0, -1)
+}
+
+func (m *memStorage) DownloadRange(_ context.Context, objectKey string, offset, length int64) (io.ReadCloser, error) {
+	data, ok := m.objects[objectKey]
+	if !ok {
+		return nil, errors.New("no such object")
+	}
+	data = data[min(offset, int64(len(data))):]
+	if length >= 0 {
+		data = data[:min(length, int64(len(data)))]
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (m *memStorage) Delete(_ context.Context, objectKey string) error {
+	delete(m.objects, objectKey)
+	return nil
+}
+
+func (m *memStorage) Walk(_ context.Context, _ string, _ func(storage.Object) error) error {
+	return nil
+}
+
+func (m *memStorage) EnsureBucket(_ context.Context, _ string) error {
+	return nil
+}
+
+// memInfos is an in-memory storage.InfoStore and KeyStore.
+type memInfos map[string]storage.ObjectInfo
+
+func (m memInfos) ObjectInfo(_ context.Context, objectKey string) (*storage.ObjectInfo, error) {
+	info, ok := m[objectKey]
+	if !ok {
+		return nil, nil
+	}
+	return &info, nil
+}
+
+func (m memInfos) StaleKeys(_ context.Context, keyID string, limit int) (map[string]storage.ObjectInfo, error) {
+	stale := map[string]storage.ObjectInfo{}
+	for k, info := range m {
+		if info.WrappedKey != nil && info.KeyID != keyID && len(stale) < limit {
+			stale[k] = info
+		}
+	}
+	return stale, nil
+}
+
+func (m memInfos) UpdateKey(_ context.Context, objectKey string, info storage.ObjectInfo) error {
+	m[objectKey] = info
+	return nil
+}
+
+func randomBytes(t *testing.T, n int) []byte {
+	t.Helper()
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func newTestKeyring(t *testing.T, id string, key []byte, previous map[string][]byte) *Keyring {
+	t.Helper()
+	kr, err := NewKeyring(id, key, previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kr
+}
+
+// upload encrypts data into a fresh store and records its object info.
+func upload(t *testing.T, kr *Keyring, data []byte) (*Storage, *memStorage, memInfos) {
+	t.Helper()
+	inner := &memStorage{objects: map[string][]byte{}}
+	infos := memInfos{}
+	s := New(inner, kr, infos)
+
+	info := &storage.ObjectInfo{}
+	if err := s.Upload(storage.WithObjectInfo(context.Background(), info), "obj", bytes.NewReader(data), int64(len(data)), "application/octet-stream"); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	infos["obj"] = *info
+	return s, inner, infos
+}
+
+func readAll(s *Storage, offset, length int64) ([]byte, error) {
+	rc, err := s.DownloadRange(context.Background(), "obj", offset, length)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+func TestRoundTrip(t *testing.T) {
+	kr := newTestKeyring(t, "k1", randomBytes(t, KeySize), nil)
+
+	for _, size := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 2 * chunkSize, 3*chunkSize + 17} {
+		data := randomBytes(t, size)
+		s, inner, infos := upload(t, kr, data)
+
+		stored := inner.objects["obj"]
+		if int64(len(stored)) != encryptedSize(int64(size)) {
+			t.Errorf("size %d: stored %d bytes, want %d", size, len(stored), encryptedSize(int64(size)))
+		}
+		if !bytes.HasPrefix(stored, header) {
+			t.Errorf("size %d: stored object does not start with the header", size)
+		}
+		if size > 0 && bytes.Contains(stored, data) {
+			t.Errorf("size %d: plaintext found in the stored object", size)
+		}
+		if infos["obj"].KeyID != "k1" || infos["obj"].WrappedKey == nil {
+			t.Errorf("size %d: object info %+v, want a data key wrapped by k1", size, infos["obj"])
+		}
+
+		got, err := readAll(s, 0, -1)
+		if err != nil {
+			t.Fatalf("size %d: download: %v", size, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("size %d: downloaded content differs", size)
+		}
+	}
+}
+
+func TestDownloadRange(t *testing.T) {
+	kr := newTestKeyring(t, "k1", randomBytes(t, KeySize), nil)
+	data := randomBytes(t, 3*chunkSize+17)
+	s, _, _ := upload(t, kr, data)
+
+	tests := []struct {
+		offset, length int64
+	}{
+		{0, 10},
+		{5, 100},
+		{chunkSize - 3, 6},
+		{chunkSize, chunkSize},
+		{chunkSize + 1, 2 * chunkSize},
+		{3 * chunkSize, 17},
+		{3*chunkSize + 16, 1},
+		{10, 0},
+		{2*chunkSize + 5, -1},
+		{0, -1},
+	}
+	for _, tt := range tests {
+		got, err := readAll(s, tt.offset, tt.length)
+		if err != nil {
+			t.Fatalf("range %d+%d: %v", tt.offset, tt.length, err)
+		}
+		want := data[tt.offset:]
+		if tt.length >= 0 {
+			want = want[:tt.length]
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("range %d+%d: got %d bytes, want %d", tt.offset, tt.length, len(got), len(want))
+		}
+	}
+}
+
+func TestTruncation(t *testing.T) {
+	kr := newTestKeyring(t, "k1", randomBytes(t, KeySize), nil)
+
+	tests := []struct {
+		name string
+		size int
+		keep int // bytes of the stored object kept
+	}{
+		{"final chunk dropped at a chunk boundary", 2 * chunkSize, len(header) + sealedChunk},
+		{"partial final chunk dropped", chunkSize + 100, len(header) + sealedChunk},
+		{"cut inside a chunk", 2 * chunkSize, len(header) + sealedChunk + 1000},
+		{"cut inside the only chunk", 100, len(header) + 50},
+		{"only the header left", 100, len(header)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, inner, _ := upload(t, kr, randomBytes(t, tt.size))
+			inner.objects["obj"] = inner.objects["obj"][:tt.keep]
+
+			if _, err := readAll(s, 0, -1); err == nil {
+				t.Error("download of a truncated object succeeded")
+			}
+		})
+	}
+}
+
+func TestReordering(t *testing.T) {
+	kr := newTestKeyring(t, "k1", randomBytes(t, KeySize), nil)
+	s, inner, _ := upload(t, kr, randomBytes(t, 3*chunkSize))
+
+	stored := inner.objects["obj"]
+	chunk := func(i int) []byte {
+		start := len(header) + i*sealedChunk
+		return stored[start : start+sealedChunk]
+	}
+
+	swapped := append([]byte{}, header...)
+	swapped = append(swapped, chunk(1)...)
+	swapped = append(swapped, chunk(0)...)
+	swapped = append(swapped, chunk(2)...)
+	inner.objects["obj"] = swapped
+
+	if _, err := readAll(s, 0, -1); err == nil {
+		t.Error("download of reordered chunks succeeded")
+	}
+	if _, err := readAll(s, chunkSize, 10); err == nil {
+		t.Error("range read of a moved chunk succeeded")
+	}
+
+	// A final chunk moved to the end of a shorter object is not accepted
+	// in place of the chunk that belongs there.
+	inner.objects["obj"] = append(append(append([]byte{}, header...), chunk(0)...), chunk(2)...)
+	if _, err := readAll(s, 0, -1); err == nil {
+		t.Error("download with a chunk dropped from the middle succeeded")
+	}
+}
+
+func TestTamperedChunk(t *testing.T) {
+	kr := newTestKeyring(t, "k1", randomBytes(t, KeySize), nil)
+	s, inner, _ := upload(t, kr, randomBytes(t, chunkSize+10))
+
+	inner.objects["obj"][len(header)+sealedChunk+3] ^= 1
+	if _, err := readAll(s, 0, -1); err == nil {
+		t.Error("download of a tampered object succeeded")
+	}
+}
+
+func TestWrongKey(t *testing.T) {
+	kr := newTestKeyring(t, "k1", randomBytes(t, KeySize), nil)
+	_, inner, infos := upload(t, kr, []byte("secret content"))
+
+	tests := []struct {
+		name    string
+		keyring *Keyring
+	}{
+		{"different master key, same id", newTestKeyring(t, "k1", randomBytes(t, KeySize), nil)},
+		{"unknown master key id", newTestKeyring(t, "k2", randomBytes(t, KeySize), nil)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(inner, tt.keyring, infos)
+			if _, err := readAll(s, 0, -1); err == nil {
+				t.Error("download succeeded")
+			}
+		})
+	}
+
+	// The key ID is bound to the wrapped key: relabeling it fails.
+	other := randomBytes(t, KeySize)
+	both := newTestKeyring(t, "k1", randomBytes(t, KeySize), map[string][]byte{"k2": other})
+	if _, err := both.Unwrap(infos["obj"].WrappedKey, "k2"); err == nil {
+		t.Error("unwrap under another key id succeeded")
+	}
+}
+
+func TestPlaintextObject(t *testing.T) {
+	kr := newTestKeyring(t, "k1", randomBytes(t, KeySize), nil)
+	inner := &memStorage{objects: map[string][]byte{"obj": []byte("stored before encryption")}}
+	s := New(inner, kr, memInfos{})
+
+	got, err := readAll(s, 7, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "before" {
+		t.Errorf("got %q, want %q", got, "before")
+	}
+}
+
+func TestUploadRequiresObjectInfo(t *testing.T) {
+	kr := newTestKeyring(t, "k1", randomBytes(t, KeySize), nil)
+	s := New(&memStorage{objects: map[string][]byte{}}, kr, memInfos{})
+
+	if err := s.Upload(context.Background(), "obj", strings.NewReader("x"), 1, "text/plain"); err == nil {
+		t.Error("upload without object info succeeded")
+	}
+}
+
+func TestRotate(t *testing.T) {
+	k1, k2 := randomBytes(t, KeySize), randomBytes(t, KeySize)
+	data := randomBytes(t, chunkSize+5)
+	_, inner, infos := upload(t, newTestKeyring(t, "k1", k1, nil), data)
+	stored := append([]byte{}, inner.objects["obj"]...)
+
+	rotating := newTestKeyring(t, "k2", k2, map[string][]byte{"k1": k1})
+	n, err := Rotate(context.Background(), infos, rotating)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 || infos["obj"].KeyID != "k2" {
+		t.Fatalf("rotated %d keys, object key id %q; want 1 and k2", n, infos["obj"].KeyID)
+	}
+	if !bytes.Equal(inner.objects["obj"], stored) {
+		t.Error("rotation changed the stored object")
+	}
+
+	// The retired key is no longer needed.
+	s := New(inner, newTestKeyring(t, "k2", k2, nil), infos)
+	got, err := readAll(s, 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("content differs after rotation")
+	}
+
+	if n, err := Rotate(context.Background(), infos, rotating); err != nil || n != 0 {
+		t.Errorf("second rotation: %d keys, %v; want 0 and no error", n, err)
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	keys, err := ParseKeys(" old:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA= , ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys["old"]) != KeySize {
+		t.Errorf("key %q is %d bytes, want %d", "old", len(keys["old"]), KeySize)
+	}
+
+	for _, spec := range []string{"nokey", ":AAAA", "id:not base64!"} {
+		if _, err := ParseKeys(spec); err == nil {
+			t.Errorf("ParseKeys(%q) succeeded", spec)
+		}
+	}
+	if _, err := NewKeyring("k1", []byte("short"), nil); err == nil {
+		t.Error("NewKeyring with a short key succeeded")
+	}
+}
@@ -0,0 +1,198 @@
+package encrypted
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Objects are stored as a fixed header followed by the plaintext split into
+// chunks of chunkSize bytes, each sealed with AES-256-GCM under the object's
+// data key. The nonce is the chunk index, so each chunk can be decrypted on
+// its own, which is what makes range reads possible. The additional data
+// marks the final chunk, so truncating an object at a chunk boundary is
+// detected.
+const (
+	chunkSize   = 64 << 10
+	tagSize     = 16
+	sealedChunk = chunkSize + tagSize
+)
+
+var header = []byte("FSE1")
+
+var errTruncated = errors.New("encrypted object is truncated")
+
+// encryptedSize returns the stored size of a plaintext of size bytes, or -1
+// if the plaintext size is unknown.
+func encryptedSize(size int64) int64 {
+	if size < 0 {
+		return -1
+	}
+	chunks := max(1, (size+chunkSize-1)/chunkSize)
+	return int64(len(header)) + size + chunks*tagSize
+}
+
+func chunkNonce(aead cipher.AEAD, index uint64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], index)
+	return nonce
+}
+
+func chunkAD(final bool) []byte {
+	if final {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// encryptReader encrypts src lazily as it is read.
+type encryptReader struct {
+	src    *bufio.Reader
+	aead   cipher.AEAD
+	plain  []byte
+	sealed []byte
+	out    []byte
+	index  uint64
+	done   bool
+}
+
+func newEncryptReader(src io.Reader, aead cipher.AEAD) *encryptReader {
+	return &encryptReader{
+		src:    bufio.NewReaderSize(src, chunkSize),
+		aead:   aead,
+		plain:  make([]byte, chunkSize),
+		sealed: make([]byte, 0, sealedChunk),
+		out:    append([]byte{}, header...),
+	}
+}
+
+func (r *encryptReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.sealNext(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+func (r *encryptReader) sealNext() error {
+	n, err := io.ReadFull(r.src, r.plain)
+	final := false
+	switch {
+	case errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF):
+		final = true
+	case err != nil:
+		return err
+	default:
+		if _, err := r.src.Peek(1); errors.Is(err, io.EOF) {
+			final = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	r.out = r.aead.Seal(r.sealed[:0], chunkNonce(r.aead, r.index), r.plain[:n], chunkAD(final))
+	r.index++
+	r.done = final
+	return nil
+}
+
+// decryptReader decrypts chunks read from src, which must be positioned at
+// the start of chunk index. When requireFinal is set, reaching the end of
+// src before the final chunk is reported as truncation.
+type decryptReader struct {
+	src          io.ReadCloser
+	aead         cipher.AEAD
+	sealed       []byte
+	buf          []byte
+	plain        []byte
+	index        uint64
+	done         bool
+	requireFinal bool
+}
+
+func newDecryptReader(src io.ReadCloser, aead cipher.AEAD, index uint64, requireFinal bool) *decryptReader {
+	return &decryptReader{
+		src:          src,
+		aead:         aead,
+		sealed:       make([]byte, sealedChunk),
+		buf:          make([]byte, 0, chunkSize),
+		index:        index,
+		requireFinal: requireFinal,
+	}
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.openNext(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+	return n, nil
+}
+
+func (r *decryptReader) openNext() error {
+	n, err := io.ReadFull(r.src, r.sealed)
+	switch {
+	case errors.Is(err, io.EOF):
+		if r.requireFinal {
+			return errTruncated
+		}
+		r.done = true
+		return nil
+	case errors.Is(err, io.ErrUnexpectedEOF):
+	case err != nil:
+		return err
+	}
+
+	nonce := chunkNonce(r.aead, r.index)
+	plain, openErr := r.aead.Open(r.buf[:0], nonce, r.sealed[:n], chunkAD(false))
+	final := false
+	if openErr != nil {
+		plain, openErr = r.aead.Open(r.buf[:0], nonce, r.sealed[:n], chunkAD(true))
+		final = true
+	}
+	if openErr != nil {
+		return fmt.Errorf("decrypt chunk %d: %w", r.index, openErr)
+	}
+	if !final && n < sealedChunk && r.requireFinal {
+		return errTruncated
+	}
+
+	r.plain = plain
+	r.index++
+	r.done = final
+	return nil
+}
+
+func (r *decryptReader) Close() error {
+	return r.src.Close()
+}
+
+// readHeader consumes and verifies the object header.
+func readHeader(src io.Reader) error {
+	got := make([]byte, len(header))
+	if _, err := io.ReadFull(src, got); err != nil {
+		return fmt.Errorf("read header: %w", err)
+	}
+	if !bytes.Equal(got, header) {
+		return fmt.Errorf("not an encrypted object")
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package encrypted
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// KeySize is the size in bytes of master keys and data keys (AES-256).
+const KeySize = 32
+
+// Keyring holds the master keys used to wrap per-object data keys. New data
+// keys are always wrapped with the current key; previous keys are kept so
+// existing data keys can still be unwrapped until they are rotated.
+type Keyring struct {
+	currentID string
+	keys      map[string]cipher.AEAD
+}
+
+// NewKeyring creates a keyring whose current master key is current, identified
+// by currentID. previous maps retired key IDs to their keys.
+func NewKeyring(currentID string, current []byte, previous map[string][]byte) (*Keyring, error) {
+	if currentID == "" {
+		return nil, fmt.Errorf("master key id is required")
+	}
+
+	kr := &Keyring{currentID: currentID, keys: map[string]cipher.AEAD{}}
+	if err := kr.add(currentID, current); err != nil {
+		return nil, err
+	}
+	for id, key := range previous {
+		if id == currentID {
+			continue
+		}
+		if err := kr.add(id, key); err != nil {
+			return nil, err
+		}
+	}
+	return kr, nil
+}
+
+func (kr *Keyring) add(id string, key []byte) error {
+	if len(key) != KeySize {
+		return fmt.Errorf("master key %q must be %d bytes, got %d", id, KeySize, len(key))
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return fmt.Errorf("master key %q: %w", id, err)
+	}
+	kr.keys[id] = aead
+	return nil
+}
+
+// CurrentID returns the ID of the master key used for wrapping.
+func (kr *Keyring) CurrentID() string {
+	return kr.currentID
+}
+
+// Wrap encrypts a data key with the current master key. The key ID is bound
+// to the ciphertext as additional data.
+func (kr *Keyring) Wrap(dataKey []byte) (wrapped []byte, keyID string, err error) {
+	aead := kr.keys[kr.currentID]
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, "", fmt.Errorf("generate nonce: %w", err)
+	}
+
+	return aead.Seal(nonce, nonce, dataKey, []byte(kr.currentID)), kr.currentID, nil
+}
+
+// Unwrap decrypts a data key wrapped with the master key identified by keyID.
+func (kr *Keyring) Unwrap(wrapped []byte, keyID string) ([]byte, error) {
+	aead, ok := kr.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown master key %q", keyID)
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, fmt.Errorf("wrapped key too short")
+	}
+
+	nonce, ciphertext := wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():]
+	dataKey, err := aead.Open(nil, nonce, ciphertext, []byte(keyID))
+	if err != nil {
+		return nil, fmt.Errorf("unwrap data key: %w", err)
+	}
+	return dataKey, nil
+}
+
+// ParseKey decodes a base64-encoded master key.
+func ParseKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("decode master key: %w", err)
+	}
+	return key, nil
+}
+
+// ParseKeys decodes a comma-separated list of "id:base64key" pairs.
+func ParseKeys(spec string) (map[string][]byte, error) {
+	keys := map[string][]byte{}
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(pair, ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("invalid key entry: want id:base64key")
+		}
+		key, err := ParseKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", id, err)
+		}
+		keys[id] = key
+	}
+	return keys, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
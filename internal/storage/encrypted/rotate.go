@@ -0,0 +1,52 @@
+package encrypted
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mamed-gasimov/file-service/internal/storage"
+)
+
+const rotateBatchSize = 500
+
+// KeyStore persists wrapped data keys and supports re-wrapping them.
+type KeyStore interface {
+	// StaleKeys returns up to limit objects, keyed by object key, whose data
+	// key is wrapped by a master key other than keyID.
+	StaleKeys(ctx context.Context, keyID string, limit int) (map[string]storage.ObjectInfo, error)
+	// UpdateKey replaces the wrapped data key of an object.
+	UpdateKey(ctx context.Context, objectKey string, info storage.ObjectInfo) error
+}
+
+// Rotate re-wraps every data key that is not wrapped by the keyring's current
+// master key. Object content is not touched: only the small wrapped keys
+// change. It returns the number of keys re-wrapped.
+func Rotate(ctx context.Context, store KeyStore, keyring *Keyring) (int, error) {
+	rotated := 0
+	for {
+		stale, err := store.StaleKeys(ctx, keyring.CurrentID(), rotateBatchSize)
+		if err != nil {
+			return rotated, fmt.Errorf("list stale keys: %w", err)
+		}
+		if len(stale) == 0 {
+			return rotated, nil
+		}
+
+		for objectKey, info := range stale {
+			dataKey, err := keyring.Unwrap(info.WrappedKey, info.KeyID)
+			if err != nil {
+				return rotated, fmt.Errorf("object %q: %w", objectKey, err)
+			}
+
+			wrapped, keyID, err := keyring.Wrap(dataKey)
+			if err != nil {
+				return rotated, fmt.Errorf("object %q: %w", objectKey, err)
+			}
+
+			if err := store.UpdateKey(ctx, objectKey, storage.ObjectInfo{WrappedKey: wrapped, KeyID: keyID}); err != nil {
+				return rotated, fmt.Errorf("object %q: %w", objectKey, err)
+			}
+			rotated++
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"strings"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
@@ -52,12 +53,21 @@ func (c *Client) EnsureBucket(ctx context.Context, bucket string) error {
 	return nil
 }
 
+// unknownSizePartSize is the part size of uploads of unknown length. Left
+// to itself, minio-go picks the largest part size for them, about 537 MiB,
+// and buffers a whole part in memory per upload; 16 MiB parts still allow
+// objects of up to about 156 GiB.
+const unknownSizePartSize = 16 << 20
+
 // Upload streams data from reader directly into MinIO (no buffering to disk).
 // Pass size = -1 if content length is unknown.
 func (c *Client) Upload(ctx context.Context, objectKey string, reader io.Reader, size int64, contentType string) error {
 	opts := minio.PutObjectOptions{
 		ContentType: contentType,
 	}
+	if size < 0 {
+		opts.PartSize = unknownSizePartSize
+	}
 
 	_, err := c.client.PutObject(ctx, c.bucket, objectKey, reader, size, opts)
 	if err != nil {
@@ -75,6 +85,32 @@ func (c *Client) Download(ctx context.Context, objectKey string) (io.ReadCloser,
 	return obj, nil
 }
 
+// DownloadRange returns a ReadCloser streaming length bytes of the object
+// starting at offset. A length of -1 reads to the end of the object.
+func (c *Client) DownloadRange(ctx context.Context, objectKey string, offset, length int64) (io.ReadCloser, error) {
+	opts := minio.GetObjectOptions{}
+	switch {
+	case length > 0:
+		err := opts.SetRange(offset, offset+length-1)
+		if err != nil {
+			return nil, fmt.Errorf("set range for %q: %w", objectKey, err)
+		}
+	case length == 0:
+		return io.NopCloser(strings.NewReader("")), nil
+	case offset > 0:
+		err := opts.SetRange(offset, 0)
+		if err != nil {
+			return nil, fmt.Errorf("set range for %q: %w", objectKey, err)
+		}
+	}
+
+	obj, err := c.client.GetObject(ctx, c.bucket, objectKey, opts)
+	if err != nil {
+		return nil, fmt.Errorf("get object %q: %w", objectKey, err)
+	}
+	return obj, nil
+}
+
 // Delete removes an object from the bucket by key.
 func (c *Client) Delete(ctx context.Context, objectKey string) error {
 	err := c.client.RemoveObject(ctx, c.bucket, objectKey, minio.RemoveObjectOptions{})
@@ -84,6 +120,22 @@ func (c *Client) Delete(ctx context.Context, objectKey string) error {
 	return nil
 }
 
+// Walk lists the objects under prefix recursively and calls fn for each.
+func (c *Client) Walk(ctx context.Context, prefix string, fn func(storage.Object) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for obj := range c.client.ListObjects(ctx, c.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return fmt.Errorf("list objects: %w", obj.Err)
+		}
+		if err := fn(storage.Object{Key: obj.Key, Size: obj.Size, LastModified: obj.LastModified}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Bucket returns the configured bucket name.
 func (c *Client) Bucket() string {
 	return c.bucket
@@ -3,6 +3,7 @@ package storage
 import (
 	"context"
 	"io"
+	"time"
 )
 
 // Storage defines an abstraction over object-storage backends (S3 / MinIO / etc.).
@@ -15,9 +16,68 @@ type Storage interface {
 	// Download returns a ReadCloser for the object content. The caller must close it.
 	Download(ctx context.Context, objectKey string) (io.ReadCloser, error)
 
-	// Delete removes the object by key.
+	// DownloadRange returns a ReadCloser for length bytes of the object content
+	// starting at offset. A length of -1 reads to the end. The caller must close it.
+	DownloadRange(ctx context.Context, objectKey string, offset, length int64) (io.ReadCloser, error)
+
+	// Delete removes the object by key. Deleting a missing object is not an error.
 	Delete(ctx context.Context, objectKey string) error
 
+	// Walk calls fn for every object whose key starts with prefix, stopping
+	// at the first error fn returns.
+	Walk(ctx context.Context, prefix string, fn func(Object) error) error
+
 	// EnsureBucket creates the bucket if it does not exist.
 	EnsureBucket(ctx context.Context, bucket string) error
 }
+
+// Object describes a stored object as listed by Walk.
+type Object struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// ObjectInfo describes how an object is encoded at rest. Storage decorators
+// fill it in on upload so the caller can persist it alongside the object
+// metadata, and consult it again on download.
+type ObjectInfo struct {
+	// WrappedKey is the object's data key encrypted with the master key
+	// identified by KeyID. It is nil for objects stored in plaintext.
+	WrappedKey []byte
+	KeyID      string
+
+	// ContentEncoding is the encoding applied to the content before it was
+	// stored (e.g. "zstd"), empty if stored as is. StoredSize is the size of
+	// the encoded content.
+	ContentEncoding string
+	StoredSize      int64
+}
+
+// InfoStore looks up the ObjectInfo persisted for an object. It returns nil
+// and no error for objects it has no record of.
+type InfoStore interface {
+	ObjectInfo(ctx context.Context, objectKey string) (*ObjectInfo, error)
+}
+
+// EncodedDownloader is implemented by storages that can return an object in
+// a content encoding such as "zstd" or "gzip" instead of decoding it, so it
+// can be sent to HTTP clients that accept that encoding.
+type EncodedDownloader interface {
+	DownloadEncoded(ctx context.Context, objectKey, encoding string) (io.ReadCloser, error)
+}
+
+type objectInfoKey struct{}
+
+// WithObjectInfo returns a context carrying info. Decorators record what
+// they did to an uploaded object into it, and prefer it over their
+// InfoStore when reading an object back before its metadata is persisted.
+func WithObjectInfo(ctx context.Context, info *ObjectInfo) context.Context {
+	return context.WithValue(ctx, objectInfoKey{}, info)
+}
+
+// ObjectInfoFrom returns the ObjectInfo carried by ctx, or nil.
+func ObjectInfoFrom(ctx context.Context) *ObjectInfo {
+	info, _ := ctx.Value(objectInfoKey{}).(*ObjectInfo)
+	return info
+}
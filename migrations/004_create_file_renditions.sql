@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE file_renditions (
+    id         BIGSERIAL    PRIMARY KEY,
+    file_id    BIGINT       NOT NULL REFERENCES files (id) ON DELETE CASCADE,
+    kind       TEXT         NOT NULL,
+    size       INTEGER      NOT NULL DEFAULT 0,
+    width      INTEGER      NOT NULL DEFAULT 0,
+    height     INTEGER      NOT NULL DEFAULT 0,
+    mime_type  TEXT         NOT NULL,
+    byte_size  BIGINT       NOT NULL DEFAULT 0,
+    object_key TEXT         NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ  NOT NULL DEFAULT now(),
+    UNIQUE (file_id, kind, size)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS file_renditions;
+-- +goose StatementEnd
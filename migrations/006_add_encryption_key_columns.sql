@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE files ADD COLUMN wrapped_key BYTEA, ADD COLUMN key_id TEXT;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE file_renditions ADD COLUMN wrapped_key BYTEA, ADD COLUMN key_id TEXT;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE file_renditions DROP COLUMN IF EXISTS wrapped_key, DROP COLUMN IF EXISTS key_id;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE files DROP COLUMN IF EXISTS wrapped_key, DROP COLUMN IF EXISTS key_id;
+-- +goose StatementEnd
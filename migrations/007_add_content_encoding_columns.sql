@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE files ADD COLUMN content_encoding TEXT, ADD COLUMN stored_size BIGINT;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+UPDATE files SET stored_size = size;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE files ALTER COLUMN stored_size SET NOT NULL, ALTER COLUMN stored_size SET DEFAULT 0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE files DROP COLUMN IF EXISTS content_encoding, DROP COLUMN IF EXISTS stored_size;
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE files ADD COLUMN status TEXT NOT NULL DEFAULT 'active'
+    CHECK (status IN ('active', 'deleting'));
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX idx_files_deleting ON files (updated_at) WHERE status = 'deleting';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_files_deleting;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE files DROP COLUMN IF EXISTS status;
+-- +goose StatementEnd
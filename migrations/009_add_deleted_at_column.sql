@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE files ADD COLUMN deleted_at TIMESTAMPTZ;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX idx_files_deleted_at ON files (deleted_at) WHERE deleted_at IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_files_deleted_at;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE files DROP COLUMN IF EXISTS deleted_at;
+-- +goose StatementEnd
@@ -0,0 +1,42 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE files ADD COLUMN version INTEGER NOT NULL DEFAULT 1, ADD COLUMN content_hash TEXT;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TABLE file_versions (
+    id                  BIGSERIAL    PRIMARY KEY,
+    file_id             BIGINT       NOT NULL REFERENCES files (id) ON DELETE CASCADE,
+    version             INTEGER      NOT NULL,
+    size                BIGINT       NOT NULL DEFAULT 0,
+    mime_type           TEXT         NOT NULL DEFAULT 'application/octet-stream',
+    object_key          TEXT         NOT NULL UNIQUE,
+    content_hash        TEXT,
+    properties          JSONB,
+    resume              TEXT,
+    translation_summary TEXT,
+    wrapped_key         BYTEA,
+    key_id              TEXT,
+    content_encoding    TEXT,
+    stored_size         BIGINT       NOT NULL DEFAULT 0,
+    created_at          TIMESTAMPTZ  NOT NULL DEFAULT now(),
+    UNIQUE (file_id, version)
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+INSERT INTO file_versions (file_id, version, size, mime_type, object_key, properties, resume, translation_summary,
+                           wrapped_key, key_id, content_encoding, stored_size, created_at)
+SELECT id, version, size, mime_type, object_key, properties, resume, translation_summary,
+       wrapped_key, key_id, content_encoding, stored_size, created_at
+FROM files;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS file_versions;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE files DROP COLUMN IF EXISTS version, DROP COLUMN IF EXISTS content_hash;
+-- +goose StatementEnd
@@ -0,0 +1,32 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE folders (
+    id         BIGSERIAL    PRIMARY KEY,
+    parent_id  BIGINT       REFERENCES folders (id) ON DELETE CASCADE,
+    name       TEXT         NOT NULL CHECK (name <> '' AND position('/' IN name) = 0),
+    path       TEXT         NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ  NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ  NOT NULL DEFAULT now()
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX idx_folders_parent_id ON folders (parent_id);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE files ADD COLUMN folder_id BIGINT REFERENCES folders (id) ON DELETE SET NULL;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX idx_files_folder_id ON files (folder_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE files DROP COLUMN IF EXISTS folder_id;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE IF EXISTS folders;
+-- +goose StatementEnd
@@ -0,0 +1,40 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE tags (
+    id   BIGSERIAL PRIMARY KEY,
+    name TEXT      NOT NULL UNIQUE CHECK (name <> '')
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TABLE file_tags (
+    file_id BIGINT NOT NULL REFERENCES files (id) ON DELETE CASCADE,
+    tag_id  BIGINT NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+    PRIMARY KEY (file_id, tag_id)
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX idx_file_tags_tag_id ON file_tags (tag_id);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE files ADD COLUMN metadata JSONB NOT NULL DEFAULT '{}';
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX idx_files_metadata ON files USING GIN (metadata jsonb_path_ops);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE files DROP COLUMN IF EXISTS metadata;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE IF EXISTS file_tags;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE IF EXISTS tags;
+-- +goose StatementEnd
@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE files ADD COLUMN extracted_text TEXT;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE files ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', translate(name, '._-', '   ')), 'A') ||
+    setweight(to_tsvector('english', coalesce(resume, '') || ' ' || coalesce(translation_summary, '')), 'B') ||
+    setweight(to_tsvector('english', coalesce(extracted_text, '')), 'D')
+) STORED;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX idx_files_search_vector ON files USING GIN (search_vector);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE files DROP COLUMN IF EXISTS search_vector;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE files DROP COLUMN IF EXISTS extracted_text;
+-- +goose StatementEnd
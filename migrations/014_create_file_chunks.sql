@@ -0,0 +1,36 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE file_chunks (
+    id          BIGSERIAL    PRIMARY KEY,
+    file_id     BIGINT       NOT NULL REFERENCES files (id) ON DELETE CASCADE,
+    version     INTEGER      NOT NULL,
+    chunk_index INTEGER      NOT NULL,
+    content     TEXT         NOT NULL,
+    model       TEXT         NOT NULL,
+    embedding   REAL[]       NOT NULL,
+    created_at  TIMESTAMPTZ  NOT NULL DEFAULT now(),
+    UNIQUE (file_id, chunk_index)
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX idx_file_chunks_model ON file_chunks (model);
+-- +goose StatementEnd
+
+-- pgvector is optional: without it, similarity is computed in the service.
+-- +goose StatementBegin
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM pg_available_extensions WHERE name = 'vector') THEN
+        CREATE EXTENSION IF NOT EXISTS vector;
+    END IF;
+EXCEPTION WHEN insufficient_privilege THEN
+    RAISE NOTICE 'pgvector is available but could not be enabled: %', SQLERRM;
+END
+$$;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS file_chunks;
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE file_chunks
+    ADD COLUMN start_offset INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN end_offset   INTEGER NOT NULL DEFAULT 0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE file_chunks
+    DROP COLUMN IF EXISTS end_offset,
+    DROP COLUMN IF EXISTS start_offset;
+-- +goose StatementEnd
@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE analyses (
+    id             BIGSERIAL    PRIMARY KEY,
+    file_id        BIGINT       NOT NULL REFERENCES files (id) ON DELETE CASCADE,
+    version        INTEGER      NOT NULL,
+    type           TEXT         NOT NULL,
+    model          TEXT         NOT NULL,
+    prompt_version TEXT         NOT NULL,
+    input_hash     TEXT         NOT NULL,
+    output         JSONB        NOT NULL,
+    input_tokens   INTEGER      NOT NULL DEFAULT 0,
+    output_tokens  INTEGER      NOT NULL DEFAULT 0,
+    latency_ms     INTEGER      NOT NULL DEFAULT 0,
+    created_at     TIMESTAMPTZ  NOT NULL DEFAULT now()
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX idx_analyses_file_id ON analyses (file_id, created_at DESC);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS analyses;
+-- +goose StatementEnd
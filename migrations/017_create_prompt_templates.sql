@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE prompt_templates (
+    id          BIGSERIAL    PRIMARY KEY,
+    name        TEXT         NOT NULL,
+    version     INTEGER      NOT NULL,
+    type        TEXT         NOT NULL,
+    template    TEXT         NOT NULL,
+    description TEXT         NOT NULL DEFAULT '',
+    created_at  TIMESTAMPTZ  NOT NULL DEFAULT now(),
+    UNIQUE (name, version)
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE analyses ADD COLUMN prompt_name TEXT;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE analyses DROP COLUMN IF EXISTS prompt_name;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE IF EXISTS prompt_templates;
+-- +goose StatementEnd
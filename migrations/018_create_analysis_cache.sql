@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE analysis_cache (
+    content_hash   TEXT         NOT NULL,
+    type           TEXT         NOT NULL,
+    model          TEXT         NOT NULL,
+    prompt_version TEXT         NOT NULL,
+    prompt_hash    TEXT         NOT NULL,
+    response_model TEXT         NOT NULL,
+    input_hash     TEXT         NOT NULL,
+    output         JSONB        NOT NULL,
+    input_tokens   INTEGER      NOT NULL DEFAULT 0,
+    output_tokens  INTEGER      NOT NULL DEFAULT 0,
+    created_at     TIMESTAMPTZ  NOT NULL DEFAULT now(),
+    PRIMARY KEY (content_hash, type, model, prompt_version, prompt_hash)
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE analyses ADD COLUMN cached BOOLEAN NOT NULL DEFAULT false;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE analyses DROP COLUMN IF EXISTS cached;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE IF EXISTS analysis_cache;
+-- +goose StatementEnd
@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE ai_usage (
+    id            BIGSERIAL        PRIMARY KEY,
+    tenant        TEXT,
+    operation     TEXT             NOT NULL,
+    model         TEXT             NOT NULL,
+    file_id       BIGINT           REFERENCES files (id) ON DELETE SET NULL,
+    input_tokens  INTEGER          NOT NULL DEFAULT 0,
+    output_tokens INTEGER          NOT NULL DEFAULT 0,
+    cost_usd      DOUBLE PRECISION NOT NULL DEFAULT 0,
+    created_at    TIMESTAMPTZ      NOT NULL DEFAULT now()
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX idx_ai_usage_created_at ON ai_usage (created_at);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX idx_ai_usage_tenant_created_at ON ai_usage (tenant, created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS ai_usage;
+-- +goose StatementEnd
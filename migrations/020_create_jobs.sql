@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE jobs (
+    id          BIGSERIAL    PRIMARY KEY,
+    type        TEXT         NOT NULL,
+    status      TEXT         NOT NULL DEFAULT 'queued',
+    file_id     BIGINT       REFERENCES files (id) ON DELETE CASCADE,
+    tenant      TEXT,
+    params      JSONB        NOT NULL DEFAULT '{}',
+    progress    INTEGER      NOT NULL DEFAULT 0,
+    result      JSONB,
+    error       TEXT,
+    created_at  TIMESTAMPTZ  NOT NULL DEFAULT now(),
+    started_at  TIMESTAMPTZ,
+    finished_at TIMESTAMPTZ
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX idx_jobs_active ON jobs (status) WHERE status IN ('queued', 'running');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS jobs;
+-- +goose StatementEnd
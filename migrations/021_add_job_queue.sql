@@ -0,0 +1,63 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE jobs
+    ADD COLUMN queue        TEXT        NOT NULL DEFAULT 'default',
+    ADD COLUMN attempts     INTEGER     NOT NULL DEFAULT 0,
+    ADD COLUMN max_attempts INTEGER     NOT NULL DEFAULT 1,
+    ADD COLUMN run_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD COLUMN unique_key   TEXT,
+    ADD COLUMN locked_by    TEXT,
+    ADD COLUMN locked_until TIMESTAMPTZ;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_jobs_active;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX idx_jobs_claim ON jobs (queue, run_at, id) WHERE status = 'queued';
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX idx_jobs_lease ON jobs (queue, locked_until) WHERE status = 'running';
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE UNIQUE INDEX idx_jobs_unique_key ON jobs (unique_key) WHERE status IN ('queued', 'running');
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX idx_jobs_finished ON jobs (finished_at) WHERE finished_at IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_jobs_finished;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_jobs_unique_key;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_jobs_lease;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_jobs_claim;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE jobs
+    DROP COLUMN locked_until,
+    DROP COLUMN locked_by,
+    DROP COLUMN unique_key,
+    DROP COLUMN run_at,
+    DROP COLUMN max_attempts,
+    DROP COLUMN attempts,
+    DROP COLUMN queue;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX idx_jobs_active ON jobs (status) WHERE status IN ('queued', 'running');
+-- +goose StatementEnd
@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE file_pii_findings (
+    id           BIGSERIAL    PRIMARY KEY,
+    file_id      BIGINT       NOT NULL,
+    version      INTEGER      NOT NULL,
+    type         TEXT         NOT NULL,
+    start_offset INTEGER      NOT NULL,
+    end_offset   INTEGER      NOT NULL,
+    detector     TEXT         NOT NULL,
+    FOREIGN KEY (file_id, version) REFERENCES file_versions (file_id, version) ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX idx_file_pii_findings_version ON file_pii_findings (file_id, version, start_offset);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE file_versions ADD COLUMN pii_scanned_at TIMESTAMPTZ;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE file_versions DROP COLUMN IF EXISTS pii_scanned_at;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE IF EXISTS file_pii_findings;
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- GPS positions and camera serial numbers are no longer kept in properties
+-- unless METADATA_PRIVATE is set; drop those extracted before.
+-- +goose StatementBegin
+UPDATE files
+SET properties = (properties - 'gps') #- '{exif,body_serial_number}'
+WHERE properties ? 'gps' OR properties -> 'exif' ? 'body_serial_number';
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+UPDATE file_versions
+SET properties = (properties - 'gps') #- '{exif,body_serial_number}'
+WHERE properties ? 'gps' OR properties -> 'exif' ? 'body_serial_number';
+-- +goose StatementEnd
+
+-- +goose Down
+-- The removed properties cannot be restored; they are extracted again for
+-- new uploads with METADATA_PRIVATE set.
+-- +goose StatementBegin
+SELECT 1;
+-- +goose StatementEnd